@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+	"github.com/JonMunkholm/WebDbReader/internal/mask"
+	"github.com/JonMunkholm/WebDbReader/internal/policy"
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// accessFor returns the caller's view of a source's policy, or nil when the
+// source has no policy.
+func (a *app) accessFor(ctx context.Context, src *source.Source) *policy.Access {
+	if src.Policy == nil {
+		return nil
+	}
+	var roles []string
+	if u, ok := auth.UserFromContext(ctx); ok {
+		roles = u.Roles
+	}
+	return src.Policy.For(roles)
+}
+
+// schemaFilter hides tables and columns the caller may not read. It returns
+// nil, showing everything, when the source has no policy.
+func (a *app) schemaFilter(ctx context.Context, src *source.Source) schema.Filter {
+	if access := a.accessFor(ctx, src); access != nil {
+		return access.SchemaFilter()
+	}
+	return nil
+}
+
+// llmSchemaFilter is schemaFilter narrowed further by the redaction config:
+// the part of the schema the LLM may be told about.
+func (a *app) llmSchemaFilter(ctx context.Context, src *source.Source) schema.Filter {
+	visible := a.schemaFilter(ctx, src)
+	if a.redactor == nil {
+		return visible
+	}
+	redact := a.redactor.SchemaFilter()
+	if visible == nil {
+		return redact
+	}
+	return func(t schema.Table) (schema.Table, bool) {
+		if t, ok := visible(t); ok {
+			return redact(t)
+		}
+		return schema.Table{}, false
+	}
+}
+
+// errWithheldQuery rejects LLM tool queries that would read what the
+// redaction config withholds from the LLM.
+var errWithheldQuery = fmt.Errorf("%w: query reads tables or columns withheld from the LLM", policy.ErrAccessDenied)
+
+// redactionAllows reports whether a query, such as a knowledge example, can
+// be shown to the LLM without naming redacted tables or columns.
+func (a *app) redactionAllows(src *source.Source, query string) bool {
+	if a.redactor == nil {
+		return true
+	}
+	parsed, err := sqlparse.ParseWith(query, src.Dialect.Syntax())
+	return err == nil && a.redactor.AllowsQuery(parsed, src.Schema.GetTables())
+}
+
+// logRedactions logs what of a source's schema is withheld from the LLM.
+func (g generation) logRedactions(src *source.Source) {
+	if g.redactor == nil {
+		return
+	}
+	if desc := g.redactor.Describe(src.Schema.GetTables()); desc != "" {
+		log.Printf("withholding from the LLM for source %s: %s", src.Name, desc)
+	}
+}
+
+// checkQueryAccess analyses the relations and columns a query references and
+// rejects it if the caller's policy forbids any of them. DuckDB reads any file
+// the server can through table functions and quoted paths, so those are
+// refused there even without a policy, and data file sources may only read
+// their views.
+func (a *app) checkQueryAccess(ctx context.Context, src *source.Source, query string) error {
+	access := a.accessFor(ctx, src)
+	if access == nil && src.Dialect.Name() != "duckdb" {
+		return nil
+	}
+	parsed, err := sqlparse.ParseWith(query, src.Dialect.Syntax())
+	if err != nil {
+		return fmt.Errorf("parse query: %w", err)
+	}
+	if src.Views != nil {
+		if err := policy.CheckViews(parsed, src.Views); err != nil {
+			return err
+		}
+	}
+	if access == nil {
+		return policy.CheckExternal(parsed)
+	}
+	return access.CheckQuery(parsed, src.Schema.GetTables())
+}
+
+// queryErrorStatus maps a query execution error to an HTTP status.
+func queryErrorStatus(err error) int {
+	if errors.Is(err, policy.ErrAccessDenied) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+type maskedContextKey struct{}
+
+// withMasking marks a context whose results must be masked even for callers
+// holding an unmask role, e.g. snapshots that other users will view.
+func withMasking(ctx context.Context) context.Context {
+	return context.WithValue(ctx, maskedContextKey{}, true)
+}
+
+// maskPlan decides which result columns the caller sees masked. It returns
+// nil when nothing needs masking.
+func (a *app) maskPlan(ctx context.Context, src *source.Source, query string, columns []string) *mask.Plan {
+	if a.masker == nil {
+		return nil
+	}
+	if forced, _ := ctx.Value(maskedContextKey{}).(bool); !forced {
+		if u, ok := auth.UserFromContext(ctx); ok && a.masker.CanUnmask(u.Roles) {
+			return nil
+		}
+	}
+
+	// An unparseable query still gets masked, by column name alone
+	parsed, err := sqlparse.ParseWith(query, src.Dialect.Syntax())
+	if err != nil {
+		parsed = nil
+	}
+	return a.masker.Plan(columns, parsed)
+}
+
+// joinInts formats column indices for a header value.
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/llm"
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+)
+
+const (
+	maxToolRows      = 10  // Rows run_readonly_query returns
+	maxToolValues    = 20  // Distinct values sample_values returns
+	maxToolValueLen  = 200 // Longer strings are cut
+	toolQueryTimeout = 5 * time.Second
+)
+
+// toolQuery is a statement a tool ran for the LLM, kept for the audit log.
+type toolQuery struct {
+	SQL        string
+	RowCount   int
+	DurationMs int64
+	Error      string
+	status     int // HTTP status equivalent, for the audit outcome
+}
+
+// dbTools lets the LLM explore a source while it writes SQL. It sees what the
+// caller sees: tables and columns hidden by the caller's policy don't exist,
+// queries are access checked and masked, and everything runs in a read-only
+// transaction whatever the source's setting. It serves a single request.
+type dbTools struct {
+	a      *app
+	src    *source.Source
+	tables []schema.Table // Visible to the caller
+
+	mu      sync.Mutex
+	queries []toolQuery
+}
+
+func (a *app) newDBTools(ctx context.Context, src *source.Source) *dbTools {
+	return &dbTools{
+		a:      a,
+		src:    src,
+		tables: src.Schema.GetTablesFiltered(a.llmSchemaFilter(ctx, src)),
+	}
+}
+
+func stringParam(desc string) map[string]any {
+	return map[string]any{"type": "string", "description": desc}
+}
+
+// Tools describes the tools to the LLM.
+func (t *dbTools) Tools() []llm.Tool {
+	return []llm.Tool{
+		{
+			Name:        "list_tables",
+			Description: "List the tables with their column counts and approximate row counts.",
+			Parameters:  map[string]any{"type": "object", "properties": map[string]any{}},
+		},
+		{
+			Name:        "describe_table",
+			Description: "Describe a table: its columns with types, primary key, foreign keys and indexes.",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"table": stringParam("Table name")},
+				"required":   []string{"table"},
+			},
+		},
+		{
+			Name:        "sample_values",
+			Description: fmt.Sprintf("The %d most common values of a column, with their counts.", maxToolValues),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"table":  stringParam("Table name"),
+					"column": stringParam("Column name"),
+				},
+				"required": []string{"table", "column"},
+			},
+		},
+		{
+			Name:        "run_readonly_query",
+			Description: fmt.Sprintf("Run a SELECT query and see up to %d rows, e.g. to check how tables join. Not for computing the answer.", maxToolRows),
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"sql": stringParam("A single SELECT statement")},
+				"required":   []string{"sql"},
+			},
+		},
+	}
+}
+
+// Call runs a tool. Its result is compact JSON.
+func (t *dbTools) Call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	var params struct {
+		Table  string `json:"table"`
+		Column string `json:"column"`
+		SQL    string `json:"sql"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	switch name {
+	case "list_tables":
+		type tableInfo struct {
+			Name        string `json:"name"`
+			Columns     int    `json:"columns"`
+			RowEstimate int64  `json:"rowEstimate"`
+		}
+		list := make([]tableInfo, len(t.tables))
+		for i, table := range t.tables {
+			list[i] = tableInfo{Name: table.Name, Columns: len(table.Columns), RowEstimate: table.RowEstimate}
+		}
+		return marshalToolResult(list)
+
+	case "describe_table":
+		table, err := t.table(params.Table)
+		if err != nil {
+			return "", err
+		}
+		return marshalToolResult(table)
+
+	case "sample_values":
+		table, err := t.table(params.Table)
+		if err != nil {
+			return "", err
+		}
+		var column string
+		for _, c := range table.Columns {
+			if strings.EqualFold(c.Name, params.Column) {
+				column = c.Name
+			}
+		}
+		if column == "" {
+			return "", fmt.Errorf("unknown column %q in table %s", params.Column, table.Name)
+		}
+		syn := t.src.Dialect.Syntax()
+		col := syn.QuoteIdent(column)
+		query := fmt.Sprintf("SELECT %s, COUNT(*) FROM %s GROUP BY %s ORDER BY 2 DESC LIMIT %d",
+			col, syn.QuoteIdent(table.Name), col, maxToolValues)
+		return t.query(ctx, query, maxToolValues)
+
+	case "run_readonly_query":
+		return t.query(ctx, params.SQL, maxToolRows)
+	}
+	return "", fmt.Errorf("unknown tool %q", name)
+}
+
+// table finds a visible table by name, ignoring case.
+func (t *dbTools) table(name string) (schema.Table, error) {
+	for _, table := range t.tables {
+		if strings.EqualFold(table.Name, name) {
+			return table, nil
+		}
+	}
+	return schema.Table{}, fmt.Errorf("unknown table %q", name)
+}
+
+type toolQueryResult struct {
+	Columns []string `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	More    bool     `json:"more,omitempty"` // Rows were left out
+}
+
+// query runs a statement for the LLM and records it for the audit log.
+func (t *dbTools) query(ctx context.Context, raw string, maxRows int) (string, error) {
+	start := time.Now()
+	res, err := t.readRows(ctx, raw, maxRows)
+
+	q := toolQuery{
+		SQL:        strings.TrimSpace(raw),
+		RowCount:   len(res.Rows),
+		DurationMs: time.Since(start).Milliseconds(),
+		status:     http.StatusOK,
+	}
+	if err != nil {
+		q.Error = err.Error()
+		q.status = queryErrorStatus(err)
+	}
+	t.mu.Lock()
+	t.queries = append(t.queries, q)
+	t.mu.Unlock()
+
+	if err != nil {
+		return "", err
+	}
+	return marshalToolResult(res)
+}
+
+func (t *dbTools) readRows(ctx context.Context, raw string, maxRows int) (toolQueryResult, error) {
+	query, err := validateSelectQuery(t.src.Dialect, raw)
+	if err != nil {
+		return toolQueryResult{}, err
+	}
+	if err := t.a.checkQueryAccess(ctx, t.src, query); err != nil {
+		return toolQueryResult{}, err
+	}
+	if !t.a.redactionAllows(t.src, query) {
+		return toolQueryResult{}, errWithheldQuery
+	}
+
+	// Not every dialect enforces the timeout in the transaction
+	ctx, cancel := context.WithTimeout(ctx, toolQueryTimeout)
+	defer cancel()
+
+	tx, err := t.src.Dialect.BeginReadOnly(ctx, t.src.DB, toolQueryTimeout)
+	if err != nil {
+		return toolQueryResult{}, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, t.src.Dialect.LimitQuery(query, toolQueryTimeout))
+	if err != nil {
+		return toolQueryResult{}, err
+	}
+	defer rows.Close()
+
+	res := toolQueryResult{Rows: [][]any{}}
+	if res.Columns, err = rows.Columns(); err != nil {
+		return toolQueryResult{}, err
+	}
+	plan := t.a.maskPlan(ctx, t.src, query, res.Columns)
+	for rows.Next() {
+		if len(res.Rows) == maxRows {
+			res.More = true
+			break
+		}
+		values, err := scanRow(rows, len(res.Columns))
+		if err != nil {
+			return toolQueryResult{}, err
+		}
+		row := normalizeRow(values, plan)
+		for i, v := range row {
+			if s, ok := v.(string); ok && len(s) > maxToolValueLen {
+				n := maxToolValueLen
+				for !utf8.RuneStart(s[n]) {
+					n--
+				}
+				row[i] = s[:n] + "…"
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, rows.Err()
+}
+
+// Queries returns the statements the tools ran, in order.
+func (t *dbTools) Queries() []toolQuery {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]toolQuery(nil), t.queries...)
+}
+
+func marshalToolResult(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.New("failed to encode result")
+	}
+	return string(data), nil
+}
+
+// auditToolQueries records the statements the LLM ran through tools while
+// answering prompt. It stops at the first record that can't be written.
+func (a *app) auditToolQueries(r *http.Request, src, prompt string, queries []toolQuery) error {
+	for _, q := range queries {
+		if err := a.recordAudit(r, q.status, audit.Record{
+			Action:     audit.ActionToolQuery,
+			Source:     src,
+			SQL:        q.SQL,
+			Prompt:     prompt,
+			FromLLM:    true,
+			RowCount:   q.RowCount,
+			DurationMs: q.DurationMs,
+			Error:      q.Error,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
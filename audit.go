@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+	"github.com/JonMunkholm/WebDbReader/internal/history"
+)
+
+const (
+	defaultAuditPage = 100
+	maxAuditPage     = 1000
+)
+
+type auditListResponse struct {
+	Records []audit.Record `json:"records"`
+	Total   int            `json:"total"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// errAuditFailed withholds results that couldn't be audited.
+var errAuditFailed = errors.New("the audit log can't be written; result withheld")
+
+// recordAudit appends an audit record for the request. status is the HTTP
+// status the action ended with and determines the outcome. It returns
+// errAuditFailed when the record can't be written; callers that haven't
+// responded yet must withhold the result.
+func (a *app) recordAudit(r *http.Request, status int, rec audit.Record) error {
+	if a.audit == nil {
+		return nil
+	}
+
+	rec.User = requestUser(r)
+	rec.ClientIP = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		rec.ClientIP = host
+	}
+	rec.ForwardedFor = r.Header.Get("X-Forwarded-For")
+
+	switch {
+	case status == http.StatusForbidden:
+		rec.Outcome = audit.OutcomeDenied
+	case rec.Error != "" || status >= 400:
+		rec.Outcome = audit.OutcomeError
+	default:
+		rec.Outcome = audit.OutcomeOK
+	}
+
+	if _, err := a.audit.Append(rec); err != nil {
+		log.Printf("error: failed to write audit record: %v", err)
+		return errAuditFailed
+	}
+	return nil
+}
+
+// requireAudit refuses audited requests once the audit log can't be written,
+// so nothing runs unaudited.
+func (a *app) requireAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.audit != nil && a.audit.Err() != nil {
+			respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "the audit log can't be written; queries are disabled"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxProvenanceDepth bounds the history walk in fromLLM.
+const maxProvenanceDepth = 20
+
+// fromLLM reports whether sql is unedited LLM output: following the history
+// chain from parentID through entries with the same SQL reaches a generation.
+func (a *app) fromLLM(parentID, sql string) bool {
+	if a.history == nil {
+		return false
+	}
+	sql = strings.TrimSpace(sql)
+	for i := 0; parentID != "" && i < maxProvenanceDepth; i++ {
+		parent, ok := a.history.Get(parentID)
+		if !ok || strings.TrimSpace(parent.SQL) != sql {
+			return false
+		}
+		if parent.Kind == history.KindGenerate {
+			return true
+		}
+		parentID = parent.ParentID
+	}
+	return false
+}
+
+// requireAdmin rejects callers without the admin role.
+func (a *app) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := auth.UserFromContext(r.Context()); ok && u.IsAdmin() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		respondJSON(w, http.StatusForbidden, map[string]string{"error": "admin role required"})
+	})
+}
+
+func (a *app) handleAuditList(w http.ResponseWriter, r *http.Request) {
+	if a.audit == nil {
+		respondJSON(w, http.StatusServiceUnavailable, auditListResponse{Error: "audit log is not enabled"})
+		return
+	}
+
+	q := r.URL.Query()
+	filter := audit.Filter{
+		User:    q.Get("user"),
+		Action:  q.Get("action"),
+		Source:  q.Get("source"),
+		Outcome: q.Get("outcome"),
+		Limit:   defaultAuditPage,
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		respondJSON(w, http.StatusBadRequest, auditListResponse{Error: "invalid since: " + err.Error()})
+		return
+	}
+	if filter.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		respondJSON(w, http.StatusBadRequest, auditListResponse{Error: "invalid until: " + err.Error()})
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondJSON(w, http.StatusBadRequest, auditListResponse{Error: "invalid limit"})
+			return
+		}
+		filter.Limit = min(n, maxAuditPage)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondJSON(w, http.StatusBadRequest, auditListResponse{Error: "invalid offset"})
+			return
+		}
+		filter.Offset = n
+	}
+
+	records, total, err := a.audit.List(filter)
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, auditListResponse{Error: err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, auditListResponse{
+		Records: records,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	})
+}
+
+// auditLogPath is where the audit log lives unless AUDIT_LOG overrides it.
+func auditLogPath() string {
+	return env("AUDIT_LOG", filepath.Join(env("DATA_DIR", defaultDataDir), "audit.jsonl"))
+}
+
+// auditKey is the HMAC key of the audit log's hash chain, from AUDIT_KEY.
+func auditKey() []byte {
+	return []byte(env("AUDIT_KEY", ""))
+}
+
+// runVerifyAudit implements "webdbreader verify-audit [file]". It exits
+// non-zero when the hash chain is broken.
+func runVerifyAudit(args []string) int {
+	path := auditLogPath()
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	res, err := audit.Verify(path, auditKey())
+	if errors.Is(err, audit.ErrTampered) {
+		fmt.Fprintf(os.Stderr, "%s: %v (first %d records intact)\n", path, err, res.Records)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 2
+	}
+	fmt.Printf("%s: %d records, chain intact, head %s\n", path, res.Records, res.Head)
+	return 0
+}
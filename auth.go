@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+)
+
+// authView is the login state rendered into the web UI.
+type authView struct {
+	Enabled  bool       // Authentication is configured
+	Required bool       // Visitor must sign in before using the app
+	User     *auth.User // Signed-in user, if any
+	Password bool       // Local username/password login is available
+	OIDC     bool       // Single sign-on is available
+	Next     string     // Where to go after signing in
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type authResponse struct {
+	User  *auth.User `json:"user,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+// requestUser identifies who issued a request, for history, ownership, audit
+// and LLM usage alike. Without authentication any identity header would be
+// the client's to choose, so anonymous callers are told apart by address.
+func requestUser(r *http.Request) string {
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		return u.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "anonymous@" + host
+}
+
+// isAdmin reports whether the caller is an authenticated admin.
+func isAdmin(r *http.Request) bool {
+	u, ok := auth.UserFromContext(r.Context())
+	return ok && u.IsAdmin()
+}
+
+// identify attaches the caller's identity to the request context when
+// authentication is enabled.
+func (a *app) identify(next http.Handler) http.Handler {
+	if a.auth == nil {
+		return next
+	}
+	return a.auth.Middleware(next)
+}
+
+// requireUser rejects unauthenticated requests. Browsers navigating to a
+// page are sent to the login screen; API calls get a 401.
+func (a *app) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := auth.UserFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		respondJSON(w, http.StatusUnauthorized, authResponse{Error: "authentication required"})
+	})
+}
+
+func (a *app) authView(r *http.Request) authView {
+	if a.auth == nil {
+		return authView{}
+	}
+	view := authView{
+		Enabled:  true,
+		Password: a.auth.PasswordEnabled(),
+		OIDC:     a.auth.OIDC() != nil,
+		Next:     safeNext(r.URL.Query().Get("next")),
+	}
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		view.User = &u
+	} else {
+		view.Required = true
+	}
+	return view
+}
+
+func (a *app) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if a.auth == nil || !a.auth.PasswordEnabled() {
+		respondJSON(w, http.StatusNotFound, authResponse{Error: "password login is not enabled"})
+		return
+	}
+
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, authResponse{Error: "invalid JSON body"})
+		return
+	}
+
+	user, err := a.auth.CheckPassword(req.Username, req.Password)
+	if err != nil {
+		log.Printf("failed login for %q from %s", req.Username, r.RemoteAddr)
+		respondJSON(w, http.StatusUnauthorized, authResponse{Error: err.Error()})
+		return
+	}
+
+	if err := a.auth.Sessions().Issue(w, user); err != nil {
+		respondJSON(w, http.StatusInternalServerError, authResponse{Error: "failed to create session"})
+		return
+	}
+	respondJSON(w, http.StatusOK, authResponse{User: &user})
+}
+
+func (a *app) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if a.auth != nil {
+		a.auth.Sessions().Clear(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) handleMe(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		respondJSON(w, http.StatusUnauthorized, authResponse{Error: "not signed in"})
+		return
+	}
+	respondJSON(w, http.StatusOK, authResponse{User: &u})
+}
+
+func (a *app) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if a.auth == nil || a.auth.OIDC() == nil {
+		http.Error(w, "single sign-on is not enabled", http.StatusNotFound)
+		return
+	}
+
+	target, err := a.auth.BeginOIDC(w, safeNext(r.URL.Query().Get("next")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (a *app) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if a.auth == nil || a.auth.OIDC() == nil {
+		http.Error(w, "single sign-on is not enabled", http.StatusNotFound)
+		return
+	}
+
+	user, next, err := a.auth.FinishOIDC(r.Context(), w, r)
+	if err != nil {
+		log.Printf("oidc login failed from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "sign-in failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.auth.Sessions().Issue(w, user); err != nil {
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	if next == "" {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// safeNext only allows same-origin paths as post-login redirects.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return ""
+	}
+	return next
+}
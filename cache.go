@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/gencache"
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// cacheHit describes where a cached answer came from. The prompt it was
+// generated for isn't included: it may be another user's.
+type cacheHit struct {
+	Match       string  `json:"match"`                // "exact" or "similar"
+	Similarity  float64 `json:"similarity,omitempty"` // Of the prompts' words, for similar matches
+	GeneratedAt string  `json:"generatedAt"`
+}
+
+// generationKey returns what the caller's generations against src depend on
+// besides the prompt. Their view of the schema, which their policy decides,
+// and the prompt template shape the answer too.
+func (a *app) generationKey(ctx context.Context, src *source.Source) gencache.Key {
+	return gencache.Key{
+		Source:      src.Name,
+		Model:       a.llm.Name() + "/" + a.llmModel,
+		Fingerprint: src.Schema.Fingerprint(),
+		Context: schema.Fingerprint(src.Schema.GetTablesFiltered(a.llmSchemaFilter(ctx, src))) +
+			"/" + a.prompts.For(src.Dialect.Name()).Version,
+	}
+}
+
+// cachedAnswer returns a cached answer to the same or a similar prompt.
+func (a *app) cachedAnswer(ctx context.Context, src *source.Source, prompt string) (generateSQLResponse, bool) {
+	if a.cache == nil || a.llm == nil {
+		return generateSQLResponse{}, false
+	}
+	hit, ok := a.cache.Get(a.generationKey(ctx, src), prompt, time.Now())
+	if !ok {
+		return generateSQLResponse{}, false
+	}
+
+	out := hit.Value
+	out.Cached = &cacheHit{
+		Match:       "exact",
+		GeneratedAt: hit.Created.UTC().Format(time.RFC3339),
+	}
+	if !hit.Exact {
+		out.Cached.Match = "similar"
+		out.Cached.Similarity = hit.Similarity
+	}
+	return out, true
+}
+
+// cacheAnswer stores a generation for later prompts. Cached answers cost
+// nothing, and tool calls are left out: their results are the asker's. The
+// SQL's string literals keep a prompt that names a value from answering
+// similar prompts that may name another.
+func (a *app) cacheAnswer(ctx context.Context, src *source.Source, prompt string, out generateSQLResponse) {
+	if a.cache == nil {
+		return
+	}
+	toks, err := sqlparse.TokenizeWith(out.SQL, src.Dialect.Syntax())
+	if err != nil {
+		return
+	}
+	var literals []string
+	for _, t := range toks {
+		if t.Kind == sqlparse.TokString {
+			literals = append(literals, t.Text)
+		}
+	}
+	out.Tokens, out.PromptTokens, out.CompletionTokens, out.Cost = 0, 0, 0, 0
+	out.ToolCalls, out.toolQueries = nil, nil
+	a.cache.Put(a.generationKey(ctx, src), prompt, out, literals, time.Now())
+}
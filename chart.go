@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/chart"
+	"github.com/JonMunkholm/WebDbReader/internal/llm"
+)
+
+// Chart modes of /query.
+const (
+	chartAuto = "auto" // Rules only
+	chartLLM  = "llm"  // Rules, with the LLM settling ambiguous results
+	chartNone = "none"
+)
+
+// maxChartTokens bounds the LLM's chart choice, a short JSON object.
+const maxChartTokens = 200
+
+// recommendChart recommends a chart for a query result. In "llm" mode an
+// ambiguous recommendation goes to the LLM, which sees the column names,
+// types and cardinalities but no values; if it fails or is over budget the
+// rules' pick stands.
+func (a *app) recommendChart(w http.ResponseWriter, r *http.Request, sourceName string, resp queryResponse, mode string) *chart.Recommendation {
+	if mode == chartNone || len(resp.Rows) == 0 {
+		return nil
+	}
+	columns := chart.Analyze(resp.Columns, resp.types, resp.Rows)
+	rec := chart.Recommend(columns, len(resp.Rows))
+	if rec == nil || !rec.Ambiguous || mode != chartLLM || a.llm == nil {
+		return rec
+	}
+
+	src, err := a.sources.Get(sourceName)
+	if err != nil {
+		return rec
+	}
+	user := requestUser(r)
+	reservation, err := a.reserveBudget(w, user)
+	if err != nil {
+		w.Header().Del("Retry-After") // The query itself was served
+		return rec
+	}
+	defer reservation.Release()
+	prompt, err := chart.AssistPrompt("", resp.query, columns, len(resp.Rows))
+	if err != nil {
+		return rec
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	out, err := a.llm.GenerateSQL(ctx, llm.GenerateRequest{
+		Prompt:    prompt,
+		System:    chart.AssistInstruction,
+		Dialect:   src.Dialect.Name(),
+		MaxTokens: maxChartTokens,
+		Prose:     true,
+	})
+	a.recordUsage(user, cmp.Or(out.Provider, a.llm.Name()), out.Model, out.PromptTokens, out.CompletionTokens, out.Tokens)
+	if err != nil {
+		log.Printf("warning: LLM chart choice failed, using the rules': %v", err)
+		return rec
+	}
+	choice, reason, err := chart.ParseChoice(out.Text, columns)
+	if err != nil {
+		log.Printf("warning: LLM chart choice rejected, using the rules': %v", err)
+		return rec
+	}
+	return &chart.Recommendation{
+		Choice:  choice,
+		Reason:  cmp.Or(reason, "chosen by the LLM"),
+		Source:  "llm",
+		Spec:    chart.Spec(choice, columns),
+		Columns: columns,
+		Tokens:  out.Tokens,
+	}
+}
+
+// validChartMode reports whether mode is a chart mode of /query.
+func validChartMode(mode string) bool {
+	switch mode {
+	case "", chartAuto, chartLLM, chartNone:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/chart"
+	"github.com/JonMunkholm/WebDbReader/internal/meta"
+	"github.com/JonMunkholm/WebDbReader/internal/params"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultDashboardWorkers = 4
+
+type dashboardRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Params      []params.Param `json:"params"`
+	Panels      []meta.Panel   `json:"panels"`
+}
+
+type dashboardResponse struct {
+	meta.Dashboard
+	Values  map[string]string `json:"values"`            // Parameter values the panels ran with
+	Results []panelResult     `json:"results,omitempty"` // In panel order
+}
+
+// panelResult is a panel's query result, shaped for its visualization.
+type panelResult struct {
+	Panel string    `json:"panel"`
+	Query string    `json:"query,omitempty"` // Name of the saved query
+	RanAt time.Time `json:"ranAt"`
+	queryResponse
+}
+
+func (a *app) handleDashboardList(w http.ResponseWriter, r *http.Request) {
+	if !a.requireMeta(w) {
+		return
+	}
+	dashboards, err := a.meta.Dashboards()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"dashboards": dashboards})
+}
+
+func (a *app) handleDashboardCreate(w http.ResponseWriter, r *http.Request) {
+	if !a.requireMeta(w) {
+		return
+	}
+	d, ok := a.decodeDashboard(w, r)
+	if !ok {
+		return
+	}
+	d.CreatedBy = requestUser(r)
+	d, err := a.meta.CreateDashboard(d)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusCreated, d)
+}
+
+// handleDashboardGet returns a dashboard and runs its panels with the
+// parameter values in the URL query (?from=2024-01-01&to=today), falling
+// back to the defaults. ?run=false returns the definition alone.
+func (a *app) handleDashboardGet(w http.ResponseWriter, r *http.Request) {
+	d, ok := a.lookupDashboard(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	values := dashboardValues(r, d)
+	resp := dashboardResponse{Dashboard: d, Values: values}
+	if r.URL.Query().Get("run") != "false" {
+		resp.Results = a.runPanels(r, d.Panels, values)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleDashboardPanel runs one panel, for panels refreshing on their own.
+func (a *app) handleDashboardPanel(w http.ResponseWriter, r *http.Request) {
+	d, ok := a.lookupDashboard(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	p, ok := d.Panel(chi.URLParam(r, "panel"))
+	if !ok {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "panel not found"})
+		return
+	}
+	respondJSON(w, http.StatusOK, a.runPanel(r, p, dashboardValues(r, d)))
+}
+
+func (a *app) handleDashboardUpdate(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.lookupDashboard(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, old.CreatedBy) {
+		return
+	}
+	d, ok := a.decodeDashboard(w, r)
+	if !ok {
+		return
+	}
+	d, err := a.meta.UpdateDashboard(old.ID, d)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, d)
+}
+
+func (a *app) handleDashboardDelete(w http.ResponseWriter, r *http.Request) {
+	d, ok := a.lookupDashboard(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, d.CreatedBy) {
+		return
+	}
+	if err := a.meta.DeleteDashboard(d.ID); err != nil && !errors.Is(err, meta.ErrNotFound) {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDashboardPage opens the dashboard UI, or the list of dashboards
+// when no ID is given.
+func (a *app) handleDashboardPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		ID   string
+		Auth authView
+	}{chi.URLParam(r, "id"), a.authView(r)}
+	if err := a.dashboardTmpl.Execute(w, data); err != nil {
+		http.Error(w, "template error", http.StatusInternalServerError)
+	}
+}
+
+// runPanels runs panels concurrently, at most DASHBOARD_PARALLELISM at a
+// time, each as the caller and under the usual query timeout.
+func (a *app) runPanels(r *http.Request, panels []meta.Panel, values map[string]string) []panelResult {
+	results := make([]panelResult, len(panels))
+	sem := make(chan struct{}, max(a.dashboardWorkers, 1))
+	var wg sync.WaitGroup
+	for i, p := range panels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = a.runPanel(r, p, values)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runPanel runs a panel's saved query with the dashboard parameters it binds.
+func (a *app) runPanel(r *http.Request, p meta.Panel, values map[string]string) panelResult {
+	res := panelResult{Panel: p.ID, RanAt: time.Now().UTC()}
+	q, err := a.meta.Query(p.QueryID)
+	if err != nil {
+		res.Error = "saved query: " + err.Error()
+		return res
+	}
+	res.Query = q.Name
+
+	bound := make(map[string]string)
+	for qp, dp := range p.Bindings {
+		if v := values[dp]; v != "" {
+			bound[qp] = v
+		}
+	}
+	resp, status := a.runSavedQuery(r.Context(), q, bound, p.Limit)
+	if status == http.StatusOK {
+		resp.Chart = panelChart(p.Viz, resp)
+	}
+	if err := a.recordAudit(r, status, audit.Record{
+		Action:     audit.ActionDashboardPanel,
+		Source:     a.sourceName(q.Source),
+		SQL:        cmp.Or(resp.query, q.SQL),
+		RowCount:   resp.Count,
+		DurationMs: resp.DurationMs,
+		Error:      resp.Error,
+	}); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.queryResponse = resp
+	return res
+}
+
+// panelChart recommends the chart of a panel: none for tables and numbers,
+// the rules' pick for "chart", and the rules' pick drawn with the requested
+// mark otherwise.
+func panelChart(viz string, resp queryResponse) *chart.Recommendation {
+	if viz == "table" || viz == "number" || len(resp.Rows) == 0 {
+		return nil
+	}
+	columns := chart.Analyze(resp.Columns, resp.types, resp.Rows)
+	rec := chart.Recommend(columns, len(resp.Rows))
+	if rec == nil || viz == "chart" || rec.Mark == viz {
+		return rec
+	}
+	rec.Mark = viz
+	rec.Spec = chart.Spec(rec.Choice, columns)
+	return rec
+}
+
+// dashboardValues reads the dashboard parameters from the URL query,
+// falling back to their defaults.
+func dashboardValues(r *http.Request, d meta.Dashboard) map[string]string {
+	q := r.URL.Query()
+	values := make(map[string]string, len(d.Params))
+	for _, p := range d.Params {
+		values[p.Name] = p.Default
+		if q.Has(p.Name) {
+			values[p.Name] = q.Get(p.Name)
+		}
+	}
+	return values
+}
+
+// decodeDashboard reads a dashboard from the request body and checks that
+// its panels refer to saved queries taking the parameters they bind.
+func (a *app) decodeDashboard(w http.ResponseWriter, r *http.Request) (meta.Dashboard, bool) {
+	var req dashboardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return meta.Dashboard{}, false
+	}
+	d := meta.Dashboard{
+		Name:        req.Name,
+		Description: req.Description,
+		Params:      req.Params,
+		Panels:      req.Panels,
+	}
+	if err := d.Normalize(); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return meta.Dashboard{}, false
+	}
+	for _, p := range d.Panels {
+		q, err := a.meta.Query(p.QueryID)
+		if err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("panel %s: saved query %q: %v", p.ID, p.QueryID, err)})
+			return meta.Dashboard{}, false
+		}
+		for qp := range p.Bindings {
+			if params.Find(q.Params, qp) == nil {
+				respondJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("panel %s: saved query %q has no parameter %s", p.ID, q.Name, qp)})
+				return meta.Dashboard{}, false
+			}
+		}
+	}
+	return d, true
+}
+
+// lookupDashboard fetches a dashboard, writing an error response if it is unavailable.
+func (a *app) lookupDashboard(w http.ResponseWriter, id string) (meta.Dashboard, bool) {
+	if !a.requireMeta(w) {
+		return meta.Dashboard{}, false
+	}
+	d, err := a.meta.Dashboard(id)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": "dashboard: " + err.Error()})
+		return meta.Dashboard{}, false
+	}
+	return d, true
+}
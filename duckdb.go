@@ -0,0 +1,7 @@
+//go:build duckdb
+
+package main
+
+// DuckDB links a large C++ library through cgo, so it is only built in on
+// request: go build -tags duckdb
+import _ "github.com/marcboeker/go-duckdb"
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/eval"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+)
+
+// maxEvalRows bounds the result sets compared per query.
+const maxEvalRows = 10000
+
+// runEval implements "webdbreader eval [flags] suite.yaml". It exits 1 when
+// accuracy is below -fail-under and 2 on setup errors.
+func runEval(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	jsonOut := fs.String("json", "", "write the JSON report to `file`")
+	mdOut := fs.String("md", "", "write the Markdown report to `file` (default stdout)")
+	run := fs.String("run", "", "only run cases whose id matches `regexp`")
+	sourceName := fs.String("source", "", "data source for cases that don't name one")
+	timeout := fs.Duration("timeout", queryTimeout, "timeout for each query")
+	failUnder := fs.Float64("fail-under", 0, "exit 1 when execution accuracy is below this fraction")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: webdbreader eval [flags] suite.yaml\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	suite, err := eval.LoadSuite(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *run != "" {
+		if suite, err = suite.Filter(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "-run: %v\n", err)
+			return 2
+		}
+	}
+	if *sourceName != "" {
+		for i := range suite.Cases {
+			if suite.Cases[i].Source == "" {
+				suite.Cases[i].Source = *sourceName
+			}
+		}
+	}
+
+	a := &app{sources: openSources(), generation: loadGeneration()}
+	defer a.sources.Close()
+	if a.llm == nil {
+		fmt.Fprintln(os.Stderr, "eval needs an LLM: set LLM_API_KEY, or LLM_PROVIDER=replay")
+		return 2
+	}
+
+	runner := eval.Runner{
+		Generate: func(ctx context.Context, sourceName, question string) (eval.Generation, error) {
+			resp, status := a.generateSQL(ctx, sourceName, question, false)
+			gen := eval.Generation{
+				SQL:           resp.rawSQL,
+				Missing:       resp.Missing,
+				Tokens:        resp.Tokens,
+				PromptVersion: resp.PromptVersion,
+			}
+			switch {
+			case status == http.StatusOK:
+				return gen, nil
+			case status == http.StatusBadRequest && resp.rawSQL != "":
+				gen.Invalid = resp.Error
+				return gen, nil
+			case resp.Error != "":
+				return gen, errors.New(resp.Error)
+			default:
+				return gen, fmt.Errorf("LLM request failed (%d)", status)
+			}
+		},
+		Execute: func(ctx context.Context, sourceName, query string) (eval.Result, error) {
+			ctx, cancel := context.WithTimeout(ctx, *timeout)
+			defer cancel()
+			return a.evalQuery(ctx, sourceName, query, *timeout)
+		},
+	}
+
+	report := runner.Run(context.Background(), suite)
+	report.Suite = filepath.Base(fs.Arg(0))
+	report.Provider = a.llm.Name()
+	report.Model = env("LLM_MODEL", "")
+
+	if *jsonOut != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonOut, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write JSON report: %v\n", err)
+			return 2
+		}
+	}
+
+	var md io.Writer = os.Stdout
+	if *mdOut != "" {
+		f, err := os.Create(*mdOut)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "write Markdown report: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		md = f
+	}
+	fmt.Fprint(md, report.Markdown())
+
+	s := report.Summary
+	fmt.Fprintf(os.Stderr, "%d cases: %.1f%% correct, %.1f%% valid, %.1f%% MISSING, %d tokens\n",
+		s.Cases, 100*s.ExecutionAccuracy, 100*s.ValidityRate, 100*s.MissingRate, s.Tokens)
+	if s.ExecutionAccuracy < *failUnder {
+		return 1
+	}
+	return 0
+}
+
+// evalQuery runs a query for the eval command: validated and access checked
+// like any other, but always inside a read-only transaction, whatever the
+// source's setting, and unmasked.
+func (a *app) evalQuery(ctx context.Context, sourceName, raw string, timeout time.Duration) (eval.Result, error) {
+	src, err := a.sources.Get(sourceName)
+	if err != nil {
+		return eval.Result{}, err
+	}
+	query, err := validateSelectQuery(src.Dialect, raw)
+	if err != nil {
+		return eval.Result{}, err
+	}
+	if err := a.checkQueryAccess(ctx, src, query); err != nil {
+		return eval.Result{}, err
+	}
+	return readOnlyQuery(ctx, src, query, timeout)
+}
+
+func readOnlyQuery(ctx context.Context, src *source.Source, query string, timeout time.Duration) (eval.Result, error) {
+	tx, err := src.Dialect.BeginReadOnly(ctx, src.DB, timeout)
+	if err != nil {
+		return eval.Result{}, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, src.Dialect.LimitQuery(query, timeout))
+	if err != nil {
+		return eval.Result{}, err
+	}
+	defer rows.Close()
+
+	var res eval.Result
+	if res.Columns, err = rows.Columns(); err != nil {
+		return eval.Result{}, err
+	}
+	for rows.Next() {
+		if len(res.Rows) == maxEvalRows {
+			return eval.Result{}, fmt.Errorf("more than %d rows", maxEvalRows)
+		}
+		values, err := scanRow(rows, len(res.Columns))
+		if err != nil {
+			return eval.Result{}, err
+		}
+		res.Rows = append(res.Rows, normalizeRow(values, nil))
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/history"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultHistoryPage = 50
+	maxHistoryPage     = 500
+)
+
+type historyListResponse struct {
+	Entries []history.Entry `json:"entries"`
+	Total   int             `json:"total"`
+	Limit   int             `json:"limit"`
+	Offset  int             `json:"offset"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type historyDiffResponse struct {
+	From  history.Entry      `json:"from"`
+	To    history.Entry      `json:"to"`
+	Lines []history.DiffLine `json:"lines"`
+	Error string             `json:"error,omitempty"`
+}
+
+// recordHistory stores an entry attributed to the requesting user and returns its ID.
+// Failures are logged rather than surfaced, so history never breaks a query.
+func (a *app) recordHistory(r *http.Request, e history.Entry) string {
+	if a.history == nil {
+		return ""
+	}
+	e.User = requestUser(r)
+	saved, err := a.history.Add(e)
+	if err != nil {
+		log.Printf("warning: failed to record history: %v", err)
+		return ""
+	}
+	return saved.ID
+}
+
+func (a *app) handleHistoryList(w http.ResponseWriter, r *http.Request) {
+	if a.history == nil {
+		respondJSON(w, http.StatusServiceUnavailable, historyListResponse{Error: "history is not enabled"})
+		return
+	}
+
+	q := r.URL.Query()
+	filter := history.Filter{
+		User:   requestUser(r),
+		Kind:   q.Get("kind"),
+		Thread: q.Get("thread"),
+		Source: q.Get("source"),
+		Search: q.Get("q"),
+		Status: q.Get("status"),
+		Limit:  defaultHistoryPage,
+	}
+	if user := q.Get("user"); user != "" && user != filter.User {
+		if !isAdmin(r) {
+			respondJSON(w, http.StatusForbidden, historyListResponse{Error: "admin role required to see other users' history"})
+			return
+		}
+		filter.User = user
+		if user == "*" {
+			filter.User = ""
+		}
+	}
+
+	var err error
+	if filter.Since, err = parseTimeParam(q.Get("since")); err != nil {
+		respondJSON(w, http.StatusBadRequest, historyListResponse{Error: "invalid since: " + err.Error()})
+		return
+	}
+	if filter.Until, err = parseTimeParam(q.Get("until")); err != nil {
+		respondJSON(w, http.StatusBadRequest, historyListResponse{Error: "invalid until: " + err.Error()})
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			respondJSON(w, http.StatusBadRequest, historyListResponse{Error: "invalid limit"})
+			return
+		}
+		filter.Limit = min(n, maxHistoryPage)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondJSON(w, http.StatusBadRequest, historyListResponse{Error: "invalid offset"})
+			return
+		}
+		filter.Offset = n
+	}
+
+	entries, total := a.history.List(filter)
+	respondJSON(w, http.StatusOK, historyListResponse{
+		Entries: entries,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	})
+}
+
+func (a *app) handleHistoryGet(w http.ResponseWriter, r *http.Request) {
+	entry, ok := a.lookupHistory(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, entry)
+}
+
+// handleHistoryRerun replays a history entry. Generations without SQL are
+// regenerated from their prompt; everything else re-executes the stored SQL.
+// The new run is recorded as a child of the original entry.
+func (a *app) handleHistoryRerun(w http.ResponseWriter, r *http.Request) {
+	entry, ok := a.lookupHistory(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Limit int    `json:"limit"`
+		Chart string `json:"chart"` // As for /query
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+			return
+		}
+	}
+	if !validChartMode(req.Chart) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": `chart must be "auto", "llm" or "none"`})
+		return
+	}
+
+	if entry.Kind == history.KindGenerate && entry.SQL == "" {
+		start := time.Now()
+		resp, status := a.generateSQLWithBudget(w, r, entry.Source, entry.Prompt, false)
+		err := a.auditToolQueries(r, entry.Source, entry.Prompt, resp.toolQueries)
+		if err == nil {
+			err = a.recordAudit(r, status, audit.Record{
+				Action:     audit.ActionGenerate,
+				Source:     entry.Source,
+				Prompt:     entry.Prompt,
+				SQL:        resp.SQL,
+				FromLLM:    true,
+				DurationMs: time.Since(start).Milliseconds(),
+				Error:      resp.Error,
+			})
+		}
+		if err != nil {
+			respondJSON(w, http.StatusServiceUnavailable, generateSQLResponse{Error: err.Error()})
+			return
+		}
+		resp.HistoryID = a.recordHistory(r, history.Entry{
+			Kind:       history.KindGenerate,
+			ParentID:   entry.ID,
+			Source:     entry.Source,
+			Prompt:     entry.Prompt,
+			SQL:        resp.SQL,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      resp.Error,
+		})
+		respondJSON(w, status, resp)
+		return
+	}
+
+	resp, status := a.runQuery(r.Context(), entry.Source, entry.SQL, req.Limit)
+	if status == http.StatusOK {
+		resp.Chart = a.recommendChart(w, r, entry.Source, resp, req.Chart)
+	}
+	if err := a.recordAudit(r, status, audit.Record{
+		Action:     audit.ActionQuery,
+		Source:     entry.Source,
+		SQL:        entry.SQL,
+		FromLLM:    a.fromLLM(entry.ID, entry.SQL),
+		RowCount:   resp.Count,
+		DurationMs: resp.DurationMs,
+		Error:      resp.Error,
+	}); err != nil {
+		respondJSON(w, http.StatusServiceUnavailable, queryResponse{Error: err.Error()})
+		return
+	}
+	resp.HistoryID = a.recordHistory(r, history.Entry{
+		Kind:       history.KindQuery,
+		ParentID:   entry.ID,
+		Source:     entry.Source,
+		SQL:        entry.SQL,
+		RowCount:   resp.Count,
+		DurationMs: resp.DurationMs,
+		Error:      resp.Error,
+	})
+	respondJSON(w, status, resp)
+}
+
+// handleHistoryDiff diffs the SQL of an entry against another version of the
+// same query. Without ?against= it compares with the previous distinct version.
+func (a *app) handleHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	to, ok := a.lookupHistory(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	var from history.Entry
+	if againstID := r.URL.Query().Get("against"); againstID != "" {
+		if from, ok = a.lookupHistory(w, r, againstID); !ok {
+			return
+		}
+		if from.Thread != to.Thread {
+			respondJSON(w, http.StatusBadRequest, historyDiffResponse{Error: "entries are not versions of the same query"})
+			return
+		}
+	} else {
+		from, ok = previousVersion(a.visibleHistory(r, a.history.Versions(to.Thread)), to)
+		if !ok {
+			respondJSON(w, http.StatusNotFound, historyDiffResponse{Error: "no earlier version to compare against"})
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusOK, historyDiffResponse{
+		From:  from,
+		To:    to,
+		Lines: history.Diff(from.SQL, to.SQL),
+	})
+}
+
+// lookupHistory fetches an entry, writing an error response if it is unavailable.
+// Entries of other users look missing unless the caller is an admin.
+func (a *app) lookupHistory(w http.ResponseWriter, r *http.Request, id string) (history.Entry, bool) {
+	if a.history == nil {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "history is not enabled"})
+		return history.Entry{}, false
+	}
+	entry, ok := a.history.Get(id)
+	if !ok || (entry.User != requestUser(r) && !isAdmin(r)) {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "history entry not found"})
+		return history.Entry{}, false
+	}
+	return entry, true
+}
+
+// visibleHistory keeps the entries the caller may see. A thread can span users
+// when someone re-runs or derives from an entry they were shown.
+func (a *app) visibleHistory(r *http.Request, entries []history.Entry) []history.Entry {
+	if isAdmin(r) {
+		return entries
+	}
+	user := requestUser(r)
+	visible := entries[:0:0]
+	for _, e := range entries {
+		if e.User == user {
+			visible = append(visible, e)
+		}
+	}
+	return visible
+}
+
+// previousVersion finds the latest entry before cur whose SQL differs from it,
+// falling back to the immediately preceding entry when the SQL never changed.
+func previousVersion(versions []history.Entry, cur history.Entry) (history.Entry, bool) {
+	var fallback history.Entry
+	found := false
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if v.ID == cur.ID || v.CreatedAt.After(cur.CreatedAt) {
+			continue
+		}
+		if v.SQL != cur.SQL {
+			return v, true
+		}
+		if !found {
+			fallback, found = v, true
+		}
+	}
+	return fallback, found
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
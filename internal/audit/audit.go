@@ -0,0 +1,314 @@
+// Package audit keeps a tamper-evident, append-only log of executed statements.
+//
+// Each record is one JSON line whose hash covers the previous record's hash
+// and the record itself, so editing, reordering or deleting a record breaks
+// the chain from that point on. Given a key the hashes are HMACs, which only
+// its holders can recompute; without one, anyone able to edit the file can
+// rewrite the chain after the change, so tampering only shows against a head
+// hash kept elsewhere. Truncating the tail keeps the chain intact either way;
+// detect it by comparing the head hash Verify reports with a copy kept elsewhere.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Actions.
+const (
+	ActionQuery          = "query"
+	ActionExport         = "export"
+	ActionGenerate       = "generate"
+	ActionToolQuery      = "tool_query" // Run by the LLM through a tool while generating
+	ActionSummarize      = "summarize"  // Result read to be summarized by the LLM
+	ActionSchemaRefresh  = "schema_refresh"
+	ActionShareSnapshot  = "share_snapshot"
+	ActionDashboardPanel = "dashboard_panel"
+	ActionScheduledRun   = "scheduled_run" // Saved query run by a schedule
+)
+
+// Outcomes.
+const (
+	OutcomeOK     = "ok"
+	OutcomeError  = "error"
+	OutcomeDenied = "denied"
+)
+
+// ErrTampered is wrapped by every chain verification failure.
+var ErrTampered = errors.New("audit log tampered")
+
+// ErrUnavailable is wrapped by Append once a write has failed. The log then
+// refuses every further record, so nothing runs unaudited until a restart.
+var ErrUnavailable = errors.New("audit log unavailable")
+
+// Record is one audited action.
+type Record struct {
+	Seq          int64     `json:"seq"`
+	Time         time.Time `json:"time"`
+	User         string    `json:"user"`
+	ClientIP     string    `json:"clientIp"`
+	ForwardedFor string    `json:"forwardedFor,omitempty"` // X-Forwarded-For as received, unverified
+	Action       string    `json:"action"`
+	Source       string    `json:"source,omitempty"`
+	SQL          string    `json:"sql,omitempty"`
+	Params       []any     `json:"params,omitempty"` // Bind parameters, when the statement has any
+	Prompt       string    `json:"prompt,omitempty"`
+	FromLLM      bool      `json:"fromLlm"` // SQL was written by the LLM and run unedited
+	RowCount     int       `json:"rowCount"`
+	DurationMs   int64     `json:"durationMs"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+	PrevHash     string    `json:"prevHash"`
+	Hash         string    `json:"hash,omitempty"` // Always written last
+}
+
+// Filter narrows a listing. Zero values match everything.
+type Filter struct {
+	User    string
+	Action  string
+	Source  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+// Log appends records to a hash-chained JSONL file.
+type Log struct {
+	path string
+	key  []byte // HMAC key of the chain; nil for plain SHA-256
+	mu   sync.Mutex
+	f    *os.File
+	seq  int64
+	head string // Hash of the last record
+	err  error  // Set by the first failed write
+}
+
+// Open opens or creates the log at path and resumes its chain, keyed with key
+// unless it is empty.
+func Open(path string, key []byte) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create audit dir: %w", err)
+	}
+
+	l := &Log{path: path, key: key}
+	err := scan(path, func(line []byte, rec Record) error {
+		l.seq, l.head = rec.Seq, rec.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	l.f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return l, nil
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// Err returns the error that made the log unavailable, if any.
+func (l *Log) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Append chains the record onto the log and syncs it to disk. A failed write
+// is cut off the file and makes the log unavailable.
+func (l *Log) Append(rec Record) (Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return Record{}, l.err
+	}
+
+	rec.Seq = l.seq + 1
+	rec.PrevHash = l.head
+	rec.Hash = ""
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+
+	body, err := json.Marshal(rec)
+	if err != nil {
+		return Record{}, fmt.Errorf("encode audit record: %w", err)
+	}
+	rec.Hash = chainHash(l.key, rec.PrevHash, body)
+
+	info, err := l.f.Stat()
+	if err != nil {
+		l.err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+		return Record{}, l.err
+	}
+	if _, err = l.f.Write(seal(body, rec.Hash)); err == nil {
+		err = l.f.Sync()
+	}
+	if err != nil {
+		// Don't leave a partial line for the next record to follow
+		l.f.Truncate(info.Size())
+		l.err = fmt.Errorf("%w: write audit record: %w", ErrUnavailable, err)
+		return Record{}, l.err
+	}
+
+	l.seq, l.head = rec.Seq, rec.Hash
+	return rec, nil
+}
+
+// List returns matching records, newest first, and the total number matching.
+func (l *Log) List(f Filter) ([]Record, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var matched []Record
+	err := scan(l.path, func(_ []byte, rec Record) error {
+		if f.matches(rec) {
+			matched = append(matched, rec)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+
+	total := len(matched)
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	if f.Offset >= total {
+		return []Record{}, total, nil
+	}
+	matched = matched[f.Offset:]
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+	return matched, total, nil
+}
+
+func (f Filter) matches(rec Record) bool {
+	switch {
+	case f.User != "" && rec.User != f.User:
+		return false
+	case f.Action != "" && rec.Action != f.Action:
+		return false
+	case f.Source != "" && rec.Source != f.Source:
+		return false
+	case f.Outcome != "" && rec.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && rec.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !rec.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// VerifyResult summarizes a verified log.
+type VerifyResult struct {
+	Records int    `json:"records"`
+	Head    string `json:"head"` // Hash of the last record; record it elsewhere to detect truncation
+}
+
+// Verify recomputes the hash chain of the log at path with the key it was
+// written with. It fails with an error wrapping ErrTampered at the first
+// record that doesn't match.
+func Verify(path string, key []byte) (VerifyResult, error) {
+	var res VerifyResult
+	prev := ""
+	err := scan(path, func(line []byte, rec Record) error {
+		lineNo := res.Records + 1
+		if rec.Seq != int64(lineNo) {
+			return fmt.Errorf("%w: line %d has sequence %d", ErrTampered, lineNo, rec.Seq)
+		}
+		if rec.PrevHash != prev {
+			return fmt.Errorf("%w: line %d does not follow the previous record", ErrTampered, lineNo)
+		}
+		body, ok := unseal(line, rec.Hash)
+		if !ok || chainHash(key, rec.PrevHash, body) != rec.Hash {
+			return fmt.Errorf("%w: line %d does not match its hash", ErrTampered, lineNo)
+		}
+		prev = rec.Hash
+		res.Records++
+		return nil
+	})
+	res.Head = prev
+	return res, err
+}
+
+// scan calls fn for every record in the file.
+func scan(path string, fn func(line []byte, rec Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("read audit log: %w", err)
+		}
+		line = bytes.TrimRight(line, "\n")
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return fmt.Errorf("%w: line %d is not a valid record: %v", ErrTampered, lineNo, err)
+		}
+		if err := fn(line, rec); err != nil {
+			return err
+		}
+	}
+}
+
+func chainHash(key []byte, prev string, body []byte) string {
+	h := sha256.New()
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	}
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// seal appends the hash field to an encoded record: {...} becomes {...,"hash":"..."}.
+func seal(body []byte, hash string) []byte {
+	line := make([]byte, 0, len(body)+len(hash)+12)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, `,"hash":"`...)
+	line = append(line, hash...)
+	line = append(line, "\"}\n"...)
+	return line
+}
+
+// unseal recovers the hashed body of a line written by seal.
+func unseal(line []byte, hash string) ([]byte, bool) {
+	suffix := []byte(`,"hash":"` + hash + `"}`)
+	if hash == "" || !bytes.HasSuffix(line, suffix) {
+		return nil, false
+	}
+	body := make([]byte, 0, len(line)-len(suffix)+1)
+	body = append(body, line[:len(line)-len(suffix)]...)
+	return append(body, '}'), true
+}
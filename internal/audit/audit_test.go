@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeLog appends n records to a new log and returns its path and lines.
+func writeLog(t *testing.T, key []byte, n int) (string, [][]byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if _, err := l.Append(Record{User: "alice", Action: ActionQuery, SQL: "SELECT 1", Outcome: OutcomeOK}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+}
+
+func rewrite(t *testing.T, path string, lines [][]byte) {
+	t.Helper()
+	if err := os.WriteFile(path, bytes.Join(lines, nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyIntact(t *testing.T) {
+	path, _ := writeLog(t, nil, 3)
+	res, err := Verify(path, nil)
+	if err != nil || res.Records != 3 || res.Head == "" {
+		t.Fatalf("Verify = %+v, %v", res, err)
+	}
+
+	// Reopening resumes the chain
+	l, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := l.Append(Record{Action: ActionQuery})
+	l.Close()
+	if err != nil || rec.Seq != 4 || rec.PrevHash != res.Head {
+		t.Fatalf("Append after reopening = %+v, %v", rec, err)
+	}
+	if res, err := Verify(path, nil); err != nil || res.Records != 4 {
+		t.Errorf("Verify after reopening = %+v, %v", res, err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func([][]byte) [][]byte
+		intact int // Records before the first broken one
+	}{
+		{"edited", func(lines [][]byte) [][]byte {
+			lines[1] = bytes.Replace(lines[1], []byte("SELECT 1"), []byte("SELECT 2"), 1)
+			return lines
+		}, 1},
+		{"deleted", func(lines [][]byte) [][]byte {
+			return append(lines[:1], lines[2:]...)
+		}, 1},
+		{"reordered", func(lines [][]byte) [][]byte {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, 1},
+		{"first deleted", func(lines [][]byte) [][]byte {
+			return lines[1:]
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, lines := writeLog(t, nil, 3)
+			rewrite(t, path, tt.change(lines))
+			res, err := Verify(path, nil)
+			if !errors.Is(err, ErrTampered) {
+				t.Fatalf("Verify = %v, want ErrTampered", err)
+			}
+			if res.Records != tt.intact {
+				t.Errorf("intact records = %d, want %d", res.Records, tt.intact)
+			}
+		})
+	}
+}
+
+func TestKeyedChain(t *testing.T) {
+	key := []byte("audit-secret")
+	path, lines := writeLog(t, key, 2)
+	if _, err := Verify(path, key); err != nil {
+		t.Fatalf("Verify with the key: %v", err)
+	}
+	if _, err := Verify(path, []byte("other")); !errors.Is(err, ErrTampered) {
+		t.Errorf("Verify with another key = %v, want ErrTampered", err)
+	}
+	if _, err := Verify(path, nil); !errors.Is(err, ErrTampered) {
+		t.Errorf("Verify without the key = %v, want ErrTampered", err)
+	}
+
+	// Rewriting a record and its hash without the key doesn't verify
+	forged := filepath.Join(t.TempDir(), "forged.jsonl")
+	l, err := Open(forged, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(Record{User: "mallory", Action: ActionQuery, SQL: "SELECT 1", Outcome: OutcomeOK})
+	l.Close()
+	data, err := os.ReadFile(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrite(t, path, append([][]byte{data}, lines[1:]...))
+	if _, err := Verify(path, key); !errors.Is(err, ErrTampered) {
+		t.Errorf("Verify of a forged record = %v, want ErrTampered", err)
+	}
+}
+
+func TestAppendFailureMakesLogUnavailable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Err() != nil {
+		t.Fatalf("Err = %v on a new log", l.Err())
+	}
+	l.f.Close() // Writes now fail
+
+	if _, err := l.Append(Record{Action: ActionQuery}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Append = %v, want ErrUnavailable", err)
+	}
+	if !errors.Is(l.Err(), ErrUnavailable) {
+		t.Errorf("Err = %v after a failed write", l.Err())
+	}
+
+	// It stays unavailable even once writes would work again
+	if l.f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if _, err := l.Append(Record{Action: ActionQuery}); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("second Append = %v, want ErrUnavailable", err)
+	}
+}
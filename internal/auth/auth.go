@@ -0,0 +1,246 @@
+// Package auth provides authentication for the web UI and API: local users with
+// bcrypt passwords, bearer API tokens, OIDC login and signed session cookies.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RoleAdmin grants access to administrative endpoints.
+const RoleAdmin = "admin"
+
+// Authentication methods recorded on a User.
+const (
+	MethodPassword = "password"
+	MethodToken    = "token"
+	MethodOIDC     = "oidc"
+)
+
+// ErrInvalidCredentials is returned when a username/password pair doesn't match.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// User is an authenticated identity.
+type User struct {
+	Name   string   `json:"name"`
+	Roles  []string `json:"roles"`
+	Method string   `json:"method"`
+}
+
+// HasRole reports whether the user holds the given role.
+func (u User) HasRole(role string) bool {
+	return slices.Contains(u.Roles, role)
+}
+
+// IsAdmin reports whether the user holds the admin role.
+func (u User) IsAdmin() bool {
+	return u.HasRole(RoleAdmin)
+}
+
+// Config is the on-disk auth configuration (JSON).
+type Config struct {
+	Users   []LocalUser   `json:"users"`
+	Tokens  []APIToken    `json:"tokens"`
+	OIDC    *OIDCConfig   `json:"oidc,omitempty"`
+	Session SessionConfig `json:"session"`
+}
+
+// LocalUser is a username with a bcrypt password hash.
+type LocalUser struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"passwordHash"` // bcrypt, e.g. from `htpasswd -bnBC 10 "" pass`
+	Roles        []string `json:"roles"`
+}
+
+// APIToken is a bearer token for scripts. Only the SHA-256 of the token is stored.
+type APIToken struct {
+	Name      string   `json:"name"`
+	TokenHash string   `json:"tokenHash"` // hex SHA-256 of the raw token
+	User      string   `json:"user"`
+	Roles     []string `json:"roles"`
+}
+
+// SessionConfig controls session cookies.
+type SessionConfig struct {
+	Secret   string `json:"secret"`   // HMAC key; random per process if empty
+	TTL      string `json:"ttl"`      // Go duration, default 12h
+	Insecure bool   `json:"insecure"` // Drop the Secure flag (plain-HTTP development only)
+}
+
+// LoadConfig reads an auth config file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read auth config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse auth config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Authenticator verifies credentials and tracks sessions.
+type Authenticator struct {
+	users    map[string]LocalUser
+	tokens   map[string]APIToken
+	sessions *Sessions
+	oidc     *OIDC
+}
+
+// New builds an Authenticator from config. OIDC discovery runs against the
+// issuer, so ctx bounds startup.
+func New(ctx context.Context, cfg Config) (*Authenticator, error) {
+	ttl := 12 * time.Hour
+	if cfg.Session.TTL != "" {
+		d, err := time.ParseDuration(cfg.Session.TTL)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid session ttl %q", cfg.Session.TTL)
+		}
+		ttl = d
+	}
+
+	sessions, err := NewSessions([]byte(cfg.Session.Secret), ttl, !cfg.Session.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{
+		users:    make(map[string]LocalUser),
+		tokens:   make(map[string]APIToken),
+		sessions: sessions,
+	}
+
+	for _, u := range cfg.Users {
+		if u.Username == "" || u.PasswordHash == "" {
+			return nil, fmt.Errorf("local user requires username and passwordHash")
+		}
+		if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+			return nil, fmt.Errorf("user %q: invalid bcrypt hash: %w", u.Username, err)
+		}
+		a.users[u.Username] = u
+	}
+
+	for _, t := range cfg.Tokens {
+		hash := strings.ToLower(strings.TrimSpace(t.TokenHash))
+		if len(hash) != sha256.Size*2 || t.User == "" {
+			return nil, fmt.Errorf("token %q requires user and a hex sha256 tokenHash", t.Name)
+		}
+		a.tokens[hash] = t
+	}
+
+	if cfg.OIDC != nil {
+		a.oidc, err = NewOIDC(ctx, *cfg.OIDC)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Sessions returns the session cookie manager.
+func (a *Authenticator) Sessions() *Sessions {
+	return a.sessions
+}
+
+// OIDC returns the OIDC flow, or nil if OIDC is not configured.
+func (a *Authenticator) OIDC() *OIDC {
+	return a.oidc
+}
+
+// PasswordEnabled reports whether any local users are configured.
+func (a *Authenticator) PasswordEnabled() bool {
+	return len(a.users) > 0
+}
+
+// dummyHash is compared against for unknown users so response timing
+// doesn't reveal which usernames exist.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// CheckPassword verifies a local user's password.
+func (a *Authenticator) CheckPassword(username, password string) (User, error) {
+	u, ok := a.users[username]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return User{Name: u.Username, Roles: u.Roles, Method: MethodPassword}, nil
+}
+
+// CheckToken resolves a raw bearer token to its user.
+func (a *Authenticator) CheckToken(raw string) (User, bool) {
+	sum := sha256.Sum256([]byte(raw))
+	hash := hex.EncodeToString(sum[:])
+	for stored, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			return User{Name: t.User, Roles: t.Roles, Method: MethodToken}, true
+		}
+	}
+	return User{}, false
+}
+
+// localName reports whether a local user or API token uses name.
+func (a *Authenticator) localName(name string) bool {
+	if _, ok := a.users[name]; ok {
+		return true
+	}
+	for _, t := range a.tokens {
+		if t.User == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware identifies the caller from a bearer token or session cookie and
+// stores the user in the request context. It does not reject anonymous
+// requests; handlers that need a user check UserFromContext.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			raw, ok := strings.CutPrefix(header, "Bearer ")
+			user, valid := a.CheckToken(strings.TrimSpace(raw))
+			if !ok || !valid {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="webdbreader"`)
+				http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+			return
+		}
+
+		if user, ok := a.sessions.Read(r); ok {
+			r = r.WithContext(WithUser(r.Context(), user))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type contextKey struct{}
+
+// WithUser returns a context carrying the user.
+func WithUser(ctx context.Context, u User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// UserFromContext returns the authenticated user, if any.
+func UserFromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(contextKey{}).(User)
+	return u, ok
+}
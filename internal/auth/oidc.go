@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig configures the authorization-code flow against an OpenID Connect issuer.
+type OIDCConfig struct {
+	Issuer        string   `json:"issuer"`
+	ClientID      string   `json:"clientId"`
+	ClientSecret  string   `json:"clientSecret"`
+	RedirectURL   string   `json:"redirectUrl"` // e.g. https://dbreader.example.com/auth/oidc/callback
+	Scopes        []string `json:"scopes"`      // Added to "openid"; default profile, email
+	UsernameClaim string   `json:"usernameClaim"`
+	RolesClaim    string   `json:"rolesClaim"` // Claim holding a string or string list, e.g. "groups"
+	DefaultRoles  []string `json:"defaultRoles"`
+}
+
+// OIDC runs the authorization-code flow with PKCE and verifies ID tokens.
+type OIDC struct {
+	cfg      OIDCConfig
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDC discovers the issuer's endpoints and signing keys.
+func NewOIDC(ctx context.Context, cfg OIDCConfig) (*OIDC, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc requires issuer, clientId and redirectUrl")
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+
+	return &OIDC{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// BeginOIDC stores the flow state in a short-lived cookie and returns the
+// issuer URL to redirect the browser to. next is where to land after login.
+func (a *Authenticator) BeginOIDC(w http.ResponseWriter, next string) (string, error) {
+	if a.oidc == nil {
+		return "", errors.New("oidc is not configured")
+	}
+
+	state, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err := a.sessions.issueFlow(w, flowState{State: state, Nonce: nonce, Verifier: verifier, Next: next}); err != nil {
+		return "", err
+	}
+
+	return a.oidc.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// FinishOIDC handles the issuer's callback: it checks state, exchanges the
+// code, verifies the ID token and nonce, and returns the user and next URL.
+func (a *Authenticator) FinishOIDC(ctx context.Context, w http.ResponseWriter, r *http.Request) (User, string, error) {
+	if a.oidc == nil {
+		return User{}, "", errors.New("oidc is not configured")
+	}
+
+	flow, ok := a.sessions.readFlow(w, r)
+	if !ok {
+		return User{}, "", errors.New("login session expired, please try again")
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return User{}, "", fmt.Errorf("identity provider error: %s %s", e, q.Get("error_description"))
+	}
+	if q.Get("state") != flow.State {
+		return User{}, "", errors.New("state mismatch")
+	}
+
+	token, err := a.oidc.oauth.Exchange(ctx, q.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return User{}, "", fmt.Errorf("exchange code: %w", err)
+	}
+	rawID, ok := token.Extra("id_token").(string)
+	if !ok {
+		return User{}, "", errors.New("token response has no id_token")
+	}
+
+	idToken, err := a.oidc.verifier.Verify(ctx, rawID)
+	if err != nil {
+		return User{}, "", fmt.Errorf("verify id token: %w", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return User{}, "", errors.New("nonce mismatch")
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return User{}, "", fmt.Errorf("decode claims: %w", err)
+	}
+
+	user, err := a.oidcUser(claims, idToken.Subject)
+	if err != nil {
+		return User{}, "", err
+	}
+	return user, flow.Next, nil
+}
+
+// oidcUser maps verified ID token claims onto a user. Saved queries,
+// schedules and history belong to a user by name, so an issuer account may
+// not take the name of a local user or API token user.
+func (a *Authenticator) oidcUser(claims map[string]any, subject string) (User, error) {
+	name := a.oidc.username(claims, subject)
+	if a.localName(name) {
+		return User{}, fmt.Errorf("%q is the name of a local account and can't sign in through the identity provider", name)
+	}
+	return User{
+		Name:   name,
+		Roles:  append(a.oidc.roles(claims), a.oidc.cfg.DefaultRoles...),
+		Method: MethodOIDC,
+	}, nil
+}
+
+// username picks the configured claim, then a verified email, then the subject.
+func (o *OIDC) username(claims map[string]any, subject string) string {
+	if v, ok := claims[o.cfg.UsernameClaim].(string); ok && v != "" {
+		return v
+	}
+	if v, ok := claims["email"].(string); ok && v != "" && claims["email_verified"] == true {
+		return v
+	}
+	return subject
+}
+
+func (o *OIDC) roles(claims map[string]any) []string {
+	if o.cfg.RolesClaim == "" {
+		return nil
+	}
+	switch v := claims[o.cfg.RolesClaim].(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var roles []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles
+	}
+	return nil
+}
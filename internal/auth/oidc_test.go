@@ -0,0 +1,40 @@
+package auth
+
+import "testing"
+
+func TestOIDCUser(t *testing.T) {
+	a := &Authenticator{
+		users:  map[string]LocalUser{"admin": {Username: "admin"}},
+		tokens: map[string]APIToken{"hash": {User: "ci-bot"}},
+		oidc:   &OIDC{cfg: OIDCConfig{UsernameClaim: "preferred_username", RolesClaim: "groups", DefaultRoles: []string{"viewer"}}},
+	}
+
+	tests := []struct {
+		claims map[string]any
+		want   string // "" when sign-in is refused
+	}{
+		{map[string]any{"preferred_username": "alice", "email": "alice@example.com", "email_verified": true}, "alice"},
+		{map[string]any{"email": "bob@example.com", "email_verified": true}, "bob@example.com"},
+		{map[string]any{"email": "mallory@example.com"}, "sub-123"}, // Unverified email
+		{map[string]any{}, "sub-123"},
+		{map[string]any{"preferred_username": "admin"}, ""},
+		{map[string]any{"preferred_username": "ci-bot"}, ""},
+	}
+	for _, tt := range tests {
+		u, err := a.oidcUser(tt.claims, "sub-123")
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("oidcUser(%v) = %+v, want an error", tt.claims, u)
+			}
+			continue
+		}
+		if err != nil || u.Name != tt.want || u.Method != MethodOIDC {
+			t.Errorf("oidcUser(%v) = %+v, %v; want %s", tt.claims, u, err, tt.want)
+		}
+	}
+
+	u, err := a.oidcUser(map[string]any{"preferred_username": "carol", "groups": []any{"analyst"}}, "sub-9")
+	if err != nil || len(u.Roles) != 2 || u.Roles[0] != "analyst" || u.Roles[1] != "viewer" {
+		t.Errorf("roles = %v, %v", u.Roles, err)
+	}
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookie = "wdr_session"
+	flowCookie    = "wdr_oidc"
+	flowTTL       = 10 * time.Minute
+)
+
+// Sessions issues and verifies HMAC-signed session cookies. Sessions are
+// stateless, so logging out clears the cookie and expiry bounds its lifetime.
+type Sessions struct {
+	sessionKey []byte
+	flowKey    []byte
+	ttl        time.Duration
+	secure     bool
+}
+
+type sessionPayload struct {
+	User    User  `json:"u"`
+	Expires int64 `json:"exp"`
+}
+
+// NewSessions creates a session manager. An empty secret generates a random
+// key, which invalidates sessions on restart.
+func NewSessions(secret []byte, ttl time.Duration, secure bool) (*Sessions, error) {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("generate session secret: %w", err)
+		}
+	} else if len(secret) < 32 {
+		return nil, errors.New("session secret must be at least 32 bytes")
+	}
+	return &Sessions{
+		sessionKey: deriveKey(secret, sessionCookie),
+		flowKey:    deriveKey(secret, flowCookie),
+		ttl:        ttl,
+		secure:     secure,
+	}, nil
+}
+
+// deriveKey binds a cookie's purpose into its MAC key, so a value signed for
+// one cookie never verifies as another.
+func deriveKey(secret []byte, purpose string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("webdbreader cookie: " + purpose))
+	return m.Sum(nil)
+}
+
+// Issue sets a session cookie for the user.
+func (s *Sessions) Issue(w http.ResponseWriter, u User) error {
+	if u.Name == "" {
+		return errors.New("session user has no name")
+	}
+	expires := time.Now().Add(s.ttl)
+	value, err := sign(s.sessionKey, sessionPayload{User: u, Expires: expires.Unix()})
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.cookie(sessionCookie, value, expires))
+	return nil
+}
+
+// Read returns the user from a valid, unexpired session cookie.
+func (s *Sessions) Read(r *http.Request) (User, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return User{}, false
+	}
+	var p sessionPayload
+	if !verify(s.sessionKey, c.Value, &p) || time.Now().Unix() >= p.Expires || p.User.Name == "" {
+		return User{}, false
+	}
+	return p.User, true
+}
+
+// Clear removes the session cookie.
+func (s *Sessions) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, s.cookie(sessionCookie, "", time.Unix(0, 0)))
+}
+
+// flowState carries OIDC login parameters between redirect and callback.
+type flowState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Next     string `json:"next"`
+	Expires  int64  `json:"exp"`
+}
+
+func (s *Sessions) issueFlow(w http.ResponseWriter, f flowState) error {
+	expires := time.Now().Add(flowTTL)
+	f.Expires = expires.Unix()
+	value, err := sign(s.flowKey, f)
+	if err != nil {
+		return err
+	}
+	c := s.cookie(flowCookie, value, expires)
+	c.Path = "/auth/oidc"
+	http.SetCookie(w, c)
+	return nil
+}
+
+func (s *Sessions) readFlow(w http.ResponseWriter, r *http.Request) (flowState, bool) {
+	c, err := r.Cookie(flowCookie)
+	if err != nil {
+		return flowState{}, false
+	}
+
+	// Single use: clear it whatever the outcome
+	expired := s.cookie(flowCookie, "", time.Unix(0, 0))
+	expired.Path = "/auth/oidc"
+	http.SetCookie(w, expired)
+
+	var f flowState
+	if !verify(s.flowKey, c.Value, &f) || time.Now().Unix() >= f.Expires {
+		return flowState{}, false
+	}
+	return f, true
+}
+
+func (s *Sessions) cookie(name, value string, expires time.Time) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		c.MaxAge = -1
+	}
+	return c
+}
+
+func sign(key []byte, v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac(key, payload)), nil
+}
+
+func verify(key []byte, value string, v any) bool {
+	payload, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac(key, payload)) {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+func mac(key []byte, payload string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestSessions(t *testing.T) *Sessions {
+	t.Helper()
+	s, err := NewSessions([]byte("0123456789abcdef0123456789abcdef"), time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	s := newTestSessions(t)
+	rec := httptest.NewRecorder()
+	if err := s.Issue(rec, User{Name: "alice", Roles: []string{RoleAdmin}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	u, ok := s.Read(r)
+	if !ok || u.Name != "alice" || !u.IsAdmin() {
+		t.Fatalf("Read = %+v, %v", u, ok)
+	}
+}
+
+func TestFlowCookieIsNotASession(t *testing.T) {
+	s := newTestSessions(t)
+	rec := httptest.NewRecorder()
+	if err := s.issueFlow(rec, flowState{State: "s", Nonce: "n", Verifier: "v"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var flow string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == flowCookie {
+			flow = c.Value
+		}
+	}
+	if flow == "" {
+		t.Fatal("no flow cookie issued")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: flow})
+	if u, ok := s.Read(r); ok {
+		t.Fatalf("flow cookie accepted as session: %+v", u)
+	}
+}
+
+func TestSessionRejectsEmptyName(t *testing.T) {
+	s := newTestSessions(t)
+	if err := s.Issue(httptest.NewRecorder(), User{}); err == nil {
+		t.Fatal("Issue accepted a user without a name")
+	}
+
+	value, err := sign(s.sessionKey, sessionPayload{Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	if _, ok := s.Read(r); ok {
+		t.Fatal("Read accepted a session without a user name")
+	}
+}
@@ -0,0 +1,55 @@
+package chart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AssistInstruction is the system prompt for choosing a chart with an LLM.
+const AssistInstruction = `You choose the chart that best shows a SQL query result. You are given the query, optionally the question it answers, the number of rows, and each column's name, database type, kind (temporal, quantitative or nominal) and number of distinct values. You are not given the values.
+
+Respond with only a JSON object, without markdown:
+{"mark": "bar|line|area|point|arc", "x": "<column>", "y": ["<quantitative column>", ...], "color": "<column or empty>", "reason": "<one short sentence>"}
+
+- x is the column on the horizontal axis, or the category of an arc (pie) chart.
+- y lists the measures to plot; leave it empty to count rows per x value, or to show the distribution of a quantitative x.
+- color optionally splits a single measure into series by a column with few distinct values.
+- Prefer line for trends over time, bar to compare categories, point to relate two measures, arc only for a few parts of a whole.
+- Use only the column names given.`
+
+// AssistPrompt renders the user prompt asking an LLM to choose among the
+// columns. Only column metadata is included, never result values.
+func AssistPrompt(question, sql string, columns []Column, rows int) (string, error) {
+	data, err := json.Marshal(struct {
+		Question string   `json:"question,omitempty"`
+		SQL      string   `json:"sql"`
+		Rows     int      `json:"rows"`
+		Columns  []Column `json:"columns"`
+	}{question, sql, rows, columns})
+	if err != nil {
+		return "", fmt.Errorf("encode columns: %w", err)
+	}
+	return "Choose a chart for this query result.\n\n" + string(data), nil
+}
+
+// ParseChoice reads an LLM's choice, dropping any prose around the JSON
+// object, and checks it against the columns.
+func ParseChoice(text string, columns []Column) (Choice, string, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return Choice{}, "", errors.New("no JSON object in the answer")
+	}
+	var ans struct {
+		Choice
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &ans); err != nil {
+		return Choice{}, "", fmt.Errorf("decode answer: %w", err)
+	}
+	if err := Validate(ans.Choice, columns); err != nil {
+		return Choice{}, "", err
+	}
+	return ans.Choice, strings.TrimSpace(ans.Reason), nil
+}
@@ -0,0 +1,343 @@
+// Package chart recommends a chart for a query result and describes it as a
+// Vega-Lite spec.
+//
+// Columns are classified as temporal, quantitative or nominal from their
+// database types and values, then simple rules pick the chart: time and a
+// number make a line, a category and a number a bar, two numbers a scatter
+// plot, one number a histogram. Results the rules can't settle, e.g. with
+// several candidate measures, are marked ambiguous so a caller may ask an
+// LLM to choose among the columns instead.
+package chart
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Vega-Lite spec details.
+const (
+	SchemaURL = "https://vega.github.io/schema/vega-lite/v5.json"
+	DataName  = "result" // Named dataset the spec reads; fill it with the result rows as objects
+)
+
+const (
+	maxBars     = 50 // Most categories a bar chart shows
+	maxColors   = 10 // Most categories a color encoding shows
+	chartHeight = 300
+)
+
+// Kind is a column's Vega-Lite measurement type.
+type Kind string
+
+const (
+	Temporal     Kind = "temporal"
+	Quantitative Kind = "quantitative"
+	Nominal      Kind = "nominal"
+)
+
+// Column is what the rules know about a result column.
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"` // Database type name, when the driver reports it
+	Kind     Kind   `json:"kind"`
+	Distinct int    `json:"distinct"`
+	Nulls    int    `json:"nulls,omitempty"`
+}
+
+// Choice is a chart in terms of columns, the rules' or the LLM's pick.
+type Choice struct {
+	Mark  string   `json:"mark"`            // bar, line, area, point or arc
+	X     string   `json:"x,omitempty"`     // Column on the x axis (the category of an arc)
+	Y     []string `json:"y,omitempty"`     // Measures; several are drawn as one series each
+	Color string   `json:"color,omitempty"` // Column splitting the data into series
+}
+
+// Recommendation is a recommended chart.
+type Recommendation struct {
+	Choice
+	Reason    string         `json:"reason"`           // Why this chart, in a sentence
+	Ambiguous bool           `json:"ambiguous"`        // Other charts would fit about as well
+	Source    string         `json:"source"`           // "rules" or "llm"
+	Spec      map[string]any `json:"spec"`             // Vega-Lite spec reading the DataName dataset
+	Columns   []Column       `json:"columns"`          // How the columns were classified
+	Tokens    int            `json:"tokens,omitempty"` // Spent by the LLM, if it chose
+}
+
+// Analyze classifies the columns of a result. types may be nil; rows hold
+// JSON-friendly values.
+func Analyze(names, types []string, rows [][]any) []Column {
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		c := Column{Name: name}
+		if i < len(types) {
+			c.Type = strings.ToLower(types[i])
+		}
+		seen := make(map[string]bool)
+		numeric, temporal := true, true
+		for _, row := range rows {
+			if i >= len(row) || row[i] == nil {
+				c.Nulls++
+				continue
+			}
+			v := row[i]
+			seen[fmt.Sprint(v)] = true
+			numeric = numeric && isNumber(v, c.Type)
+			temporal = temporal && isTime(v)
+		}
+		c.Distinct = len(seen)
+
+		switch {
+		case temporalType(c.Type) || (temporal && c.Distinct > 0 && !numeric):
+			c.Kind = Temporal
+		case numeric && c.Distinct > 0 && !identifier(name):
+			c.Kind = Quantitative
+		default:
+			c.Kind = Nominal
+		}
+		columns[i] = c
+	}
+	return columns
+}
+
+func isNumber(v any, dbType string) bool {
+	switch n := v.(type) {
+	case int64, int32, int, float32:
+		return true
+	case float64:
+		return !math.IsNaN(n) && !math.IsInf(n, 0)
+	case string:
+		if !numericType(dbType) {
+			return false
+		}
+		_, err := strconv.ParseFloat(n, 64)
+		return err == nil
+	}
+	return false
+}
+
+func numericType(t string) bool {
+	for _, s := range []string{"int", "numeric", "decimal", "real", "float", "double", "money"} {
+		if strings.Contains(t, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func temporalType(t string) bool {
+	return strings.Contains(t, "date") || strings.Contains(t, "time")
+}
+
+// timeLayouts are the formats a text value is taken as a time in.
+var timeLayouts = []string{time.RFC3339Nano, time.DateTime, time.DateOnly, "2006-01"}
+
+func isTime(v any) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	for _, layout := range timeLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// identifier reports whether a column name looks like a key, whose numbers
+// aren't worth plotting.
+func identifier(name string) bool {
+	n := strings.ToLower(name)
+	return n == "id" || strings.HasSuffix(n, "_id")
+}
+
+// Recommend picks a chart by the rules. It returns nil when the result is
+// better read as a table: no rows, a single value, or nothing to plot.
+func Recommend(columns []Column, rows int) *Recommendation {
+	if rows == 0 || len(columns) == 0 {
+		return nil
+	}
+	var temporal, quant, nominal []Column
+	for _, c := range columns {
+		switch c.Kind {
+		case Temporal:
+			temporal = append(temporal, c)
+		case Quantitative:
+			quant = append(quant, c)
+		default:
+			nominal = append(nominal, c)
+		}
+	}
+	// A category low enough in cardinality to color series by
+	var color string
+	if len(nominal) > 0 && nominal[0].Distinct <= maxColors {
+		color = nominal[0].Name
+	}
+
+	rec := &Recommendation{Source: "rules", Columns: columns}
+	switch {
+	case len(temporal) > 0 && len(quant) > 0 && rows > 1:
+		rec.Choice = Choice{Mark: "line", X: temporal[0].Name, Y: names(quant)}
+		rec.Reason = fmt.Sprintf("%s is a time and %s a measure", temporal[0].Name, quant[0].Name)
+		if len(quant) == 1 {
+			rec.Color = color
+		}
+		rec.Ambiguous = len(temporal) > 1 || (len(quant) == 1 && len(nominal) > 0 && color == "")
+
+	case len(nominal) > 0 && len(quant) > 0:
+		x := nominal[0]
+		rec.Choice = Choice{Mark: "bar", X: x.Name, Y: names(quant[:1])}
+		rec.Reason = fmt.Sprintf("%s is a category and %s a measure", x.Name, quant[0].Name)
+		if len(nominal) > 1 && nominal[1].Distinct <= maxColors {
+			rec.Color = nominal[1].Name
+		}
+		rec.Ambiguous = len(quant) > 1 || len(nominal) > 2 || x.Distinct > maxBars
+
+	case len(quant) >= 2:
+		rec.Choice = Choice{Mark: "point", X: quant[0].Name, Y: names(quant[1:2]), Color: color}
+		rec.Reason = fmt.Sprintf("%s and %s are both measures", quant[0].Name, quant[1].Name)
+		rec.Ambiguous = len(quant) > 2
+
+	case len(quant) == 1 && rows > 1:
+		rec.Choice = Choice{Mark: "bar", X: quant[0].Name}
+		rec.Reason = fmt.Sprintf("%s is the only measure, so its distribution is shown", quant[0].Name)
+		rec.Ambiguous = len(temporal) > 0
+
+	case len(nominal) > 0 && rows > 1 && nominal[0].Distinct < rows:
+		rec.Choice = Choice{Mark: "bar", X: nominal[0].Name}
+		rec.Reason = fmt.Sprintf("%s is a category, so rows are counted per value", nominal[0].Name)
+		rec.Ambiguous = len(nominal) > 1 || nominal[0].Distinct > maxBars
+
+	default:
+		return nil
+	}
+
+	rec.Spec = Spec(rec.Choice, columns)
+	return rec
+}
+
+func names(columns []Column) []string {
+	out := make([]string, len(columns))
+	for i, c := range columns {
+		out[i] = c.Name
+	}
+	return out
+}
+
+// Validate checks that a choice only names known columns and marks.
+func Validate(ch Choice, columns []Column) error {
+	if !slices.Contains([]string{"bar", "line", "area", "point", "arc"}, ch.Mark) {
+		return fmt.Errorf("unknown mark %q", ch.Mark)
+	}
+	if ch.X == "" {
+		return errors.New("x is required")
+	}
+	for _, name := range append([]string{ch.X, ch.Color}, ch.Y...) {
+		if name != "" && column(columns, name) == nil {
+			return fmt.Errorf("unknown column %q", name)
+		}
+	}
+	for _, y := range ch.Y {
+		if column(columns, y).Kind != Quantitative {
+			return fmt.Errorf("y column %q is not numeric", y)
+		}
+	}
+	return nil
+}
+
+func column(columns []Column, name string) *Column {
+	for i := range columns {
+		if columns[i].Name == name {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// Spec builds the Vega-Lite spec of a valid choice. Without Y the rows are
+// counted, or binned when X is a measure.
+func Spec(ch Choice, columns []Column) map[string]any {
+	x := column(columns, ch.X)
+	encoding := map[string]any{}
+	spec := map[string]any{
+		"$schema":  SchemaURL,
+		"data":     map[string]any{"name": DataName},
+		"mark":     map[string]any{"type": ch.Mark, "tooltip": true},
+		"width":    "container",
+		"height":   chartHeight,
+		"encoding": encoding,
+	}
+	if ch.Mark == "line" || ch.Mark == "area" {
+		spec["mark"].(map[string]any)["point"] = true
+	}
+
+	y := map[string]any{"field": "value", "type": "quantitative"}
+	switch len(ch.Y) {
+	case 0:
+		y = map[string]any{"aggregate": "count", "type": "quantitative", "title": "rows"}
+	case 1:
+		y = map[string]any{"field": field(ch.Y[0]), "type": "quantitative", "title": ch.Y[0]}
+	default:
+		// One series per measure
+		spec["transform"] = []any{map[string]any{"fold": fields(ch.Y), "as": []string{"measure", "value"}}}
+		encoding["color"] = map[string]any{"field": "measure", "type": "nominal"}
+	}
+
+	if ch.Mark == "arc" {
+		encoding["theta"] = y
+		encoding["color"] = map[string]any{"field": field(x.Name), "type": "nominal", "title": x.Name}
+		return spec
+	}
+
+	xEnc := map[string]any{"field": field(x.Name), "type": string(x.Kind), "title": x.Name}
+	switch {
+	case x.Kind == Quantitative && len(ch.Y) == 0 && ch.Mark == "bar":
+		xEnc["bin"] = true
+	case x.Kind == Nominal && ch.Mark == "bar":
+		xEnc["sort"] = "-y"
+		if x.Distinct > maxBars {
+			// Only the largest bars
+			spec["transform"] = append(anySlice(spec["transform"]),
+				map[string]any{"window": []any{map[string]any{"op": "rank", "as": "rank"}}, "sort": []any{map[string]any{"field": yField(ch), "order": "descending"}}},
+				map[string]any{"filter": fmt.Sprintf("datum.rank <= %d", maxBars)},
+			)
+		}
+	}
+	encoding["x"] = xEnc
+	encoding["y"] = y
+	if ch.Color != "" && len(ch.Y) <= 1 {
+		encoding["color"] = map[string]any{"field": field(ch.Color), "type": "nominal", "title": ch.Color}
+	}
+	return spec
+}
+
+func yField(ch Choice) string {
+	if len(ch.Y) == 0 {
+		return field(ch.X)
+	}
+	return field(ch.Y[0])
+}
+
+func anySlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
+
+// field escapes a column name for a Vega-Lite field, where dots and
+// brackets would otherwise reach into nested objects.
+func field(name string) string {
+	return strings.NewReplacer(`\`, `\\`, ".", `\.`, "[", `\[`, "]", `\]`).Replace(name)
+}
+
+func fields(names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		out[i] = field(n)
+	}
+	return out
+}
@@ -0,0 +1,343 @@
+// Package eval measures how well natural language to SQL generation works on
+// a suite of questions with known answers.
+//
+// Each case gives the expected answer as SQL, as literal rows, or as a
+// MISSING response for questions the schema can't answer. Generated and
+// expected SQL are both executed and their result sets compared as multisets:
+// row order never matters, and when the columns don't line up a second pass
+// ignores column order too, so SELECT a, b matches SELECT b, a.
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Case statuses.
+const (
+	StatusCorrect = "correct" // Results match, or MISSING was expected and given
+	StatusWrong   = "wrong"   // Valid SQL with different results, or SQL where MISSING was expected
+	StatusMissing = "missing" // MISSING where an answer was expected
+	StatusInvalid = "invalid" // Generated SQL was rejected or failed to run
+	StatusError   = "error"   // The LLM call or the expected SQL failed
+)
+
+// maxDiffRows bounds the rows listed in each side of a diff.
+const maxDiffRows = 10
+
+// Suite is the on-disk test suite (YAML or JSON).
+type Suite struct {
+	Source string `yaml:"source"` // Data source for cases that don't name one
+	Cases  []Case `yaml:"cases"`
+}
+
+// Case is one question with its expected answer. Exactly one of ExpectedSQL,
+// ExpectedRows and ExpectMissing is set.
+type Case struct {
+	ID            string  `yaml:"id"`
+	Question      string  `yaml:"question"`
+	Source        string  `yaml:"source"`
+	ExpectedSQL   string  `yaml:"expectedSql"`
+	ExpectedRows  [][]any `yaml:"expectedRows"`
+	ExpectMissing bool    `yaml:"expectMissing"`
+}
+
+// LoadSuite reads and checks a suite file.
+func LoadSuite(path string) (Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Suite{}, fmt.Errorf("read suite: %w", err)
+	}
+	var s Suite
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return Suite{}, fmt.Errorf("parse suite: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("case-%d", i+1)
+		}
+		if seen[c.ID] {
+			return Suite{}, fmt.Errorf("duplicate case id %q", c.ID)
+		}
+		seen[c.ID] = true
+		if strings.TrimSpace(c.Question) == "" {
+			return Suite{}, fmt.Errorf("case %s: question is required", c.ID)
+		}
+		expectations := 0
+		for _, set := range []bool{c.ExpectedSQL != "", c.ExpectedRows != nil, c.ExpectMissing} {
+			if set {
+				expectations++
+			}
+		}
+		if expectations != 1 {
+			return Suite{}, fmt.Errorf("case %s: set exactly one of expectedSql, expectedRows and expectMissing", c.ID)
+		}
+		if c.Source == "" {
+			c.Source = s.Source
+		}
+	}
+	return s, nil
+}
+
+// Filter keeps the cases whose ID matches pattern.
+func (s Suite) Filter(pattern string) (Suite, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Suite{}, err
+	}
+	out := Suite{Source: s.Source}
+	for _, c := range s.Cases {
+		if re.MatchString(c.ID) {
+			out.Cases = append(out.Cases, c)
+		}
+	}
+	return out, nil
+}
+
+// Generation is the outcome of asking the LLM one question.
+type Generation struct {
+	SQL           string // Generated SQL, valid or not
+	Invalid       string // Why the SQL was rejected; empty when it passed validation
+	Missing       string // MISSING explanation
+	Tokens        int
+	PromptVersion string
+}
+
+// Result is an executed query's output.
+type Result struct {
+	Columns []string
+	Rows    [][]any
+}
+
+// Runner runs a suite. Generate asks the LLM; Execute runs SQL read-only.
+type Runner struct {
+	Generate func(ctx context.Context, source, question string) (Generation, error)
+	Execute  func(ctx context.Context, source, sql string) (Result, error)
+}
+
+// Run evaluates every case in order.
+func (r Runner) Run(ctx context.Context, s Suite) Report {
+	rep := Report{Started: time.Now().UTC()}
+	for _, c := range s.Cases {
+		start := time.Now()
+		res := r.runCase(ctx, c)
+		res.DurationMs = time.Since(start).Milliseconds()
+		rep.Cases = append(rep.Cases, res)
+	}
+	rep.Duration = time.Since(rep.Started).Round(time.Millisecond).String()
+	rep.Summary = summarize(rep.Cases)
+	return rep
+}
+
+func (r Runner) runCase(ctx context.Context, c Case) CaseResult {
+	res := CaseResult{
+		ID:          c.ID,
+		Question:    c.Question,
+		Source:      c.Source,
+		ExpectedSQL: c.ExpectedSQL,
+	}
+
+	gen, err := r.Generate(ctx, c.Source, c.Question)
+	res.GeneratedSQL = gen.SQL
+	res.Missing = gen.Missing
+	res.Tokens = gen.Tokens
+	res.PromptVersion = gen.PromptVersion
+	switch {
+	case err != nil:
+		res.Status, res.Error = StatusError, "generate: "+err.Error()
+		return res
+	case gen.Missing != "" && gen.SQL == "":
+		res.Status = StatusMissing
+		if c.ExpectMissing {
+			res.Status = StatusCorrect
+		}
+		return res
+	case c.ExpectMissing:
+		res.Status, res.Error = StatusWrong, "expected MISSING"
+		return res
+	case gen.Invalid != "":
+		res.Status, res.Error = StatusInvalid, gen.Invalid
+		return res
+	}
+
+	actual, err := r.Execute(ctx, c.Source, gen.SQL)
+	if err != nil {
+		res.Status, res.Error = StatusInvalid, err.Error()
+		return res
+	}
+	res.Valid = true
+
+	expected := Result{Rows: c.ExpectedRows}
+	if c.ExpectedSQL != "" {
+		if expected, err = r.Execute(ctx, c.Source, c.ExpectedSQL); err != nil {
+			res.Status, res.Error = StatusError, "expected SQL: "+err.Error()
+			return res
+		}
+	}
+
+	res.Diff = Compare(expected.Rows, actual.Rows)
+	if res.Diff == nil {
+		res.Status = StatusCorrect
+		return res
+	}
+	res.Status = StatusWrong
+	// Prefer the column counts of the queries themselves, which empty results don't show
+	if expected.Columns != nil {
+		res.Diff.ExpectedColumns = len(expected.Columns)
+	}
+	res.Diff.ActualColumns = len(actual.Columns)
+	return res
+}
+
+// Diff describes how two result sets differ.
+type Diff struct {
+	ExpectedColumns int      `json:"expectedColumns"`
+	ActualColumns   int      `json:"actualColumns"`
+	ExpectedRows    int      `json:"expectedRows"`
+	ActualRows      int      `json:"actualRows"`
+	MissingRows     []string `json:"missingRows,omitempty"` // Expected but not returned
+	ExtraRows       []string `json:"extraRows,omitempty"`   // Returned but not expected
+}
+
+// Compare returns nil when the result sets hold the same rows in any order,
+// with columns in the same or any order, and otherwise how they differ.
+func Compare(expected, actual [][]any) *Diff {
+	exp, act := rowKeys(expected, false), rowKeys(actual, false)
+	if sameMultiset(exp, act) {
+		return nil
+	}
+	if width(expected) == width(actual) && sameMultiset(rowKeys(expected, true), rowKeys(actual, true)) {
+		return nil
+	}
+
+	d := &Diff{
+		ExpectedColumns: width(expected),
+		ActualColumns:   width(actual),
+		ExpectedRows:    len(expected),
+		ActualRows:      len(actual),
+	}
+	d.MissingRows = subtract(exp, act)
+	d.ExtraRows = subtract(act, exp)
+	return d
+}
+
+func width(rows [][]any) int {
+	if len(rows) == 0 {
+		return 0
+	}
+	return len(rows[0])
+}
+
+// rowKeys renders each row as a comparable string. With sortCells the cells
+// are sorted first, to ignore column order.
+func rowKeys(rows [][]any, sortCells bool) []string {
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, v := range row {
+			cells[j] = normalize(v)
+		}
+		if sortCells {
+			slices.Sort(cells)
+		}
+		keys[i] = "(" + strings.Join(cells, ", ") + ")"
+	}
+	return keys
+}
+
+func sameMultiset(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// subtract returns up to maxDiffRows keys of a not matched in b.
+func subtract(a, b []string) []string {
+	remaining := make(map[string]int)
+	for _, k := range b {
+		remaining[k]++
+	}
+	var out []string
+	for _, k := range a {
+		if remaining[k] > 0 {
+			remaining[k]--
+			continue
+		}
+		if len(out) == maxDiffRows {
+			out = append(out, "...")
+			break
+		}
+		out = append(out, k)
+	}
+	return out
+}
+
+// normalize renders a value so that equal values from different drivers and
+// from YAML compare equal: numbers (including numeric strings such as
+// NUMERIC columns) are rounded to 9 significant digits, and midnight UTC
+// timestamps become dates.
+func normalize(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(val)
+	case int:
+		return formatNumber(float64(val))
+	case int64:
+		return formatNumber(float64(val))
+	case uint64:
+		return formatNumber(float64(val))
+	case float32:
+		return formatNumber(float64(val))
+	case float64:
+		return formatNumber(val)
+	case []byte:
+		return normalize(string(val))
+	case time.Time:
+		return formatTime(val)
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return formatNumber(f)
+		}
+		for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+			if t, err := time.Parse(layout, val); err == nil {
+				return formatTime(t)
+			}
+		}
+		return strconv.Quote(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func formatNumber(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatFloat(f, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(f, 'g', 9, 64)
+}
+
+func formatTime(t time.Time) string {
+	t = t.UTC()
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,148 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of a run.
+type Report struct {
+	Suite    string       `json:"suite"`
+	Provider string       `json:"provider"`
+	Model    string       `json:"model,omitempty"`
+	Started  time.Time    `json:"started"`
+	Duration string       `json:"duration"`
+	Summary  Summary      `json:"summary"`
+	Cases    []CaseResult `json:"cases"`
+}
+
+// Summary aggregates the case results. Rates are fractions between 0 and 1.
+type Summary struct {
+	Cases             int     `json:"cases"`
+	Correct           int     `json:"correct"`
+	Wrong             int     `json:"wrong"`
+	Missing           int     `json:"missing"`
+	Invalid           int     `json:"invalid"`
+	Errors            int     `json:"errors"`
+	ExecutionAccuracy float64 `json:"executionAccuracy"` // Correct / cases
+	ValidityRate      float64 `json:"validityRate"`      // SQL that passed validation and ran / SQL generated
+	MissingRate       float64 `json:"missingRate"`       // MISSING responses / cases
+	Tokens            int     `json:"tokens"`
+}
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	ID            string `json:"id"`
+	Question      string `json:"question"`
+	Source        string `json:"source,omitempty"`
+	Status        string `json:"status"`
+	GeneratedSQL  string `json:"generatedSql,omitempty"`
+	ExpectedSQL   string `json:"expectedSql,omitempty"`
+	Missing       string `json:"missing,omitempty"`
+	Valid         bool   `json:"valid"` // Generated SQL passed validation and ran
+	Error         string `json:"error,omitempty"`
+	Diff          *Diff  `json:"diff,omitempty"`
+	Tokens        int    `json:"tokens"`
+	PromptVersion string `json:"promptVersion,omitempty"`
+	DurationMs    int64  `json:"durationMs"`
+}
+
+func summarize(cases []CaseResult) Summary {
+	s := Summary{Cases: len(cases)}
+	generated := 0
+	valid := 0
+	for _, c := range cases {
+		s.Tokens += c.Tokens
+		if c.Missing != "" && c.GeneratedSQL == "" {
+			s.Missing++
+		} else if c.GeneratedSQL != "" {
+			generated++
+		}
+		if c.Valid {
+			valid++
+		}
+		switch c.Status {
+		case StatusCorrect:
+			s.Correct++
+		case StatusWrong:
+			s.Wrong++
+		case StatusInvalid:
+			s.Invalid++
+		case StatusError:
+			s.Errors++
+		}
+	}
+	if s.Cases > 0 {
+		s.ExecutionAccuracy = float64(s.Correct) / float64(s.Cases)
+		s.MissingRate = float64(s.Missing) / float64(s.Cases)
+	}
+	if generated > 0 {
+		s.ValidityRate = float64(valid) / float64(generated)
+	}
+	return s
+}
+
+// Markdown renders the report for humans: the summary, a table of cases and
+// the details of every case that wasn't correct.
+func (r Report) Markdown() string {
+	var sb strings.Builder
+	s := r.Summary
+
+	fmt.Fprintf(&sb, "# NL→SQL evaluation: %s\n\n", r.Suite)
+	model := r.Provider
+	if r.Model != "" {
+		model += " / " + r.Model
+	}
+	fmt.Fprintf(&sb, "%s, %s, took %s\n\n", model, r.Started.Format(time.RFC3339), r.Duration)
+
+	sb.WriteString("| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&sb, "| Execution accuracy | %.1f%% (%d/%d) |\n", 100*s.ExecutionAccuracy, s.Correct, s.Cases)
+	fmt.Fprintf(&sb, "| Validity rate | %.1f%% |\n", 100*s.ValidityRate)
+	fmt.Fprintf(&sb, "| MISSING rate | %.1f%% (%d) |\n", 100*s.MissingRate, s.Missing)
+	fmt.Fprintf(&sb, "| Wrong / invalid / errors | %d / %d / %d |\n", s.Wrong, s.Invalid, s.Errors)
+	fmt.Fprintf(&sb, "| Tokens | %d |\n\n", s.Tokens)
+
+	sb.WriteString("| Case | Status | Tokens | ms |\n|---|---|---|---|\n")
+	for _, c := range r.Cases {
+		fmt.Fprintf(&sb, "| %s | %s | %d | %d |\n", mdCell(c.ID), c.Status, c.Tokens, c.DurationMs)
+	}
+
+	for _, c := range r.Cases {
+		if c.Status == StatusCorrect {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n## %s: %s\n\n%s\n", c.ID, c.Status, c.Question)
+		if c.Error != "" {
+			fmt.Fprintf(&sb, "\n**Error:** %s\n", c.Error)
+		}
+		if c.Missing != "" {
+			fmt.Fprintf(&sb, "\n**MISSING:** %s\n", c.Missing)
+		}
+		if c.GeneratedSQL != "" {
+			fmt.Fprintf(&sb, "\nGenerated:\n\n```sql\n%s\n```\n", strings.TrimSpace(c.GeneratedSQL))
+		}
+		if c.ExpectedSQL != "" {
+			fmt.Fprintf(&sb, "\nExpected:\n\n```sql\n%s\n```\n", strings.TrimSpace(c.ExpectedSQL))
+		}
+		if d := c.Diff; d != nil {
+			fmt.Fprintf(&sb, "\nExpected %d rows × %d columns, got %d × %d.\n",
+				d.ExpectedRows, d.ExpectedColumns, d.ActualRows, d.ActualColumns)
+			if len(d.MissingRows) > 0 || len(d.ExtraRows) > 0 {
+				sb.WriteString("\n```diff\n")
+				for _, row := range d.MissingRows {
+					sb.WriteString("- " + row + "\n")
+				}
+				for _, row := range d.ExtraRows {
+					sb.WriteString("+ " + row + "\n")
+				}
+				sb.WriteString("```\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+func mdCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,264 @@
+// Package gencache caches SQL generations so repeated questions don't pay
+// for another LLM call.
+//
+// Entries are keyed by what the answer depends on besides the prompt: the
+// source, the model and the schema's fingerprint. Within a key, a prompt
+// matches an entry exactly after normalization, or as a near duplicate when
+// the two prompts' word sets are similar enough and neither names a value:
+// "revenue for Acme" must never be answered with SQL filtered to Globex.
+package gencache
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Key identifies what an answer was generated against.
+type Key struct {
+	Source      string
+	Model       string
+	Fingerprint string // Of the source's schema
+	Context     string // Anything else the answer depends on, e.g. the caller's view of the schema
+}
+
+// Hit is a cached answer.
+type Hit[V any] struct {
+	Value      V
+	Prompt     string    // Prompt the answer was generated for
+	Exact      bool      // The prompts are the same after normalization
+	Similarity float64   // Of the prompts' word sets, 0 to 1
+	Created    time.Time // When it was generated
+}
+
+type entry[V any] struct {
+	key     Key
+	prompt  string
+	norm    string
+	words   map[string]bool
+	value   V
+	created time.Time
+
+	specific bool // The prompt names a value, so only an exact match may reuse the answer
+}
+
+// Cache is an in-memory generation cache, safe for concurrent use.
+type Cache[V any] struct {
+	ttl        time.Duration
+	similarity float64 // Minimum for a near-duplicate match; above 1 disables them
+	maxEntries int
+
+	mu      sync.Mutex
+	entries []*entry[V] // Oldest first
+	exact   map[string]*entry[V]
+}
+
+// New creates a cache. Entries expire after ttl; once maxEntries are held the
+// oldest is dropped. similarity is the least word-set similarity (0 to 1) for
+// a near-duplicate match; 1 allows only exact ones.
+func New[V any](ttl time.Duration, similarity float64, maxEntries int) *Cache[V] {
+	if similarity >= 1 {
+		similarity = 1.1
+	}
+	return &Cache[V]{
+		ttl:        ttl,
+		similarity: similarity,
+		maxEntries: maxEntries,
+		exact:      make(map[string]*entry[V]),
+	}
+}
+
+func exactKey(k Key, norm string) string {
+	return strings.Join([]string{k.Source, k.Model, k.Fingerprint, k.Context, norm}, "\x00")
+}
+
+// Get looks up an answer for prompt, preferring an exact match and otherwise
+// the most similar near duplicate. A prompt that names a value only matches
+// exactly.
+func (c *Cache[V]) Get(key Key, prompt string, now time.Time) (Hit[V], bool) {
+	norm := Normalize(prompt)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+
+	if e, ok := c.exact[exactKey(key, norm)]; ok {
+		return Hit[V]{Value: e.value, Prompt: e.prompt, Exact: true, Similarity: 1, Created: e.created}, true
+	}
+
+	if namesValue(prompt) {
+		return Hit[V]{}, false
+	}
+	words := wordSet(norm)
+	var best *entry[V]
+	bestScore := 0.0
+	for _, e := range c.entries {
+		if e.key != key || e.specific {
+			continue
+		}
+		if score := jaccard(words, e.words); score >= c.similarity && score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	if best == nil {
+		return Hit[V]{}, false
+	}
+	return Hit[V]{Value: best.value, Prompt: best.prompt, Similarity: bestScore, Created: best.created}, true
+}
+
+// Put stores an answer, replacing any for the same normalized prompt.
+// literals are the values the answer filters on, e.g. the string literals of
+// generated SQL; when the prompt mentions one, the answer is only reused for
+// the same prompt.
+func (c *Cache[V]) Put(key Key, prompt string, value V, literals []string, now time.Time) {
+	norm := Normalize(prompt)
+	if norm == "" {
+		return
+	}
+	e := &entry[V]{key: key, prompt: prompt, norm: norm, words: wordSet(norm), value: value, created: now}
+	e.specific = namesValue(prompt) || mentionsAny(e.words, literals)
+	ek := exactKey(key, norm)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+
+	if old, ok := c.exact[ek]; ok {
+		c.remove(old)
+	}
+	for c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.remove(c.entries[0])
+	}
+	c.entries = append(c.entries, e)
+	c.exact[ek] = e
+}
+
+// Invalidate drops a source's entries generated against any schema other
+// than fingerprint, and returns how many it dropped.
+func (c *Cache[V]) Invalidate(source, fingerprint string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kept := c.entries[:0]
+	dropped := 0
+	for _, e := range c.entries {
+		if e.key.Source == source && e.key.Fingerprint != fingerprint {
+			delete(c.exact, exactKey(e.key, e.norm))
+			dropped++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	clear(c.entries[len(kept):])
+	c.entries = kept
+	return dropped
+}
+
+// Len returns the number of entries held, expired ones included.
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// expire drops entries older than the TTL. Callers hold mu.
+func (c *Cache[V]) expire(now time.Time) {
+	for len(c.entries) > 0 && now.Sub(c.entries[0].created) >= c.ttl {
+		c.remove(c.entries[0])
+	}
+}
+
+// remove drops an entry. Callers hold mu.
+func (c *Cache[V]) remove(e *entry[V]) {
+	for i, x := range c.entries {
+		if x == e {
+			c.entries = append(c.entries[:i], c.entries[i+1:]...)
+			break
+		}
+	}
+	if c.exact[exactKey(e.key, e.norm)] == e {
+		delete(c.exact, exactKey(e.key, e.norm))
+	}
+}
+
+// fillers are words that don't change what a question asks for.
+var fillers = map[string]bool{
+	"a": true, "an": true, "the": true, "please": true, "me": true, "show": true,
+	"give": true, "list": true, "get": true, "find": true, "what": true, "whats": true,
+	"is": true, "are": true, "can": true, "you": true, "i": true, "want": true, "need": true,
+	"for": true, "of": true, "all": true, "our": true, "my": true,
+}
+
+// Normalize lowercases a prompt, drops punctuation and collapses whitespace.
+func Normalize(prompt string) string {
+	fields := strings.FieldsFunc(strings.ToLower(prompt), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.'
+	})
+	for i, f := range fields {
+		fields[i] = strings.Trim(f, ".")
+	}
+	return strings.Join(strings.Fields(strings.Join(fields, " ")), " ")
+}
+
+// wordSet returns the words of a normalized prompt, without fillers.
+func wordSet(norm string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(norm) {
+		if !fillers[w] {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// jaccard is the Jaccard similarity of two word sets: the words they
+// share over the words either has.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// namesValue reports whether a prompt visibly names a value: a number,
+// quoted text, an email address or a capitalized word after the first, as in
+// "top 10 customers", "orders from 'ACME'" or "revenue for Acme".
+func namesValue(prompt string) bool {
+	if strings.ContainsRune(prompt, '@') || strings.IndexFunc(prompt, unicode.IsDigit) >= 0 {
+		return true
+	}
+	runes := []rune(prompt)
+	for i, r := range runes {
+		// A quote, unless it's an apostrophe as in "customer's"
+		if strings.ContainsRune("'\"`\u2018\u2019\u201c\u201d", r) &&
+			(i == 0 || i == len(runes)-1 || !unicode.IsLetter(runes[i-1]) || !unicode.IsLetter(runes[i+1])) {
+			return true
+		}
+	}
+	for i, f := range strings.Fields(prompt) {
+		if r, _ := utf8.DecodeRuneInString(f); i > 0 && unicode.IsUpper(r) && f != "I" {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionsAny reports whether any word appears in one of the literals.
+func mentionsAny(words map[string]bool, literals []string) bool {
+	for _, lit := range literals {
+		lit = strings.ToLower(lit)
+		for w := range words {
+			if strings.Contains(lit, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package gencache
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	t0  = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	key = Key{Source: "default", Model: "openai/gpt-4o", Fingerprint: "v1", Context: "all"}
+)
+
+func TestExactMatchAndTTL(t *testing.T) {
+	c := New[string](time.Hour, 1, 0)
+	c.Put(key, "Show me the revenue by month!", "SELECT 1", nil, t0)
+
+	hit, ok := c.Get(key, "  show me THE revenue by month ", t0.Add(59*time.Minute))
+	if !ok || !hit.Exact || hit.Value != "SELECT 1" || !hit.Created.Equal(t0) {
+		t.Fatalf("Get = %+v, %v; want an exact hit", hit, ok)
+	}
+	if _, ok := c.Get(key, "show me the revenue by month", t0.Add(time.Hour)); ok {
+		t.Error("hit after the TTL")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Len = %d after expiry, want 0", c.Len())
+	}
+}
+
+func TestKeyScopesEntries(t *testing.T) {
+	c := New[string](time.Hour, 0.5, 0)
+	c.Put(key, "revenue by month", "SELECT 1", nil, t0)
+
+	for _, k := range []Key{
+		{Source: "other", Model: key.Model, Fingerprint: key.Fingerprint, Context: key.Context},
+		{Source: key.Source, Model: "anthropic/claude", Fingerprint: key.Fingerprint, Context: key.Context},
+		{Source: key.Source, Model: key.Model, Fingerprint: "v2", Context: key.Context},
+		{Source: key.Source, Model: key.Model, Fingerprint: key.Fingerprint, Context: "restricted"},
+	} {
+		if _, ok := c.Get(k, "revenue by month", t0); ok {
+			t.Errorf("hit under %+v", k)
+		}
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	c := New[string](time.Hour, 1, 0)
+	c.Put(key, "revenue by month", "SELECT 1", nil, t0)
+	other := key
+	other.Source = "warehouse"
+	c.Put(other, "revenue by month", "SELECT 2", nil, t0)
+
+	if n := c.Invalidate(key.Source, key.Fingerprint); n != 0 {
+		t.Errorf("Invalidate with the same fingerprint dropped %d", n)
+	}
+	if n := c.Invalidate(key.Source, "v2"); n != 1 {
+		t.Errorf("Invalidate dropped %d, want 1", n)
+	}
+	if _, ok := c.Get(key, "revenue by month", t0); ok {
+		t.Error("hit after the schema changed")
+	}
+	if _, ok := c.Get(other, "revenue by month", t0); !ok {
+		t.Error("another source's entry was dropped")
+	}
+}
+
+func TestSimilarityThreshold(t *testing.T) {
+	c := New[string](time.Hour, 0.75, 0)
+	c.Put(key, "total revenue per region last quarter", "SELECT 1", nil, t0)
+
+	tests := []struct {
+		prompt string
+		ok     bool
+	}{
+		{"show me total revenue per region for last quarter", true}, // Only fillers differ: 1
+		{"total revenue per region in last quarter", true},          // 5/6
+		{"total revenue per country last quarter", false},           // 4/6
+		{"average order size", false},
+	}
+	for _, tt := range tests {
+		hit, ok := c.Get(key, tt.prompt, t0)
+		if ok != tt.ok {
+			t.Errorf("Get(%q) ok = %v (similarity %.2f), want %v", tt.prompt, ok, hit.Similarity, tt.ok)
+		}
+		if ok && (hit.Exact || hit.Similarity < 0.75) {
+			t.Errorf("Get(%q) = %+v, want a near-duplicate hit", tt.prompt, hit)
+		}
+	}
+
+	exactOnly := New[string](time.Hour, 1, 0)
+	exactOnly.Put(key, "total revenue per region last quarter", "SELECT 1", nil, t0)
+	if _, ok := exactOnly.Get(key, "total revenue per region in last quarter", t0); ok {
+		t.Error("near duplicate served with similarity 1")
+	}
+}
+
+func TestValuesOnlyMatchExactly(t *testing.T) {
+	c := New[string](time.Hour, 0.5, 0)
+	c.Put(key, "top 10 customers by revenue", "SELECT 10", nil, t0)
+	c.Put(key, "revenue for customer acme this year", "SELECT 'acme'", []string{"acme"}, t0)
+	c.Put(key, "orders by status this year", "SELECT 'x'", []string{"shipped"}, t0)
+
+	tests := []struct {
+		prompt string
+		want   string // "" for a miss
+	}{
+		{"top 10 customers by revenue", "SELECT 10"},
+		{"top 20 customers by revenue", ""},
+		{"the top customers by revenue", ""},
+		{"revenue for customer acme this year", "SELECT 'acme'"},
+		{"revenue for customer globex this year", ""},
+		{"revenue for customer Globex this year", ""},
+		{"revenue for customer 'globex' this year", ""},
+		{"revenue for bob@example.com this year", ""},
+		{"count of orders by status this year", "SELECT 'x'"}, // Literals it doesn't mention
+	}
+	for _, tt := range tests {
+		hit, ok := c.Get(key, tt.prompt, t0)
+		if got := map[bool]string{true: hit.Value}[ok]; got != tt.want {
+			t.Errorf("Get(%q) = %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+}
+
+func TestNamesValue(t *testing.T) {
+	tests := map[string]bool{
+		"revenue by month":                  false,
+		"Revenue by month":                  false,
+		"what's each customer's revenue":    false,
+		"can I see revenue by month":        false,
+		"revenue for Acme":                  true,
+		"top 5 products":                    true,
+		`orders with status "shipped"`:      true,
+		"orders for 'acme'":                 true,
+		"orders placed by jane@example.com": true,
+		"orders in the last 2 weeks":        true,
+	}
+	for prompt, want := range tests {
+		if got := namesValue(prompt); got != want {
+			t.Errorf("namesValue(%q) = %v, want %v", prompt, got, want)
+		}
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	c := New[string](time.Hour, 1, 2)
+	c.Put(key, "first question", "1", nil, t0)
+	c.Put(key, "second question", "2", nil, t0.Add(time.Second))
+	c.Put(key, "third question", "3", nil, t0.Add(2*time.Second))
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+	if _, ok := c.Get(key, "first question", t0.Add(3*time.Second)); ok {
+		t.Error("oldest entry kept past maxEntries")
+	}
+}
@@ -0,0 +1,72 @@
+package history
+
+import "strings"
+
+// Diff operations.
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// DiffLine is one line of a line-oriented diff.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Diff computes a line diff from a to b using a longest-common-subsequence table.
+// Queries are small, so the quadratic table is fine.
+func Diff(a, b string) []DiffLine {
+	left := splitLines(a)
+	right := splitLines(b)
+
+	// lcs[i][j] = length of LCS of left[i:] and right[j:]
+	lcs := make([][]int, len(left)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(right)+1)
+	}
+	for i := len(left) - 1; i >= 0; i-- {
+		for j := len(right) - 1; j >= 0; j-- {
+			if left[i] == right[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []DiffLine
+	i, j := 0, 0
+	for i < len(left) && j < len(right) {
+		switch {
+		case left[i] == right[j]:
+			out = append(out, DiffLine{Op: OpEqual, Text: left[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{Op: OpDelete, Text: left[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Op: OpInsert, Text: right[j]})
+			j++
+		}
+	}
+	for ; i < len(left); i++ {
+		out = append(out, DiffLine{Op: OpDelete, Text: left[i]})
+	}
+	for ; j < len(right); j++ {
+		out = append(out, DiffLine{Op: OpInsert, Text: right[j]})
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,229 @@
+// Package history records executed queries and SQL generations in a local append-only store.
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry kinds, one per recorded endpoint.
+const (
+	KindQuery    = "query"
+	KindExport   = "export"
+	KindGenerate = "generate"
+)
+
+// Entry is a single recorded call.
+type Entry struct {
+	ID         string    `json:"id"`
+	ParentID   string    `json:"parentId,omitempty"` // Entry this one was derived from
+	Thread     string    `json:"thread"`             // ID of the first entry in the chain
+	User       string    `json:"user"`
+	Kind       string    `json:"kind"`
+	Source     string    `json:"source,omitempty"` // Data source the SQL ran against
+	SQL        string    `json:"sql,omitempty"`
+	Prompt     string    `json:"prompt,omitempty"`
+	RowCount   int       `json:"rowCount"`
+	DurationMs int64     `json:"durationMs"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Filter selects entries from the store. Zero values match everything.
+type Filter struct {
+	User   string
+	Kind   string
+	Thread string
+	Source string
+	Search string // Case-insensitive substring of SQL or prompt
+	Status string // "ok" or "error"
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// Store is a file-backed history log. Entries are appended as JSON lines
+// and kept in memory for filtering.
+type Store struct {
+	path    string
+	entries []Entry
+	byID    map[string]int
+	mu      sync.RWMutex
+}
+
+// Open loads an existing history file, creating its directory if needed.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create history dir: %w", err)
+	}
+
+	s := &Store{path: path, byID: make(map[string]int)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			// Skip a torn trailing write rather than refusing to start
+			continue
+		}
+		s.byID[e.ID] = len(s.entries)
+		s.entries = append(s.entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+
+	return s, nil
+}
+
+// Add assigns an ID and thread to the entry, appends it to disk and returns it.
+func (s *Store) Add(e Entry) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ID = newID()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+	e.Thread = e.ID
+	if e.ParentID != "" {
+		if i, ok := s.byID[e.ParentID]; ok {
+			e.Thread = s.entries[i].Thread
+		} else {
+			e.ParentID = ""
+		}
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Entry{}, fmt.Errorf("open history: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return Entry{}, fmt.Errorf("write history: %w", err)
+	}
+
+	s.byID[e.ID] = len(s.entries)
+	s.entries = append(s.entries, e)
+	return e, nil
+}
+
+// Get returns the entry with the given ID.
+func (s *Store) Get(id string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i, ok := s.byID[id]
+	if !ok {
+		return Entry{}, false
+	}
+	return s.entries[i], true
+}
+
+// List returns matching entries, newest first, along with the total match count.
+func (s *Store) List(f Filter) ([]Entry, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(strings.TrimSpace(f.Search))
+
+	var matched []Entry
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		e := s.entries[i]
+		if f.User != "" && e.User != f.User {
+			continue
+		}
+		if f.Kind != "" && e.Kind != f.Kind {
+			continue
+		}
+		if f.Thread != "" && e.Thread != f.Thread {
+			continue
+		}
+		if f.Source != "" && e.Source != f.Source {
+			continue
+		}
+		if f.Status == "ok" && e.Error != "" {
+			continue
+		}
+		if f.Status == "error" && e.Error == "" {
+			continue
+		}
+		if !f.Since.IsZero() && e.CreatedAt.Before(f.Since) {
+			continue
+		}
+		if !f.Until.IsZero() && !e.CreatedAt.Before(f.Until) {
+			continue
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(e.SQL), search) &&
+			!strings.Contains(strings.ToLower(e.Prompt), search) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+
+	total := len(matched)
+	if f.Offset >= total {
+		return []Entry{}, total
+	}
+	matched = matched[f.Offset:]
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[:f.Limit]
+	}
+	return matched, total
+}
+
+// Versions returns every entry in a thread that carries SQL, oldest first.
+func (s *Store) Versions(thread string) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var versions []Entry
+	for _, e := range s.entries {
+		if e.Thread == thread && e.SQL != "" {
+			versions = append(versions, e)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].CreatedAt.Before(versions[j].CreatedAt)
+	})
+	return versions
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,328 @@
+// Package knowledge holds curated business context for SQL generation: a
+// glossary of terms with their exact SQL definitions, and verified examples
+// of questions with the SQL that answers them.
+//
+// Only the entries most relevant to a prompt are sent to the LLM. Relevance is
+// lexical: glossary terms are picked when every word of the term or one of
+// its aliases appears in the prompt, examples by TF-IDF cosine similarity
+// between their question and the prompt.
+package knowledge
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMaxTerms    = 5
+	defaultMaxExamples = 3
+
+	// minExampleScore is the cosine similarity below which an example is
+	// considered unrelated to the prompt.
+	minExampleScore = 0.2
+)
+
+// Config is the on-disk knowledge file (YAML).
+type Config struct {
+	MaxTerms    int       `yaml:"maxTerms"`    // Glossary entries per prompt, default 5
+	MaxExamples int       `yaml:"maxExamples"` // Examples per prompt, default 3
+	Glossary    []Term    `yaml:"glossary"`
+	Examples    []Example `yaml:"examples"`
+}
+
+// Term is a glossary entry.
+type Term struct {
+	Term       string   `yaml:"term"`
+	Aliases    []string `yaml:"aliases"`
+	Definition string   `yaml:"definition"`
+	SQL        string   `yaml:"sql"`     // Canonical SQL expression or query
+	Sources    []string `yaml:"sources"` // Data sources the term applies to; empty for all
+}
+
+// Example is a verified question and the SQL that answers it.
+type Example struct {
+	Question string   `yaml:"question"`
+	SQL      string   `yaml:"sql"`
+	Sources  []string `yaml:"sources"` // Data sources the example applies to; empty for all
+}
+
+// Base is a loaded knowledge file ready for selection.
+type Base struct {
+	maxTerms    int
+	maxExamples int
+	terms       []term
+	examples    []example
+	idf         map[string]float64 // Over example questions
+}
+
+type term struct {
+	Term
+	names [][]string // Tokenized term and aliases
+}
+
+type example struct {
+	Example
+	vec map[string]float64 // Normalized TF-IDF vector of the question
+}
+
+// Selection is the knowledge chosen for one prompt.
+type Selection struct {
+	Terms    []Term
+	Examples []Example
+}
+
+// Load reads and indexes a knowledge file.
+func Load(path string) (*Base, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read knowledge: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse knowledge: %w", err)
+	}
+	return New(cfg)
+}
+
+// New indexes a knowledge config.
+func New(cfg Config) (*Base, error) {
+	b := &Base{
+		maxTerms:    cfg.MaxTerms,
+		maxExamples: cfg.MaxExamples,
+		idf:         make(map[string]float64),
+	}
+	if b.maxTerms <= 0 {
+		b.maxTerms = defaultMaxTerms
+	}
+	if b.maxExamples <= 0 {
+		b.maxExamples = defaultMaxExamples
+	}
+
+	for i, t := range cfg.Glossary {
+		if t.Term == "" || (t.Definition == "" && t.SQL == "") {
+			return nil, fmt.Errorf("glossary entry %d: term and a definition or sql are required", i+1)
+		}
+		entry := term{Term: t}
+		for _, name := range append([]string{t.Term}, t.Aliases...) {
+			if words := tokenize(name); len(words) > 0 {
+				entry.names = append(entry.names, words)
+			}
+		}
+		b.terms = append(b.terms, entry)
+	}
+
+	docs := make([][]string, len(cfg.Examples))
+	for i, ex := range cfg.Examples {
+		if ex.Question == "" || ex.SQL == "" {
+			return nil, fmt.Errorf("example %d: question and sql are required", i+1)
+		}
+		docs[i] = tokenize(ex.Question)
+		seen := make(map[string]bool)
+		for _, w := range docs[i] {
+			if !seen[w] {
+				seen[w] = true
+				b.idf[w]++
+			}
+		}
+	}
+	for w, df := range b.idf {
+		b.idf[w] = math.Log(1+float64(len(docs))/df) + 1
+	}
+	for i, ex := range cfg.Examples {
+		b.examples = append(b.examples, example{Example: ex, vec: b.vector(docs[i])})
+	}
+	return b, nil
+}
+
+// Size returns the number of glossary terms and examples.
+func (b *Base) Size() (terms, examples int) {
+	return len(b.terms), len(b.examples)
+}
+
+// Select picks the glossary terms and examples most relevant to prompt for
+// the named data source. keep, when non-nil, vets each candidate example
+// (for instance against the caller's access policy).
+func (b *Base) Select(prompt, source string, keep func(Example) bool) Selection {
+	words := tokenize(prompt)
+	var sel Selection
+
+	type scored struct {
+		i     int
+		score float64
+	}
+
+	var terms []scored
+	for i, t := range b.terms {
+		if !appliesTo(t.Sources, source) {
+			continue
+		}
+		best := 0.0
+		for _, name := range t.names {
+			if s := nameScore(name, words); s > best {
+				best = s
+			}
+		}
+		if best > 0 {
+			terms = append(terms, scored{i, best})
+		}
+	}
+	sort.SliceStable(terms, func(i, j int) bool { return terms[i].score > terms[j].score })
+	for _, s := range terms[:min(len(terms), b.maxTerms)] {
+		sel.Terms = append(sel.Terms, b.terms[s.i].Term)
+	}
+
+	query := b.vector(words)
+	var examples []scored
+	for i, ex := range b.examples {
+		if !appliesTo(ex.Sources, source) {
+			continue
+		}
+		if s := cosine(query, ex.vec); s >= minExampleScore {
+			examples = append(examples, scored{i, s})
+		}
+	}
+	sort.SliceStable(examples, func(i, j int) bool { return examples[i].score > examples[j].score })
+	for _, s := range examples {
+		if len(sel.Examples) == b.maxExamples {
+			break
+		}
+		if ex := b.examples[s.i].Example; keep == nil || keep(ex) {
+			sel.Examples = append(sel.Examples, ex)
+		}
+	}
+	return sel
+}
+
+// GlossaryText formats the selected terms for the system prompt.
+func (s Selection) GlossaryText() string {
+	var sb strings.Builder
+	for _, t := range s.Terms {
+		sb.WriteString("- ")
+		sb.WriteString(t.Term)
+		if len(t.Aliases) > 0 {
+			sb.WriteString(" (also: " + strings.Join(t.Aliases, ", ") + ")")
+		}
+		if t.Definition != "" {
+			sb.WriteString(": " + strings.TrimSpace(t.Definition))
+		}
+		sb.WriteString("\n")
+		if t.SQL != "" {
+			sb.WriteString("  SQL: " + strings.ReplaceAll(strings.TrimSpace(t.SQL), "\n", "\n       ") + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// ExamplesText formats the selected examples in the prompt's few-shot style.
+func (s Selection) ExamplesText() string {
+	var sb strings.Builder
+	for _, ex := range s.Examples {
+		fmt.Fprintf(&sb, "User: %q\n%s\n\n", strings.TrimSpace(ex.Question), strings.TrimSpace(ex.SQL))
+	}
+	return sb.String()
+}
+
+// Names returns the terms and example questions selected, for logging.
+func (s Selection) Names() []string {
+	var names []string
+	for _, t := range s.Terms {
+		names = append(names, t.Term)
+	}
+	for _, ex := range s.Examples {
+		names = append(names, ex.Question)
+	}
+	return names
+}
+
+func appliesTo(sources []string, source string) bool {
+	return len(sources) == 0 || slices.Contains(sources, source)
+}
+
+// nameScore rates how well the prompt mentions a term name: above 1 when the
+// name appears as a phrase (longer names rank higher), 1 when its words all
+// appear but apart ("customers who are active"), else 0.
+func nameScore(name, words []string) float64 {
+	for i := 0; i+len(name) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(name)], name) {
+			return 1 + 0.1*float64(len(name))
+		}
+	}
+	for _, w := range name {
+		if !slices.Contains(words, w) {
+			return 0
+		}
+	}
+	return 1
+}
+
+func (b *Base) vector(words []string) map[string]float64 {
+	vec := make(map[string]float64)
+	for _, w := range words {
+		if idf, ok := b.idf[w]; ok {
+			vec[w] += idf
+		}
+	}
+	norm := 0.0
+	for _, v := range vec {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for w := range vec {
+		vec[w] /= norm
+	}
+	return vec
+}
+
+func cosine(a, b map[string]float64) float64 {
+	sum := 0.0
+	for w, v := range a {
+		sum += v * b[w]
+	}
+	return sum
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "of": true, "in": true,
+	"on": true, "for": true, "to": true, "by": true, "with": true, "from": true, "at": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "me": true, "my": true,
+	"show": true, "list": true, "give": true, "get": true, "find": true, "what": true,
+	"which": true, "who": true, "how": true, "many": true, "much": true, "all": true,
+	"each": true, "per": true, "do": true, "does": true, "did": true, "we": true, "our": true,
+	"i": true, "it": true, "that": true, "this": true, "there": true, "have": true, "has": true,
+}
+
+// tokenize lowercases text, splits it into words, drops stop words and
+// strips common English suffixes so "customers" matches "customer".
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words := fields[:0]
+	for _, f := range fields {
+		if !stopWords[f] {
+			words = append(words, stem(f))
+		}
+	}
+	return words
+}
+
+func stem(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 5 && strings.HasSuffix(w, "ing"):
+		return w[:len(w)-3]
+	case len(w) > 4 && strings.HasSuffix(w, "ed"):
+		return w[:len(w)-2]
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonAnswerInstruction is appended to the system prompt of providers that
+// ask for a structured answer.
+const jsonAnswerInstruction = `
+
+OUTPUT FORMAT (this replaces the output rules above): respond with a JSON object with these fields:
+- "sql": the query, without markdown or comments; empty when the request can't be answered
+- "missing": empty, or, when the request can't be answered, what tables, columns or data would be needed
+- "assumptions": the assumptions you made to interpret the request, as short sentences; empty if none
+- "tables_used": the tables the query reads
+- "confidence": a number from 0 to 1, how sure you are that the query answers the request as intended`
+
+// answerSchema is the JSON schema of the structured answer. Every property
+// is required and no others are allowed, as OpenAI's strict mode demands.
+var answerSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"sql":         map[string]any{"type": "string"},
+		"missing":     map[string]any{"type": "string"},
+		"assumptions": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"tables_used": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"confidence":  map[string]any{"type": "number"},
+	},
+	"required":             []string{"sql", "missing", "assumptions", "tables_used", "confidence"},
+	"additionalProperties": false,
+}
+
+// answerGrammar is answerSchema as a GBNF grammar for llama.cpp.
+const answerGrammar = `root    ::= "{" ws "\"sql\":" ws string "," ws "\"missing\":" ws string "," ws "\"assumptions\":" ws strings "," ws "\"tables_used\":" ws strings "," ws "\"confidence\":" ws number ws "}"
+strings ::= "[" ws ( string ( "," ws string )* )? ws "]"
+string  ::= "\"" ( [^"\\\x7F\x00-\x1F] | "\\" ( ["\\/bfnrt] | "u" hex hex hex hex ) )* "\""
+hex     ::= [0-9a-fA-F]
+number  ::= ( "0" ( "." [0-9] [0-9]? )? ) | "1" ( ".0" )?
+ws      ::= [ \t\n]?
+`
+
+type jsonAnswer struct {
+	SQL         string   `json:"sql"`
+	Missing     string   `json:"missing"`
+	Assumptions []string `json:"assumptions"`
+	TablesUsed  []string `json:"tables_used"`
+	Confidence  float64  `json:"confidence"`
+}
+
+// parseProse reads the answer to a Prose request.
+func parseProse(content string) GenerateResponse {
+	return GenerateResponse{Text: strings.TrimSpace(content)}
+}
+
+// parseJSONAnswer reads a structured answer. Output that isn't the expected
+// JSON, even after dropping any prose around the object, goes to the text
+// parser.
+func parseJSONAnswer(content string) GenerateResponse {
+	var ans jsonAnswer
+	err := json.Unmarshal([]byte(strings.TrimSpace(content)), &ans)
+	if err != nil {
+		start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+		if start < 0 || end < start {
+			return ParseResponse(content)
+		}
+		if err := json.Unmarshal([]byte(content[start:end+1]), &ans); err != nil {
+			return ParseResponse(content)
+		}
+	}
+
+	var resp GenerateResponse
+	if strings.TrimSpace(ans.SQL) == "" && strings.TrimSpace(ans.Missing) != "" {
+		resp.Missing = strings.TrimSpace(ans.Missing)
+	} else {
+		resp = ParseResponse(ans.SQL)
+	}
+	for _, a := range ans.Assumptions {
+		if a = strings.TrimSpace(a); a != "" {
+			resp.Assumptions = append(resp.Assumptions, a)
+		}
+	}
+	resp.TablesUsed = ans.TablesUsed
+	resp.Confidence = min(max(ans.Confidence, 0), 1)
+	return resp
+}
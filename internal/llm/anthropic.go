@@ -12,12 +12,16 @@ import (
 
 const anthropicAPIVersion = "2023-06-01"
 
+// anthropicAnswerTool is the tool the model is made to call with its answer.
+const anthropicAnswerTool = "submit_sql"
+
 // AnthropicProvider implements the Provider interface for Anthropic's Claude API.
 type AnthropicProvider struct {
-	apiKey  string
-	model   string
-	baseURL string
-	client  *http.Client
+	apiKey    string
+	model     string
+	baseURL   string
+	plainText bool // Don't ask for a structured answer
+	client    *http.Client
 }
 
 // NewAnthropicProvider creates a new Anthropic provider.
@@ -38,8 +42,10 @@ func (p *AnthropicProvider) Name() string {
 }
 
 // GenerateSQL sends a prompt to the Anthropic API and returns the generated SQL.
+// With req.Tools the model may call them first; their results go back to it
+// until it answers or runs out of steps.
 func (p *AnthropicProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
-	systemPrompt := BuildSystemPrompt(req.Schema)
+	systemPrompt := req.SystemPrompt()
 
 	maxTokens := req.MaxTokens
 	if maxTokens <= 0 {
@@ -54,15 +60,129 @@ func (p *AnthropicProvider) GenerateSQL(ctx context.Context, req GenerateRequest
 			{Role: "user", Content: req.Prompt},
 		},
 	}
+	// answerChoice makes the model answer rather than call another tool
+	var answerChoice *anthropicToolChoice
+	if !p.plainText && !req.Prose {
+		// Forcing a tool call is how the Messages API returns schema-shaped JSON
+		payload.System += jsonAnswerInstruction
+		payload.Tools = []anthropicTool{{
+			Name:        anthropicAnswerTool,
+			Description: "Submit the SQL query answering the request, or explain what data is missing.",
+			InputSchema: answerSchema,
+		}}
+		answerChoice = &anthropicToolChoice{Type: "tool", Name: anthropicAnswerTool}
+		payload.ToolChoice = answerChoice
+	}
+	tools := req.Tools
+	if req.Prose {
+		tools = nil
+	}
+	if tools != nil {
+		payload.System += agentInstruction
+		for _, t := range tools.Tools() {
+			payload.Tools = append(payload.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+		}
+		if p.plainText {
+			payload.ToolChoice = &anthropicToolChoice{Type: "auto"}
+			answerChoice = &anthropicToolChoice{Type: "none"}
+		} else {
+			// Any tool, the answer tool included
+			payload.ToolChoice = &anthropicToolChoice{Type: "any"}
+		}
+	}
+
+	var calls []ToolCall
+	promptTokens, completionTokens := 0, 0
+	for step := 1; ; step++ {
+		last := tools == nil || step == req.maxSteps()
+		if tools != nil && last {
+			payload.ToolChoice = answerChoice
+		}
+
+		result, errResp, err := p.complete(ctx, payload)
+		if err != nil {
+			errResp.Model, errResp.ToolCalls = p.model, calls
+			errResp.setUsage(promptTokens, completionTokens)
+			return errResp, err
+		}
+		promptTokens += result.Usage.InputTokens
+		completionTokens += result.Usage.OutputTokens
+
+		// Use the answer tool's input, else run the other tools called, else
+		// use the first text block
+		var content string
+		structured := false
+		var toolUses []anthropicContent
+		for _, block := range result.Content {
+			if block.Type == "tool_use" && block.Name == anthropicAnswerTool {
+				content, structured = string(block.Input), true
+				break
+			}
+			if block.Type == "tool_use" {
+				toolUses = append(toolUses, block)
+			}
+			if block.Type == "text" && content == "" {
+				content = block.Text
+			}
+		}
+
+		if !structured && len(toolUses) > 0 && !last {
+			var assistant []anthropicContent
+			for _, block := range result.Content {
+				// Empty text blocks are rejected when sent back
+				if block.Type != "text" || block.Text != "" {
+					assistant = append(assistant, block)
+				}
+			}
+			results := make([]anthropicToolResult, len(toolUses))
+			for i, block := range toolUses {
+				call, out := callTool(ctx, tools, block.Name, block.Input)
+				calls = append(calls, call)
+				results[i] = anthropicToolResult{Type: "tool_result", ToolUseID: block.ID, Content: out, IsError: call.Error != ""}
+			}
+			payload.Messages = append(payload.Messages,
+				anthropicMessage{Role: "assistant", Content: assistant},
+				anthropicMessage{Role: "user", Content: results},
+			)
+			continue
+		}
+
+		if content == "" {
+			empty := GenerateResponse{Error: "no text in response", Model: p.model, ToolCalls: calls}
+			empty.setUsage(promptTokens, completionTokens)
+			return empty, fmt.Errorf("no text content")
+		}
+
+		var genResp GenerateResponse
+		switch {
+		case req.Prose:
+			genResp = parseProse(content)
+		case structured:
+			genResp = parseJSONAnswer(content)
+		default:
+			genResp = ParseResponse(content)
+		}
+		genResp.Model = p.model
+		genResp.setUsage(promptTokens, completionTokens)
+		genResp.ToolCalls = calls
+
+		return genResp, nil
+	}
+}
+
+// complete makes one Messages API call. On error it also returns the
+// response to give the caller.
+func (p *AnthropicProvider) complete(ctx context.Context, payload anthropicRequest) (anthropicResponse, GenerateResponse, error) {
+	var result anthropicResponse
 
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return GenerateResponse{Error: "failed to marshal request"}, err
+		return result, GenerateResponse{Error: "failed to marshal request"}, err
 	}
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewReader(body))
 	if err != nil {
-		return GenerateResponse{Error: "failed to create request"}, err
+		return result, GenerateResponse{Error: "failed to create request"}, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -71,63 +191,66 @@ func (p *AnthropicProvider) GenerateSQL(ctx context.Context, req GenerateRequest
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return GenerateResponse{Error: "request failed"}, err
+		return result, GenerateResponse{Error: "request failed"}, err
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return GenerateResponse{Error: "failed to read response"}, err
+		return result, GenerateResponse{Error: "failed to read response"}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		var errResp anthropicErrorResponse
 		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error.Message != "" {
-			return GenerateResponse{Error: errResp.Error.Message}, fmt.Errorf("API error: %s", errResp.Error.Message)
+			return result, GenerateResponse{Error: errResp.Error.Message}, newAPIError(resp, errResp.Error.Message)
 		}
-		return GenerateResponse{Error: fmt.Sprintf("API returned status %d", resp.StatusCode)}, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return result, GenerateResponse{Error: fmt.Sprintf("API returned status %d", resp.StatusCode)}, newAPIError(resp, "")
 	}
 
-	var result anthropicResponse
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return GenerateResponse{Error: "failed to parse response"}, err
+		return result, GenerateResponse{Error: "failed to parse response"}, err
 	}
 
 	if len(result.Content) == 0 {
-		return GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty content array")
-	}
-
-	// Find the first text block
-	var content string
-	for _, block := range result.Content {
-		if block.Type == "text" {
-			content = block.Text
-			break
-		}
-	}
-
-	if content == "" {
-		return GenerateResponse{Error: "no text in response"}, fmt.Errorf("no text content")
+		return result, GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty content array")
 	}
 
-	genResp := ParseResponse(content)
-	genResp.Tokens = result.Usage.InputTokens + result.Usage.OutputTokens
-
-	return genResp, nil
+	return result, GenerateResponse{}, nil
 }
 
 // Anthropic API request/response types
 
 type anthropicRequest struct {
-	Model     string             `json:"model"`
-	System    string             `json:"system,omitempty"`
-	Messages  []anthropicMessage `json:"messages"`
-	MaxTokens int                `json:"max_tokens"`
+	Model      string               `json:"model"`
+	System     string               `json:"system,omitempty"`
+	Messages   []anthropicMessage   `json:"messages"`
+	MaxTokens  int                  `json:"max_tokens"`
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type anthropicMessage struct {
 	Role    string `json:"role"`
-	Content string `json:"content"`
+	Content any    `json:"content"` // A string, or content blocks
+}
+
+type anthropicToolResult struct {
+	Type      string `json:"type"`
+	ToolUseID string `json:"tool_use_id"`
+	Content   string `json:"content"`
+	IsError   bool   `json:"is_error,omitempty"`
 }
 
 type anthropicResponse struct {
@@ -136,8 +259,11 @@ type anthropicResponse struct {
 }
 
 type anthropicContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`    // tool_use blocks
+	Name  string          `json:"name,omitempty"`  // tool_use blocks
+	Input json.RawMessage `json:"input,omitempty"` // tool_use blocks
 }
 
 type anthropicUsage struct {
@@ -0,0 +1,320 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrAllUnavailable is returned by a Chain when every provider's circuit
+// breaker is open.
+var ErrAllUnavailable = errors.New("all LLM providers are unavailable")
+
+// ChainConfig is the on-disk provider chain file (JSON).
+type ChainConfig struct {
+	Providers      []ChainProvider `json:"providers"` // In order of preference
+	Retry          RetryConfig     `json:"retry"`
+	CircuitBreaker BreakerConfig   `json:"circuitBreaker"`
+}
+
+// ChainProvider configures one provider of a chain, with the same settings
+// as the LLM_* environment variables. ${VAR} references in apiKey and
+// baseUrl are expanded from the environment.
+type ChainProvider struct {
+	Name       string `json:"name"` // Shown in responses and logs; defaults to the provider type
+	Provider   string `json:"provider"`
+	APIKey     string `json:"apiKey"`
+	Model      string `json:"model"`
+	BaseURL    string `json:"baseUrl"`
+	APIVersion string `json:"apiVersion"`
+	KeepAlive  string `json:"keepAlive"`
+	Fixtures   string `json:"fixtures"`
+	PlainText  bool   `json:"plainText"`
+}
+
+// RetryConfig controls retries of a provider before falling back to the next.
+type RetryConfig struct {
+	MaxAttempts    int    `json:"maxAttempts"`    // Per provider, default 3
+	InitialBackoff string `json:"initialBackoff"` // Default 500ms, doubled per attempt
+	MaxBackoff     string `json:"maxBackoff"`     // Default 8s; longer Retry-After waits fall back instead
+}
+
+// BreakerConfig controls the per-provider circuit breakers.
+type BreakerConfig struct {
+	FailureThreshold int    `json:"failureThreshold"` // Consecutive failed requests that open it, default 5
+	Cooldown         string `json:"cooldown"`         // How long it stays open before a trial request, default 30s
+}
+
+// LoadChainConfig reads a provider chain file.
+func LoadChainConfig(path string) (ChainConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ChainConfig{}, fmt.Errorf("read LLM config: %w", err)
+	}
+	var cfg ChainConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return ChainConfig{}, fmt.Errorf("parse LLM config: %w", err)
+	}
+	// Keep credentials out of the file
+	for i := range cfg.Providers {
+		cfg.Providers[i].APIKey = os.ExpandEnv(cfg.Providers[i].APIKey)
+		cfg.Providers[i].BaseURL = os.ExpandEnv(cfg.Providers[i].BaseURL)
+	}
+	return cfg, nil
+}
+
+// Chain is a Provider that tries providers in order. Each is retried on
+// rate limits, server errors and network failures with exponential backoff
+// and jitter, honouring Retry-After; once its retries are spent, or on any
+// other error, the next provider is tried. A provider whose requests keep
+// failing is skipped until its circuit breaker's cooldown has passed.
+type Chain struct {
+	members        []*chainMember
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+type chainMember struct {
+	name     string
+	provider Provider
+	breaker  *breaker
+}
+
+// NewChain builds the providers of a chain.
+func NewChain(cfg ChainConfig) (*Chain, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, errors.New("LLM config: no providers")
+	}
+
+	c := &Chain{maxAttempts: cfg.Retry.MaxAttempts}
+	if c.maxAttempts <= 0 {
+		c.maxAttempts = 3
+	}
+	var err error
+	if c.initialBackoff, err = parseDurationOr(cfg.Retry.InitialBackoff, 500*time.Millisecond); err != nil {
+		return nil, fmt.Errorf("LLM config: retry.initialBackoff: %w", err)
+	}
+	if c.maxBackoff, err = parseDurationOr(cfg.Retry.MaxBackoff, 8*time.Second); err != nil {
+		return nil, fmt.Errorf("LLM config: retry.maxBackoff: %w", err)
+	}
+	threshold := cfg.CircuitBreaker.FailureThreshold
+	if threshold <= 0 {
+		threshold = 5
+	}
+	cooldown, err := parseDurationOr(cfg.CircuitBreaker.Cooldown, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("LLM config: circuitBreaker.cooldown: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, pc := range cfg.Providers {
+		name := pc.Name
+		if name == "" {
+			name = pc.Provider
+		}
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("LLM config: provider %d: missing or duplicate name %q", i+1, name)
+		}
+		seen[name] = true
+
+		provider, err := newProvider(Config{
+			Provider:   strings.ToLower(strings.TrimSpace(pc.Provider)),
+			APIKey:     pc.APIKey,
+			Model:      pc.Model,
+			BaseURL:    pc.BaseURL,
+			APIVersion: pc.APIVersion,
+			KeepAlive:  pc.KeepAlive,
+			Fixtures:   pc.Fixtures,
+			PlainText:  pc.PlainText,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("LLM config: provider %s: %w", name, err)
+		}
+		c.members = append(c.members, &chainMember{
+			name:     name,
+			provider: provider,
+			breaker:  &breaker{threshold: threshold, cooldown: cooldown},
+		})
+	}
+	return c, nil
+}
+
+func parseDurationOr(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return d, err
+}
+
+// Name lists the providers of the chain.
+func (c *Chain) Name() string {
+	names := make([]string, len(c.members))
+	for i, m := range c.members {
+		names[i] = m.name
+	}
+	return "chain(" + strings.Join(names, ", ") + ")"
+}
+
+// GenerateSQL asks each provider in turn until one answers. The response's
+// Provider names the one that did or, on failure, the last one tried, whose
+// tokens the response carries.
+func (c *Chain) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	var lastResp GenerateResponse
+	var lastErr error
+	tried := 0
+	for i, m := range c.members {
+		if !m.breaker.allow(time.Now()) {
+			continue
+		}
+		tried++
+
+		resp, err := c.generateWithRetry(ctx, m, req)
+		resp.Provider = m.name
+		if err == nil {
+			m.breaker.success()
+			if i > 0 {
+				log.Printf("llm: answered by fallback provider %s", m.name)
+			}
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the provider
+			m.breaker.release()
+			return resp, err
+		}
+		if m.breaker.failure(time.Now()) {
+			log.Printf("llm: circuit breaker for %s open for %s", m.name, m.breaker.cooldown)
+		}
+		log.Printf("llm: provider %s failed: %v", m.name, err)
+		lastResp, lastErr = resp, fmt.Errorf("%s: %w", m.name, err)
+	}
+
+	if tried == 0 {
+		return GenerateResponse{Error: "all LLM providers are temporarily unavailable, try again shortly"}, ErrAllUnavailable
+	}
+	return lastResp, lastErr
+}
+
+// generateWithRetry calls one provider, retrying transient failures.
+func (c *Chain) generateWithRetry(ctx context.Context, m *chainMember, req GenerateRequest) (GenerateResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := m.provider.GenerateSQL(ctx, req)
+		if err == nil || attempt == c.maxAttempts || !retryable(err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			if apiErr.RetryAfter > c.maxBackoff {
+				// Don't hold the request that long; let the next provider answer
+				return resp, err
+			}
+			wait = apiErr.RetryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		log.Printf("llm: provider %s attempt %d failed (%v), retrying in %s", m.name, attempt, err, wait.Round(time.Millisecond))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the wait before retry number attempt: exponential, capped
+// at maxBackoff, with "equal jitter" (a random half) to spread out clients
+// retrying together.
+func (c *Chain) backoff(attempt int) time.Duration {
+	d := c.initialBackoff << (attempt - 1)
+	if d > c.maxBackoff || d <= 0 {
+		d = c.maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryable reports whether an error is worth retrying on the same provider:
+// rate limits, server errors and failures to get a response at all.
+func retryable(err error) bool {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode >= 500
+	case errors.Is(err, ErrNoFixture), errors.Is(err, context.Canceled):
+		return false
+	}
+	return true
+}
+
+// breaker is a circuit breaker. It opens after threshold consecutive
+// failures; once cooldown has passed it lets one trial request through,
+// which closes it on success and reopens it on failure.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // A trial request is in flight
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.failures < b.threshold:
+		return true
+	case now.Before(b.openUntil), b.trial:
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+// failure records a failed request and reports whether it opened the breaker.
+func (b *breaker) failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// release ends a request without judging the provider.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
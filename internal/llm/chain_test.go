@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// scriptedProvider fails with errs in turn, then answers with SQL.
+type scriptedProvider struct {
+	errs  []error
+	calls int
+}
+
+func (p *scriptedProvider) Name() string { return "scripted" }
+
+func (p *scriptedProvider) GenerateSQL(context.Context, GenerateRequest) (GenerateResponse, error) {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		if err := p.errs[p.calls-1]; err != nil {
+			return GenerateResponse{}, err
+		}
+	}
+	return GenerateResponse{SQL: "SELECT 1"}, nil
+}
+
+func testChain(threshold int, cooldown time.Duration, providers ...Provider) *Chain {
+	c := &Chain{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: 50 * time.Millisecond}
+	for i, p := range providers {
+		c.members = append(c.members, &chainMember{
+			name:     string(rune('a' + i)),
+			provider: p,
+			breaker:  &breaker{threshold: threshold, cooldown: cooldown},
+		})
+	}
+	return c
+}
+
+func status(code int) error { return &APIError{StatusCode: code} }
+
+func TestChainRetriesTransientErrors(t *testing.T) {
+	first := &scriptedProvider{errs: []error{status(http.StatusServiceUnavailable), status(http.StatusTooManyRequests)}}
+	second := &scriptedProvider{}
+	resp, err := testChain(5, time.Minute, first, second).GenerateSQL(context.Background(), GenerateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.calls != 3 || second.calls != 0 {
+		t.Errorf("calls = %d, %d, want 3, 0", first.calls, second.calls)
+	}
+	if resp.Provider != "a" {
+		t.Errorf("Provider = %q, want a", resp.Provider)
+	}
+}
+
+func TestChainFallsBack(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+	}{
+		{"client error", []error{status(http.StatusBadRequest)}, 1},
+		{"no fixture", []error{ErrNoFixture}, 1},
+		{"retries spent", []error{status(500), status(502), status(503)}, 3},
+		{"retry-after beyond max backoff", []error{&APIError{StatusCode: 429, RetryAfter: time.Minute}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &scriptedProvider{errs: tt.errs}
+			second := &scriptedProvider{}
+			resp, err := testChain(5, time.Minute, first, second).GenerateSQL(context.Background(), GenerateRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.calls != tt.wantCalls || second.calls != 1 {
+				t.Errorf("calls = %d, %d, want %d, 1", first.calls, second.calls, tt.wantCalls)
+			}
+			if resp.Provider != "b" {
+				t.Errorf("Provider = %q, want b", resp.Provider)
+			}
+		})
+	}
+}
+
+func TestChainHonoursRetryAfter(t *testing.T) {
+	wait := 30 * time.Millisecond
+	p := &scriptedProvider{errs: []error{&APIError{StatusCode: 429, RetryAfter: wait}}}
+	start := time.Now()
+	if _, err := testChain(5, time.Minute, p).GenerateSQL(context.Background(), GenerateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < wait {
+		t.Errorf("retried after %s, want at least %s", elapsed, wait)
+	}
+	if p.calls != 2 {
+		t.Errorf("calls = %d, want 2", p.calls)
+	}
+}
+
+func TestChainReturnsLastError(t *testing.T) {
+	first := &scriptedProvider{errs: []error{status(400)}}
+	second := &scriptedProvider{errs: []error{status(401)}}
+	resp, err := testChain(5, time.Minute, first, second).GenerateSQL(context.Background(), GenerateRequest{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("err = %v, want the second provider's 401", err)
+	}
+	if resp.Provider != "b" {
+		t.Errorf("Provider = %q, want the provider that failed last", resp.Provider)
+	}
+}
+
+func TestChainBreaker(t *testing.T) {
+	failing := status(http.StatusBadRequest)
+	first := &scriptedProvider{errs: []error{failing, failing, failing}}
+	second := &scriptedProvider{}
+	c := testChain(2, 20*time.Millisecond, first, second)
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := c.GenerateSQL(ctx, GenerateRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Open: skipped without a call
+	resp, err := c.GenerateSQL(ctx, GenerateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.calls != 2 || resp.Provider != "b" {
+		t.Errorf("open breaker: calls = %d, provider %q; want 2, b", first.calls, resp.Provider)
+	}
+
+	// After the cooldown a trial request fails and reopens it
+	time.Sleep(25 * time.Millisecond)
+	if _, err := c.GenerateSQL(ctx, GenerateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GenerateSQL(ctx, GenerateRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if first.calls != 3 {
+		t.Errorf("after failed trial: calls = %d, want 3", first.calls)
+	}
+
+	// The next trial succeeds and closes it
+	time.Sleep(25 * time.Millisecond)
+	resp, err = c.GenerateSQL(ctx, GenerateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Provider != "a" {
+		t.Errorf("after successful trial: provider %q, want a", resp.Provider)
+	}
+}
+
+func TestChainAllUnavailable(t *testing.T) {
+	p := &scriptedProvider{errs: []error{status(400)}}
+	c := testChain(1, time.Minute, p)
+	if _, err := c.GenerateSQL(context.Background(), GenerateRequest{}); err == nil {
+		t.Fatal("want the provider's error")
+	}
+	resp, err := c.GenerateSQL(context.Background(), GenerateRequest{})
+	if !errors.Is(err, ErrAllUnavailable) || resp.Error == "" {
+		t.Errorf("err = %v, resp.Error = %q; want ErrAllUnavailable with a message", err, resp.Error)
+	}
+}
+
+func TestBreakerOneTrialAtATime(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: time.Minute}
+	now := time.Now()
+	b.failure(now)
+	if b.allow(now.Add(time.Second)) {
+		t.Error("allowed during cooldown")
+	}
+	later := now.Add(2 * time.Minute)
+	if !b.allow(later) {
+		t.Fatal("trial not allowed after cooldown")
+	}
+	if b.allow(later) {
+		t.Error("second request allowed while the trial is in flight")
+	}
+	b.release()
+	if !b.allow(later) {
+		t.Error("released trial not allowed again")
+	}
+}
+
+func TestBackoffBounds(t *testing.T) {
+	c := &Chain{initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 5: time.Second, 70: time.Second} {
+		for range 20 {
+			if d := c.backoff(attempt); d < limit/2 || d > limit {
+				t.Errorf("backoff(%d) = %s, want within [%s, %s]", attempt, d, limit/2, limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GeminiProvider implements the Provider interface for Google's Gemini API.
+type GeminiProvider struct {
+	apiKey    string
+	model     string
+	baseURL   string
+	plainText bool // Don't ask for a structured answer
+	client    *http.Client
+}
+
+// NewGeminiProvider creates a new Gemini provider.
+func NewGeminiProvider(apiKey, model, baseURL string) *GeminiProvider {
+	return &GeminiProvider{
+		apiKey:  apiKey,
+		model:   model,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name.
+func (p *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+// GenerateSQL sends a prompt to the Gemini generateContent API and returns
+// the generated SQL.
+func (p *GeminiProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	systemPrompt := req.SystemPrompt()
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+
+	payload := geminiRequest{
+		SystemInstruction: &geminiContent{Parts: []geminiPart{{Text: systemPrompt}}},
+		Contents: []geminiContent{
+			{Role: "user", Parts: []geminiPart{{Text: req.Prompt}}},
+		},
+		GenerationConfig: geminiGenerationConfig{
+			Temperature:     0, // Deterministic for SQL generation
+			MaxOutputTokens: maxTokens,
+		},
+	}
+	if !p.plainText && !req.Prose {
+		payload.SystemInstruction.Parts[0].Text += jsonAnswerInstruction
+		payload.GenerationConfig.ResponseMIMEType = "application/json"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return GenerateResponse{Error: "failed to marshal request"}, err
+	}
+
+	endpoint := p.baseURL + "/models/" + url.PathEscape(p.model) + ":generateContent"
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return GenerateResponse{Error: "failed to create request"}, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return GenerateResponse{Error: "request failed"}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GenerateResponse{Error: "failed to read response"}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp geminiErrorResponse
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error.Message != "" {
+			return GenerateResponse{Error: errResp.Error.Message}, newAPIError(resp, errResp.Error.Message)
+		}
+		return GenerateResponse{Error: fmt.Sprintf("API returned status %d", resp.StatusCode)}, newAPIError(resp, "")
+	}
+
+	var result geminiResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return GenerateResponse{Error: "failed to parse response"}, err
+	}
+
+	if reason := result.PromptFeedback.BlockReason; reason != "" {
+		return GenerateResponse{Error: "prompt blocked by the model: " + reason}, fmt.Errorf("prompt blocked: %s", reason)
+	}
+
+	if len(result.Candidates) == 0 {
+		return GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty candidates array")
+	}
+
+	// Concatenate the text parts of the first candidate
+	var content strings.Builder
+	for _, part := range result.Candidates[0].Content.Parts {
+		content.WriteString(part.Text)
+	}
+
+	if content.Len() == 0 {
+		reason := result.Candidates[0].FinishReason
+		return GenerateResponse{Error: "no text in response"}, fmt.Errorf("no text content (finish reason %q)", reason)
+	}
+
+	var genResp GenerateResponse
+	switch {
+	case req.Prose:
+		genResp = parseProse(content.String())
+	case p.plainText:
+		genResp = ParseResponse(content.String())
+	default:
+		genResp = parseJSONAnswer(content.String())
+	}
+	genResp.Model = p.model
+	// The total includes thinking tokens, billed as output
+	usage := result.UsageMetadata
+	genResp.setUsage(usage.PromptTokenCount, usage.TotalTokenCount-usage.PromptTokenCount)
+
+	return genResp, nil
+}
+
+// Gemini API request/response types
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent        `json:"contents"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      float64 `json:"temperature"`
+	MaxOutputTokens  int     `json:"maxOutputTokens,omitempty"`
+	ResponseMIMEType string  `json:"responseMimeType,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates     []geminiCandidate    `json:"candidates"`
+	PromptFeedback geminiPromptFeedback `json:"promptFeedback"`
+	UsageMetadata  geminiUsage          `json:"usageMetadata"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiPromptFeedback struct {
+	BlockReason string `json:"blockReason"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type geminiErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeminiRequestAndResponse(t *testing.T) {
+	var got geminiRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1beta/models/gemini-2.0-flash:generateContent" {
+			t.Errorf("request to %s %s", r.Method, r.URL.Path)
+		}
+		if key := r.Header.Get("x-goog-api-key"); key != "secret" {
+			t.Errorf("x-goog-api-key = %q", key)
+		}
+		if r.URL.Query().Get("key") != "" {
+			t.Error("API key sent in the URL")
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		io.WriteString(w, `{
+			"candidates": [{"content": {"role": "model", "parts": [
+				{"text": "{\"sql\": \"SELECT count(*) FROM users\", \"missing\": \"\", "},
+				{"text": "\"assumptions\": [\"all users\"], \"tables_used\": [\"users\"], \"confidence\": 0.9}"}
+			]}, "finishReason": "STOP"}],
+			"usageMetadata": {"promptTokenCount": 120, "candidatesTokenCount": 30, "totalTokenCount": 170}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider("secret", "gemini-2.0-flash", srv.URL+"/v1beta/")
+	resp, err := p.GenerateSQL(context.Background(), GenerateRequest{
+		Prompt:    "how many users?",
+		Schema:    "users(id, name)",
+		MaxTokens: 256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.SystemInstruction == nil || !strings.Contains(got.SystemInstruction.Parts[0].Text, "users(id, name)") ||
+		!strings.Contains(got.SystemInstruction.Parts[0].Text, `"tables_used"`) {
+		t.Errorf("system instruction lacks the schema or the JSON format: %+v", got.SystemInstruction)
+	}
+	if len(got.Contents) != 1 || got.Contents[0].Role != "user" || got.Contents[0].Parts[0].Text != "how many users?" {
+		t.Errorf("contents = %+v", got.Contents)
+	}
+	if got.GenerationConfig.MaxOutputTokens != 256 || got.GenerationConfig.ResponseMIMEType != "application/json" {
+		t.Errorf("generation config = %+v", got.GenerationConfig)
+	}
+
+	if resp.SQL != "SELECT count(*) FROM users" || resp.Confidence != 0.9 || len(resp.TablesUsed) != 1 {
+		t.Errorf("response = %+v", resp)
+	}
+	// Thinking tokens count as completion tokens
+	if resp.PromptTokens != 120 || resp.CompletionTokens != 50 || resp.Tokens != 170 {
+		t.Errorf("usage = %d + %d = %d", resp.PromptTokens, resp.CompletionTokens, resp.Tokens)
+	}
+	if resp.Model != "gemini-2.0-flash" {
+		t.Errorf("model = %q", resp.Model)
+	}
+}
+
+func TestGeminiProse(t *testing.T) {
+	var got geminiRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, `{"candidates": [{"content": {"parts": [{"text": " Revenue doubled. "}]}}]}`)
+	}))
+	defer srv.Close()
+
+	resp, err := NewGeminiProvider("k", "m", srv.URL).GenerateSQL(context.Background(), GenerateRequest{
+		Prompt: "describe", System: "Summarize.", Prose: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Text != "Revenue doubled." {
+		t.Errorf("text = %q", resp.Text)
+	}
+	if got.GenerationConfig.ResponseMIMEType != "" || got.SystemInstruction.Parts[0].Text != "Summarize." {
+		t.Errorf("prose request asked for JSON: %+v", got)
+	}
+}
+
+func TestGeminiErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		body    string
+		message string // Expected GenerateResponse.Error
+		apiErr  *APIError
+	}{
+		{
+			name:    "api error",
+			status:  http.StatusBadRequest,
+			body:    `{"error": {"code": 400, "message": "API key not valid", "status": "INVALID_ARGUMENT"}}`,
+			message: "API key not valid",
+			apiErr:  &APIError{StatusCode: 400, Message: "API key not valid"},
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			header:  map[string]string{"Retry-After": "7"},
+			body:    `not json`,
+			message: "API returned status 429",
+			apiErr:  &APIError{StatusCode: 429, RetryAfter: 7 * time.Second},
+		},
+		{
+			name:    "blocked prompt",
+			status:  http.StatusOK,
+			body:    `{"promptFeedback": {"blockReason": "SAFETY"}}`,
+			message: "prompt blocked by the model: SAFETY",
+		},
+		{
+			name:    "no candidates",
+			status:  http.StatusOK,
+			body:    `{"candidates": []}`,
+			message: "no response from model",
+		},
+		{
+			name:    "no text",
+			status:  http.StatusOK,
+			body:    `{"candidates": [{"content": {"parts": []}, "finishReason": "MAX_TOKENS"}]}`,
+			message: "no text in response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			resp, err := NewGeminiProvider("k", "m", srv.URL).GenerateSQL(context.Background(), GenerateRequest{Prompt: "q"})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if resp.Error != tt.message {
+				t.Errorf("Error = %q, want %q", resp.Error, tt.message)
+			}
+			var apiErr *APIError
+			if errors.As(err, &apiErr) != (tt.apiErr != nil) {
+				t.Fatalf("err = %v, want APIError %v", err, tt.apiErr != nil)
+			}
+			if tt.apiErr != nil && *apiErr != *tt.apiErr {
+				t.Errorf("APIError = %+v, want %+v", *apiErr, *tt.apiErr)
+			}
+		})
+	}
+}
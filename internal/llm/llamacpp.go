@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LlamaCppProvider implements the Provider interface for llama.cpp's server
+// (llama-server) completion API. A GBNF grammar constrains the output to a
+// JSON answer, so small models can't wander into prose.
+type LlamaCppProvider struct {
+	apiKey  string // Optional, for servers started with --api-key
+	baseURL string
+	client  *http.Client
+
+	// noTemplate is set once the server turns out not to have the
+	// /apply-template endpoint, after which prompts are formatted locally.
+	noTemplate atomic.Bool
+}
+
+// NewLlamaCppProvider creates a new llama.cpp server provider. The server
+// serves a single model, so none is named.
+func NewLlamaCppProvider(apiKey, baseURL string) *LlamaCppProvider {
+	return &LlamaCppProvider{
+		apiKey:  apiKey,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			// Local models are slow to generate on CPU
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// Name returns the provider name.
+func (p *LlamaCppProvider) Name() string {
+	return "llamacpp"
+}
+
+// GenerateSQL sends a prompt to the llama.cpp server and returns the
+// generated SQL.
+func (p *LlamaCppProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	system, grammar := req.SystemPrompt()+jsonAnswerInstruction, answerGrammar
+	if req.Prose {
+		system, grammar = req.SystemPrompt(), ""
+	}
+	messages := []ollamaMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: req.Prompt},
+	}
+	prompt, err := p.applyTemplate(ctx, messages)
+	if err != nil {
+		return GenerateResponse{Error: err.Error()}, err
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+
+	payload := llamaCppRequest{
+		Prompt:      prompt,
+		NPredict:    maxTokens,
+		Temperature: 0, // Deterministic for SQL generation
+		Grammar:     grammar,
+		CachePrompt: true, // The system prompt rarely changes between requests
+	}
+
+	var result llamaCppResponse
+	if err := p.post(ctx, "/completion", payload, &result); err != nil {
+		return GenerateResponse{Error: err.Error()}, err
+	}
+
+	if result.Content == "" {
+		return GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty content")
+	}
+
+	var genResp GenerateResponse
+	if req.Prose {
+		genResp = parseProse(result.Content)
+	} else {
+		genResp = parseJSONAnswer(result.Content)
+	}
+	genResp.Model = result.Model
+	genResp.setUsage(result.TokensEvaluated, result.TokensPredicted)
+
+	return genResp, nil
+}
+
+// applyTemplate formats the chat with the model's own chat template, using
+// the server's /apply-template endpoint. Older servers lack it; for those
+// the prompt falls back to a plain transcript.
+func (p *LlamaCppProvider) applyTemplate(ctx context.Context, messages []ollamaMessage) (string, error) {
+	if !p.noTemplate.Load() {
+		var result struct {
+			Prompt string `json:"prompt"`
+		}
+		err := p.post(ctx, "/apply-template", map[string]any{"messages": messages}, &result)
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			return result.Prompt, nil
+		case !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound:
+			return "", err
+		}
+		p.noTemplate.Store(true)
+	}
+
+	var sb strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&sb, "### %s:\n%s\n\n", strings.ToUpper(m.Role[:1])+m.Role[1:], m.Content)
+	}
+	sb.WriteString("### Assistant:\n")
+	return sb.String(), nil
+}
+
+// post sends a JSON request to the server and decodes the JSON response.
+func (p *LlamaCppProvider) post(ctx context.Context, path string, payload, result any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp llamaCppErrorResponse
+		_ = json.Unmarshal(respBody, &errResp)
+		return newAPIError(resp, errResp.Error.Message)
+	}
+
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// llama.cpp server request/response types
+
+type llamaCppRequest struct {
+	Prompt      string  `json:"prompt"`
+	NPredict    int     `json:"n_predict"`
+	Temperature float64 `json:"temperature"`
+	Grammar     string  `json:"grammar,omitempty"`
+	CachePrompt bool    `json:"cache_prompt"`
+}
+
+type llamaCppResponse struct {
+	Content         string `json:"content"`
+	Model           string `json:"model"` // Alias or file the server loaded
+	TokensEvaluated int    `json:"tokens_evaluated"`
+	TokensPredicted int    `json:"tokens_predicted"`
+	StoppedLimit    bool   `json:"stopped_limit"`
+}
+
+type llamaCppErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
@@ -4,8 +4,11 @@ package llm
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Provider defines the interface for LLM integrations.
@@ -21,15 +24,93 @@ type Provider interface {
 type GenerateRequest struct {
 	Prompt    string // Natural language request from user
 	Schema    string // Serialized database schema
+	Dialect   string // SQL dialect of the database, e.g. "postgres" or "mysql" (default postgres)
+	System    string // Rendered system prompt; built from Dialect and Schema when empty
 	MaxTokens int    // Max tokens for response (0 = provider default)
+
+	// Tools the model may call before answering; nil for none. Supported by
+	// the openai, azure-openai and anthropic providers, ignored by others.
+	Tools    Toolbox
+	MaxSteps int // Model turns allowed with Tools, including the answer (0 = 8)
+
+	// Prose asks for a free-text answer, returned in GenerateResponse.Text,
+	// rather than SQL. System must then be set; Tools are ignored.
+	Prose bool
+}
+
+// SystemPrompt returns the system prompt to send with the request.
+func (r GenerateRequest) SystemPrompt() string {
+	if r.System != "" {
+		return r.System
+	}
+	return BuildSystemPrompt(r.Dialect, r.Schema)
 }
 
 // GenerateResponse contains the result of SQL generation.
 type GenerateResponse struct {
-	SQL     string // Generated SQL query (empty if missing info)
-	Missing string // Explanation if request can't be fulfilled
-	Error   string // Error message if generation failed
-	Tokens  int    // Tokens used (for cost tracking)
+	SQL      string // Generated SQL query (empty if missing info)
+	Missing  string // Explanation if request can't be fulfilled
+	Error    string // Error message if generation failed
+	Provider string // Name of the chain provider that answered; empty outside a Chain
+	Model    string // Model that answered, as configured; empty when unknown
+	Text     string // Answer to a Prose request
+
+	// Tokens used (for cost tracking), summed over tool-calling steps.
+	// Replayed responses only know the total.
+	Tokens           int
+	PromptTokens     int
+	CompletionTokens int
+
+	// Stated by the model in structured answers; empty for plain text ones
+	Assumptions []string // How the model interpreted the request
+	TablesUsed  []string // Tables the model says the query reads
+	Confidence  float64  // 0 to 1
+
+	ToolCalls []ToolCall // Tools called before answering, in order
+}
+
+// setUsage records the tokens a request used.
+func (r *GenerateResponse) setUsage(prompt, completion int) {
+	r.PromptTokens, r.CompletionTokens = prompt, completion
+	r.Tokens = prompt + completion
+}
+
+// APIError is a non-success HTTP response from a provider's API.
+type APIError struct {
+	StatusCode int
+	Message    string        // Provider's error message, if it sent one
+	RetryAfter time.Duration // From the Retry-After header; 0 when absent
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return "API error: " + e.Message
+	}
+	return fmt.Sprintf("API error: status %d", e.StatusCode)
+}
+
+// newAPIError builds an APIError from a response and its decoded message.
+func newAPIError(resp *http.Response, message string) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header: delay seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
 }
 
 // IsMissing returns true if the response indicates missing information.
@@ -39,28 +120,98 @@ func (r GenerateResponse) IsMissing() bool {
 
 // Config holds LLM provider configuration.
 type Config struct {
-	Provider string // "openai" or "anthropic"
-	APIKey   string // API key for the provider
-	Model    string // Model name (e.g., "gpt-4o", "claude-sonnet-4-20250514")
-	BaseURL  string // Base URL (for OpenRouter, proxies, etc.)
+	Provider   string // "openai", "anthropic", "gemini", "azure-openai", "ollama", "llamacpp" or "replay"
+	APIKey     string // API key for the provider; optional for ollama and llamacpp
+	Model      string // Model name (e.g., "gpt-4o", "claude-sonnet-4-20250514"); the deployment name for azure-openai
+	BaseURL    string // Base URL (for OpenRouter, proxies, etc.); the resource endpoint for azure-openai
+	APIVersion string // azure-openai api-version
+	Fixtures   string // Fixture file the replay provider answers from
+	Record     string // Fixture file to record the provider's responses to
+	KeepAlive  string // How long Ollama keeps the model loaded (e.g. "30m")
+	Chain      string // Provider chain file (JSON); replaces the settings above
+	PlainText  bool   // Don't ask for structured JSON answers, for APIs that can't give them
+}
+
+// Enabled reports whether the configuration asks for a provider at all.
+// Providers that run locally need no API key.
+func (c Config) Enabled() bool {
+	switch c.Provider {
+	case "replay", "ollama", "llamacpp":
+		return true
+	}
+	return c.APIKey != "" || c.Chain != ""
 }
 
 // ConfigFromEnv reads LLM configuration from environment variables.
 func ConfigFromEnv() Config {
 	return Config{
-		Provider: strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER"))),
-		APIKey:   os.Getenv("LLM_API_KEY"),
-		Model:    os.Getenv("LLM_MODEL"),
-		BaseURL:  os.Getenv("LLM_BASE_URL"),
+		Provider:   strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER"))),
+		APIKey:     os.Getenv("LLM_API_KEY"),
+		Model:      os.Getenv("LLM_MODEL"),
+		BaseURL:    os.Getenv("LLM_BASE_URL"),
+		APIVersion: strings.TrimSpace(os.Getenv("LLM_API_VERSION")),
+		Fixtures:   strings.TrimSpace(os.Getenv("LLM_FIXTURES")),
+		Record:     strings.TrimSpace(os.Getenv("LLM_RECORD")),
+		KeepAlive:  strings.TrimSpace(os.Getenv("LLM_KEEP_ALIVE")),
+		Chain:      strings.TrimSpace(os.Getenv("LLM_CONFIG")),
+		PlainText:  envBool("LLM_PLAIN_TEXT"),
 	}
 }
 
-// NewProvider creates an LLM provider based on configuration.
+// NewProvider creates an LLM provider based on configuration: a Chain when
+// Chain is set, else a single provider. With Record set, the provider's
+// responses are also written to that fixture file.
 func NewProvider(cfg Config) (Provider, error) {
+	var provider Provider
+	var err error
+	if cfg.Chain != "" {
+		var chainCfg ChainConfig
+		if chainCfg, err = LoadChainConfig(cfg.Chain); err == nil {
+			provider, err = NewChain(chainCfg)
+		}
+	} else {
+		provider, err = newProvider(cfg)
+	}
+	if err != nil || cfg.Record == "" {
+		return provider, err
+	}
+	if cfg.Provider == "replay" {
+		return nil, fmt.Errorf("LLM_RECORD needs a real provider, not replay")
+	}
+	return NewRecordingProvider(provider, cfg.Record)
+}
+
+func newProvider(cfg Config) (Provider, error) {
 	if cfg.Provider == "" {
 		cfg.Provider = "openai"
 	}
 
+	if cfg.Provider == "replay" {
+		if cfg.Fixtures == "" {
+			return nil, fmt.Errorf("LLM_FIXTURES is required for the replay provider")
+		}
+		return NewReplayProvider(cfg.Fixtures)
+	}
+
+	// Local servers, where an API key is optional
+	switch cfg.Provider {
+	case "ollama":
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("LLM_MODEL is required for ollama (e.g. qwen2.5-coder:7b)")
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = "http://localhost:11434"
+		}
+		return NewOllamaProvider(cfg.Model, cfg.BaseURL, cfg.KeepAlive), nil
+
+	case "llamacpp":
+		// llama-server's default port is also ours, so there's no safe default
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("LLM_BASE_URL is required for llamacpp (e.g. http://localhost:8081 with llama-server --port 8081)")
+		}
+		return NewLlamaCppProvider(cfg.APIKey, cfg.BaseURL), nil
+	}
+
 	if cfg.APIKey == "" {
 		return nil, fmt.Errorf("LLM_API_KEY is required")
 	}
@@ -73,7 +224,9 @@ func NewProvider(cfg Config) (Provider, error) {
 		if cfg.BaseURL == "" {
 			cfg.BaseURL = "https://api.openai.com/v1"
 		}
-		return NewOpenAIProvider(cfg.APIKey, cfg.Model, cfg.BaseURL), nil
+		p := NewOpenAIProvider(cfg.APIKey, cfg.Model, cfg.BaseURL)
+		p.plainText = cfg.PlainText
+		return p, nil
 
 	case "anthropic":
 		if cfg.Model == "" {
@@ -82,19 +235,52 @@ func NewProvider(cfg Config) (Provider, error) {
 		if cfg.BaseURL == "" {
 			cfg.BaseURL = "https://api.anthropic.com/v1"
 		}
-		return NewAnthropicProvider(cfg.APIKey, cfg.Model, cfg.BaseURL), nil
+		p := NewAnthropicProvider(cfg.APIKey, cfg.Model, cfg.BaseURL)
+		p.plainText = cfg.PlainText
+		return p, nil
+
+	case "gemini":
+		if cfg.Model == "" {
+			cfg.Model = "gemini-2.5-flash"
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = "https://generativelanguage.googleapis.com/v1beta"
+		}
+		p := NewGeminiProvider(cfg.APIKey, cfg.Model, cfg.BaseURL)
+		p.plainText = cfg.PlainText
+		return p, nil
+
+	case "azure-openai":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("LLM_BASE_URL is required for azure-openai (e.g. https://my-resource.openai.azure.com)")
+		}
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("LLM_MODEL is required for azure-openai: set it to the deployment name")
+		}
+		if cfg.APIVersion == "" {
+			cfg.APIVersion = "2024-10-21"
+		}
+		p := NewAzureOpenAIProvider(cfg.APIKey, cfg.BaseURL, cfg.Model, cfg.APIVersion)
+		p.plainText = cfg.PlainText
+		return p, nil
 
 	default:
-		return nil, fmt.Errorf("unknown LLM provider: %q (supported: openai, anthropic)", cfg.Provider)
+		return nil, fmt.Errorf("unknown LLM provider: %q (supported: openai, anthropic, gemini, azure-openai, ollama, llamacpp, replay)", cfg.Provider)
 	}
 }
 
+func envBool(key string) bool {
+	v, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	return v
+}
+
 // NewProviderFromEnv creates an LLM provider from environment variables.
 func NewProviderFromEnv() (Provider, error) {
 	return NewProvider(ConfigFromEnv())
 }
 
-// ParseResponse extracts SQL or MISSING from raw LLM output.
+// ParseResponse extracts SQL or MISSING from raw LLM output. It is used for
+// providers in plain text mode, and when a structured answer can't be read.
 func ParseResponse(raw string) GenerateResponse {
 	trimmed := strings.TrimSpace(raw)
 
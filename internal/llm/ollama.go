@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaProvider implements the Provider interface for Ollama's native chat
+// API. Output is constrained to a JSON answer, and token usage is reported
+// from Ollama's evaluation counts.
+type OllamaProvider struct {
+	model     string
+	baseURL   string
+	keepAlive string
+	client    *http.Client
+}
+
+// NewOllamaProvider creates a new Ollama provider. keepAlive is how long the
+// model stays in memory after a request: a Go duration such as "30m", a
+// negative one to keep it loaded, or empty for Ollama's default.
+func NewOllamaProvider(model, baseURL, keepAlive string) *OllamaProvider {
+	return &OllamaProvider{
+		model:     model,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		keepAlive: keepAlive,
+		client: &http.Client{
+			// Local models are slow to load and to generate on CPU
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// Name returns the provider name.
+func (p *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+// GenerateSQL sends a prompt to Ollama and returns the generated SQL.
+func (p *OllamaProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	systemPrompt := req.SystemPrompt()
+	var format any = answerSchema
+	if req.Prose {
+		format = nil
+	} else {
+		systemPrompt += jsonAnswerInstruction
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+
+	payload := ollamaRequest{
+		Model: p.model,
+		Messages: []ollamaMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: req.Prompt},
+		},
+		Stream:    false,
+		Format:    format,
+		KeepAlive: p.keepAlive,
+		Options: ollamaOptions{
+			Temperature: 0, // Deterministic for SQL generation
+			NumPredict:  maxTokens,
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return GenerateResponse{Error: "failed to marshal request"}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return GenerateResponse{Error: "failed to create request"}, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return GenerateResponse{Error: "request failed"}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GenerateResponse{Error: "failed to read response"}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ollamaErrorResponse
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error != "" {
+			msg := errResp.Error
+			if resp.StatusCode == http.StatusNotFound {
+				msg = fmt.Sprintf("model %q is not available in Ollama (run: ollama pull %s)", p.model, p.model)
+			}
+			return GenerateResponse{Error: msg}, newAPIError(resp, errResp.Error)
+		}
+		return GenerateResponse{Error: fmt.Sprintf("API returned status %d", resp.StatusCode)}, newAPIError(resp, "")
+	}
+
+	var result ollamaResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return GenerateResponse{Error: "failed to parse response"}, err
+	}
+
+	if result.Message.Content == "" {
+		return GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty message (done reason %q)", result.DoneReason)
+	}
+
+	var genResp GenerateResponse
+	if req.Prose {
+		genResp = parseProse(result.Message.Content)
+	} else {
+		genResp = parseJSONAnswer(result.Message.Content)
+	}
+	genResp.Model = p.model
+	genResp.setUsage(result.PromptEvalCount, result.EvalCount)
+
+	return genResp, nil
+}
+
+// Ollama API request/response types
+
+type ollamaRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"`
+	Format    any             `json:"format,omitempty"` // "json" or a JSON schema
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	Options   ollamaOptions   `json:"options"`
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+type ollamaErrorResponse struct {
+	Error string `json:"error"`
+}
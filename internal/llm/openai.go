@@ -7,24 +7,49 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
 // OpenAIProvider implements the Provider interface for OpenAI-compatible APIs.
 // This works with OpenAI, OpenRouter, Together.ai, Groq, and other compatible services.
 type OpenAIProvider struct {
-	apiKey  string
-	model   string
-	baseURL string
-	client  *http.Client
+	name       string
+	model      string
+	url        string // Chat completions endpoint
+	authHeader string // Header carrying the API key
+	authValue  string
+	plainText  bool // Don't ask for a structured answer
+	client     *http.Client
 }
 
 // NewOpenAIProvider creates a new OpenAI-compatible provider.
 func NewOpenAIProvider(apiKey, model, baseURL string) *OpenAIProvider {
 	return &OpenAIProvider{
-		apiKey:  apiKey,
-		model:   model,
-		baseURL: baseURL,
+		name:       "openai",
+		model:      model,
+		url:        baseURL + "/chat/completions",
+		authHeader: "Authorization",
+		authValue:  "Bearer " + apiKey,
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// NewAzureOpenAIProvider creates a provider for an Azure OpenAI deployment.
+// Azure routes by deployment rather than model name, authenticates with an
+// api-key header and versions its API with a query parameter; endpoint is the
+// resource URL, e.g. https://my-resource.openai.azure.com.
+func NewAzureOpenAIProvider(apiKey, endpoint, deployment, apiVersion string) *OpenAIProvider {
+	return &OpenAIProvider{
+		name:  "azure-openai",
+		model: deployment,
+		url: strings.TrimSuffix(endpoint, "/") + "/openai/deployments/" + url.PathEscape(deployment) +
+			"/chat/completions?api-version=" + url.QueryEscape(apiVersion),
+		authHeader: "api-key",
+		authValue:  apiKey,
 		client: &http.Client{
 			Timeout: 60 * time.Second,
 		},
@@ -33,18 +58,40 @@ func NewOpenAIProvider(apiKey, model, baseURL string) *OpenAIProvider {
 
 // Name returns the provider name.
 func (p *OpenAIProvider) Name() string {
-	return "openai"
+	return p.name
 }
 
-// GenerateSQL sends a prompt to the OpenAI API and returns the generated SQL.
+// GenerateSQL sends a prompt to the OpenAI (or Azure OpenAI) API and returns the generated SQL.
+// With req.Tools the model may call them first; their results go back to it
+// until it answers or runs out of steps.
 func (p *OpenAIProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
-	systemPrompt := BuildSystemPrompt(req.Schema)
+	systemPrompt := req.SystemPrompt()
 
 	maxTokens := req.MaxTokens
 	if maxTokens <= 0 {
 		maxTokens = 1024
 	}
 
+	var responseFormat *openAIResponseFormat
+	if !p.plainText && !req.Prose {
+		systemPrompt += jsonAnswerInstruction
+		responseFormat = &openAIResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: openAIJSONSchema{Name: "sql_answer", Strict: true, Schema: answerSchema},
+		}
+	}
+
+	var tools []openAITool
+	if req.Tools != nil && !req.Prose {
+		systemPrompt += agentInstruction
+		for _, t := range req.Tools.Tools() {
+			tools = append(tools, openAITool{
+				Type:     "function",
+				Function: openAIFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters},
+			})
+		}
+	}
+
 	payload := openAIRequest{
 		Model: p.model,
 		Messages: []openAIMessage{
@@ -53,68 +100,158 @@ func (p *OpenAIProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (
 		},
 		MaxCompletionTokens: maxTokens,
 		Temperature:         0, // Deterministic for SQL generation
+		ResponseFormat:      responseFormat,
+		Tools:               tools,
+	}
+
+	var calls []ToolCall
+	promptTokens, completionTokens := 0, 0
+	for step := 1; ; step++ {
+		if len(tools) > 0 && step == req.maxSteps() {
+			// Last step: the model has to answer
+			payload.ToolChoice = "none"
+		}
+
+		result, errResp, err := p.complete(ctx, payload)
+		if err != nil {
+			errResp.Model, errResp.ToolCalls = p.model, calls
+			errResp.setUsage(promptTokens, completionTokens)
+			return errResp, err
+		}
+		promptTokens += result.Usage.PromptTokens
+		completionTokens += result.Usage.CompletionTokens
+
+		message := result.Choices[0].Message
+		if message.Refusal != "" {
+			refused := GenerateResponse{Error: "model refused: " + message.Refusal, Model: p.model, ToolCalls: calls}
+			refused.setUsage(promptTokens, completionTokens)
+			return refused, fmt.Errorf("refusal: %s", message.Refusal)
+		}
+
+		if len(message.ToolCalls) > 0 && len(tools) > 0 && payload.ToolChoice == "" {
+			payload.Messages = append(payload.Messages, openAIMessage{Role: "assistant", Content: message.Content, ToolCalls: message.ToolCalls})
+			for _, tc := range message.ToolCalls {
+				call, content := callTool(ctx, req.Tools, tc.Function.Name, json.RawMessage(tc.Function.Arguments))
+				calls = append(calls, call)
+				payload.Messages = append(payload.Messages, openAIMessage{Role: "tool", Content: content, ToolCallID: tc.ID})
+			}
+			continue
+		}
+
+		var genResp GenerateResponse
+		switch {
+		case req.Prose:
+			genResp = parseProse(message.Content)
+		case p.plainText:
+			genResp = ParseResponse(message.Content)
+		default:
+			genResp = parseJSONAnswer(message.Content)
+		}
+		genResp.Model = p.model
+		genResp.setUsage(promptTokens, completionTokens)
+		genResp.ToolCalls = calls
+
+		return genResp, nil
 	}
+}
+
+// complete makes one chat completion call. On error it also returns the
+// response to give the caller.
+func (p *OpenAIProvider) complete(ctx context.Context, payload openAIRequest) (openAIResponse, GenerateResponse, error) {
+	var result openAIResponse
 
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return GenerateResponse{Error: "failed to marshal request"}, err
+		return result, GenerateResponse{Error: "failed to marshal request"}, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewReader(body))
 	if err != nil {
-		return GenerateResponse{Error: "failed to create request"}, err
+		return result, GenerateResponse{Error: "failed to create request"}, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	httpReq.Header.Set(p.authHeader, p.authValue)
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return GenerateResponse{Error: "request failed"}, err
+		return result, GenerateResponse{Error: "request failed"}, err
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return GenerateResponse{Error: "failed to read response"}, err
+		return result, GenerateResponse{Error: "failed to read response"}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		var errResp openAIErrorResponse
 		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error.Message != "" {
-			return GenerateResponse{Error: errResp.Error.Message}, fmt.Errorf("API error: %s", errResp.Error.Message)
+			return result, GenerateResponse{Error: errResp.Error.Message}, newAPIError(resp, errResp.Error.Message)
 		}
-		return GenerateResponse{Error: fmt.Sprintf("API returned status %d", resp.StatusCode)}, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return result, GenerateResponse{Error: fmt.Sprintf("API returned status %d", resp.StatusCode)}, newAPIError(resp, "")
 	}
 
-	var result openAIResponse
 	if err := json.Unmarshal(respBody, &result); err != nil {
-		return GenerateResponse{Error: "failed to parse response"}, err
+		return result, GenerateResponse{Error: "failed to parse response"}, err
 	}
 
 	if len(result.Choices) == 0 {
-		return GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty choices array")
+		return result, GenerateResponse{Error: "no response from model"}, fmt.Errorf("empty choices array")
 	}
 
-	content := result.Choices[0].Message.Content
-	genResp := ParseResponse(content)
-	genResp.Tokens = result.Usage.TotalTokens
-
-	return genResp, nil
+	return result, GenerateResponse{}, nil
 }
 
 // OpenAI API request/response types
 
 type openAIRequest struct {
-	Model               string          `json:"model"`
-	Messages            []openAIMessage `json:"messages"`
-	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
-	Temperature         float64         `json:"temperature"`
+	Model               string                `json:"model"`
+	Messages            []openAIMessage       `json:"messages"`
+	MaxCompletionTokens int                   `json:"max_completion_tokens,omitempty"`
+	Temperature         float64               `json:"temperature"`
+	ResponseFormat      *openAIResponseFormat `json:"response_format,omitempty"`
+	Tools               []openAITool          `json:"tools,omitempty"`
+	ToolChoice          string                `json:"tool_choice,omitempty"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type       string           `json:"type"`
+	JSONSchema openAIJSONSchema `json:"json_schema"`
+}
+
+type openAIJSONSchema struct {
+	Name   string         `json:"name"`
+	Strict bool           `json:"strict"`
+	Schema map[string]any `json:"schema"`
 }
 
 type openAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	Refusal    string           `json:"refusal,omitempty"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON, as a string
+	} `json:"function"`
 }
 
 type openAIResponse struct {
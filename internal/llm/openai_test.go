@@ -0,0 +1,157 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const openAIAnswer = `{
+	"choices": [{"message": {"role": "assistant", "content": "{\"sql\": \"SELECT 1\", \"missing\": \"\", \"assumptions\": [], \"tables_used\": [], \"confidence\": 1}"}}],
+	"usage": {"prompt_tokens": 40, "completion_tokens": 8, "total_tokens": 48}
+}`
+
+func TestOpenAIRequestAndResponse(t *testing.T) {
+	var got openAIRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request to %s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, openAIAnswer)
+	}))
+	defer srv.Close()
+
+	resp, err := NewOpenAIProvider("secret", "gpt-4o", srv.URL+"/v1").GenerateSQL(context.Background(), GenerateRequest{
+		Prompt: "one", Schema: "t(a)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Model != "gpt-4o" || len(got.Messages) != 2 || got.Messages[0].Role != "system" ||
+		got.Messages[1].Role != "user" || got.Messages[1].Content != "one" || got.MaxCompletionTokens != 1024 {
+		t.Errorf("request = %+v", got)
+	}
+	if got.ResponseFormat == nil || got.ResponseFormat.Type != "json_schema" || !got.ResponseFormat.JSONSchema.Strict {
+		t.Errorf("response format = %+v", got.ResponseFormat)
+	}
+	if resp.SQL != "SELECT 1" || resp.Confidence != 1 || resp.Tokens != 48 || resp.PromptTokens != 40 || resp.Model != "gpt-4o" {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestAzureOpenAIRequest(t *testing.T) {
+	var got openAIRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/sql gen/chat/completions" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if v := r.URL.Query().Get("api-version"); v != "2024-10-21" {
+			t.Errorf("api-version = %q", v)
+		}
+		if key := r.Header.Get("api-key"); key != "azure-key" {
+			t.Errorf("api-key = %q", key)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Authorization header sent to Azure")
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		io.WriteString(w, openAIAnswer)
+	}))
+	defer srv.Close()
+
+	p := NewAzureOpenAIProvider("azure-key", srv.URL+"/", "sql gen", "2024-10-21")
+	if p.Name() != "azure-openai" {
+		t.Errorf("Name() = %q", p.Name())
+	}
+	resp, err := p.GenerateSQL(context.Background(), GenerateRequest{Prompt: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Model != "sql gen" {
+		t.Errorf("model = %q, want the deployment", got.Model)
+	}
+	if resp.SQL != "SELECT 1" || resp.Model != "sql gen" {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestOpenAIErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+		apiErr  *APIError
+	}{
+		{
+			name:    "api error",
+			status:  http.StatusUnauthorized,
+			body:    `{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`,
+			message: "Incorrect API key provided",
+			apiErr:  &APIError{StatusCode: 401, Message: "Incorrect API key provided"},
+		},
+		{
+			name:    "azure content filter",
+			status:  http.StatusBadRequest,
+			body:    `{"error": {"message": "The response was filtered", "type": null, "code": "content_filter"}}`,
+			message: "The response was filtered",
+			apiErr:  &APIError{StatusCode: 400, Message: "The response was filtered"},
+		},
+		{
+			name:    "server error without a body",
+			status:  http.StatusBadGateway,
+			message: "API returned status 502",
+			apiErr:  &APIError{StatusCode: 502},
+		},
+		{
+			name:    "no choices",
+			status:  http.StatusOK,
+			body:    `{"choices": []}`,
+			message: "no response from model",
+		},
+		{
+			name:    "refusal",
+			status:  http.StatusOK,
+			body:    `{"choices": [{"message": {"role": "assistant", "content": "", "refusal": "I can't help with that"}}]}`,
+			message: "model refused: I can't help with that",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			for _, p := range []*OpenAIProvider{
+				NewOpenAIProvider("k", "m", srv.URL),
+				NewAzureOpenAIProvider("k", srv.URL, "d", "2024-10-21"),
+			} {
+				resp, err := p.GenerateSQL(context.Background(), GenerateRequest{Prompt: "q"})
+				if err == nil {
+					t.Fatalf("%s: expected an error", p.Name())
+				}
+				if !strings.HasPrefix(resp.Error, tt.message) {
+					t.Errorf("%s: Error = %q, want %q", p.Name(), resp.Error, tt.message)
+				}
+				var apiErr *APIError
+				if errors.As(err, &apiErr) != (tt.apiErr != nil) {
+					t.Fatalf("%s: err = %v, want APIError %v", p.Name(), err, tt.apiErr != nil)
+				}
+				if tt.apiErr != nil && *apiErr != *tt.apiErr {
+					t.Errorf("%s: APIError = %+v, want %+v", p.Name(), *apiErr, *tt.apiErr)
+				}
+			}
+		})
+	}
+}
@@ -1,44 +1,172 @@
 package llm
 
-import "fmt"
-
-// BuildSystemPrompt constructs the system prompt with schema context for SQL generation.
-func BuildSystemPrompt(schema string) string {
-	return fmt.Sprintf(`You are a SQL query generator for a PostgreSQL database. Your job is to convert natural language requests into valid SQL queries.
-
-RULES:
-1. Output ONLY the SQL query - no explanations, no markdown code blocks, no comments
-2. Use only SELECT or WITH (CTE) statements - never INSERT, UPDATE, DELETE, DROP, or any other modifying statements
-3. Use explicit column names when practical, avoid SELECT * for large tables
-4. Include appropriate JOINs based on foreign key relationships shown in the schema
-5. Use table aliases for readability when joining multiple tables
-6. If the request is ambiguous, make reasonable assumptions and proceed
-7. Always include reasonable LIMIT clauses for potentially large result sets (default to 100 if unspecified)
-8. Format dates and timestamps in a readable way when relevant
-
-DATABASE SCHEMA:
-%s
-
-If the user's request CANNOT be answered with the available tables and columns, respond with exactly this format:
-MISSING: <explain what tables, columns, or data would be needed>
-
-Do not guess or hallucinate table/column names that don't exist in the schema above.
-
-EXAMPLES:
-
-User: "how many customers signed up last month"
-SELECT COUNT(*) AS customer_count
-FROM customers
-WHERE created_at >= date_trunc('month', current_date - interval '1 month')
-  AND created_at < date_trunc('month', current_date);
-
-User: "show me all orders with customer emails"
-SELECT o.id, o.total, o.created_at, c.email
-FROM orders o
-JOIN customers c ON o.customer_id = c.id
-ORDER BY o.created_at DESC
-LIMIT 100;
-
-User: "what's the weather today"
-MISSING: The database contains no weather-related tables. Available data includes customers, orders, and related business data. Weather information cannot be derived from the current schema.`, schema)
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+// dialectTitles are the display names templates receive as {{.Dialect}}.
+var dialectTitles = map[string]string{
+	"postgres": "PostgreSQL",
+	"mysql":    "MySQL",
+	"sqlite":   "SQLite",
+	"duckdb":   "DuckDB",
+}
+
+// PromptData fills the placeholders of a system prompt template.
+type PromptData struct {
+	Dialect      string // Display name of the SQL dialect, e.g. "PostgreSQL"
+	Schema       string // Serialized database schema
+	Glossary     string // Business terms relevant to the request, one per line; may be empty
+	Examples     string // Verified examples relevant to the request, in the few-shot format; may be empty
+	Today        string // Current date, YYYY-MM-DD
+	Timezone     string // IANA name of the zone Today is given in
+	DefaultLimit int    // Row limit to use when the request names none
+	MaxLimit     int    // Largest row limit the server accepts
+}
+
+// PromptTemplate is a parsed system prompt template.
+type PromptTemplate struct {
+	Name    string // "builtin/postgres", or the file it was read from
+	Version string // Name plus a hash of the template text, so edits show up
+	tmpl    *template.Template
+}
+
+// Render executes the template.
+func (t *PromptTemplate) Render(data PromptData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render prompt %s: %w", t.Name, err)
+	}
+	return buf.String(), nil
+}
+
+func parsePromptTemplate(name, text string) (*PromptTemplate, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt %s: %w", name, err)
+	}
+	sum := sha256.Sum256([]byte(text))
+	t := &PromptTemplate{
+		Name:    name,
+		Version: name + "@" + hex.EncodeToString(sum[:])[:12],
+		tmpl:    tmpl,
+	}
+	// Catch unknown placeholders at load time rather than on the first request
+	if _, err := t.Render(PromptData{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Prompts holds the system prompt template for each SQL dialect.
+type Prompts struct {
+	builtin   map[string]*PromptTemplate
+	overrides map[string]*PromptTemplate
+	all       *PromptTemplate // Override for every dialect
+}
+
+// LoadPrompts parses the built-in templates and, when path is set, the
+// operator's overrides: a single template file used for every dialect, or a
+// directory of <dialect>.tmpl files replacing the built-in ones they name.
+func LoadPrompts(path string) (*Prompts, error) {
+	p := &Prompts{
+		builtin:   make(map[string]*PromptTemplate),
+		overrides: make(map[string]*PromptTemplate),
+	}
+	for dialect := range dialectTitles {
+		text, err := builtinPrompts.ReadFile("prompts/" + dialect + ".tmpl")
+		if err != nil {
+			return nil, err
+		}
+		if p.builtin[dialect], err = parsePromptTemplate("builtin/"+dialect, string(text)); err != nil {
+			return nil, err
+		}
+	}
+	if path == "" {
+		return p, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prompt template: %w", err)
+	}
+	if !info.IsDir() {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read prompt template: %w", err)
+		}
+		p.all, err = parsePromptTemplate(filepath.Base(path), string(text))
+		return p, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		dialect := strings.TrimSuffix(filepath.Base(f), ".tmpl")
+		if _, ok := dialectTitles[dialect]; !ok {
+			return nil, fmt.Errorf("prompt template %s: unknown dialect %q", f, dialect)
+		}
+		text, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read prompt template: %w", err)
+		}
+		if p.overrides[dialect], err = parsePromptTemplate(filepath.Base(f), string(text)); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// For returns the template for a dialect: the operator's override if there
+// is one, else the built-in template, falling back to PostgreSQL.
+func (p *Prompts) For(dialect string) *PromptTemplate {
+	if p.all != nil {
+		return p.all
+	}
+	if t, ok := p.overrides[dialect]; ok {
+		return t
+	}
+	if t, ok := p.builtin[dialect]; ok {
+		return t
+	}
+	return p.builtin["postgres"]
+}
+
+// dialectTitle returns the display name of a dialect.
+func dialectTitle(dialect string) string {
+	if title, ok := dialectTitles[dialect]; ok {
+		return title
+	}
+	return dialectTitles["postgres"]
+}
+
+var defaultPrompts, _ = LoadPrompts("")
+
+// BuildSystemPrompt renders the built-in template for dialect ("postgres",
+// "mysql", ...; unknown values fall back to PostgreSQL) with the given schema,
+// today's date in UTC and a default limit of 100 rows.
+func BuildSystemPrompt(dialect, schema string) string {
+	prompt, _ := defaultPrompts.For(dialect).Render(PromptData{
+		Dialect:      dialectTitle(dialect),
+		Schema:       schema,
+		Today:        time.Now().UTC().Format(time.DateOnly),
+		Timezone:     "UTC",
+		DefaultLimit: 100,
+		MaxLimit:     1000,
+	})
+	return prompt
 }
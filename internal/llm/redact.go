@@ -0,0 +1,570 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// redactedComment replaces the parts of column comments matching a pattern.
+const redactedComment = "[redacted]"
+
+// redactInstruction is appended to the system prompt when the request may
+// hold placeholders for withheld values.
+const redactInstruction = `
+
+REDACTED VALUES: literal values such as emails, phone numbers and card numbers have been replaced with placeholders like PII_EMAIL_1. Use a placeholder exactly as written wherever you need its value, e.g. WHERE email = 'PII_EMAIL_1', and never guess the value behind it.`
+
+// PII kinds detected in prompts.
+const (
+	PIIEmail = "email"
+	PIIPhone = "phone"
+	PIICard  = "card"
+)
+
+// RedactConfig is the on-disk redaction file (JSON).
+type RedactConfig struct {
+	Tables   []string `json:"tables"`   // [schema.]table globs left out of the schema sent to the LLM
+	Columns  []string `json:"columns"`  // [[schema.]table.]column globs left out likewise
+	Comments []string `json:"comments"` // Regular expressions; matching parts of column comments are replaced
+	PII      []string `json:"pii"`      // Kinds tokenized in prompts; all when absent, none when empty
+}
+
+// Redactor removes sensitive details from what is sent to an LLM provider:
+// configured tables and columns, parts of column comments, and PII in
+// prompts, which is swapped for placeholders and put back in the answer.
+type Redactor struct {
+	tables   [][]string // Dotted pattern segments, table last
+	columns  [][]string // Dotted pattern segments, column last
+	comments []*regexp.Regexp
+	pii      []piiKind
+}
+
+type piiKind struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+var (
+	cardPattern  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	emailPattern = regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}\b`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{1,4}\)[ .\-]?)?\b\d{2,4}(?:[ .\-]\d{2,4}){1,4}\b`)
+
+	// Digit groups that look like phone numbers but aren't
+	datePattern  = regexp.MustCompile(`^(?:\d{4}[\-./]\d{1,2}[\-./]\d{1,2}|\d{1,2}[\-./]\d{1,2}[\-./]\d{4})$`)
+	ipv4Pattern  = regexp.MustCompile(`^\d{1,3}(?:\.\d{1,3}){3}$`)
+	localPattern = regexp.MustCompile(`^\d{3}[ .\-]\d{4}$`)
+
+	placeholderPattern = regexp.MustCompile(`\bPII_(?:EMAIL|PHONE|CARD)_\d+\b`)
+)
+
+// piiKinds are the detectors, in the order they run: card numbers before
+// phone numbers, which would otherwise claim their digit groups.
+var piiKinds = []piiKind{
+	{name: PIICard, re: cardPattern, valid: luhn},
+	{name: PIIEmail, re: emailPattern},
+	{name: PIIPhone, re: phonePattern, valid: phoneLike},
+}
+
+// LoadRedactor reads and compiles a redaction file.
+func LoadRedactor(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read redact config: %w", err)
+	}
+	var cfg RedactConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse redact config: %w", err)
+	}
+	return NewRedactor(cfg)
+}
+
+// NewRedactor compiles a redaction config.
+func NewRedactor(cfg RedactConfig) (*Redactor, error) {
+	r := &Redactor{}
+	var err error
+	if r.tables, err = compileRedactPatterns(cfg.Tables, 2, "[schema.]table"); err != nil {
+		return nil, fmt.Errorf("tables: %w", err)
+	}
+	if r.columns, err = compileRedactPatterns(cfg.Columns, 3, "[[schema.]table.]column"); err != nil {
+		return nil, fmt.Errorf("columns: %w", err)
+	}
+	for i, c := range cfg.Comments {
+		re, err := regexp.Compile(c)
+		if err != nil {
+			return nil, fmt.Errorf("comments: pattern %d: %w", i+1, err)
+		}
+		r.comments = append(r.comments, re)
+	}
+
+	kinds := make(map[string]bool)
+	for _, name := range cfg.PII {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.ContainsFunc(piiKinds, func(k piiKind) bool { return k.name == name }) {
+			return nil, fmt.Errorf("pii: unknown kind %q (want email, phone or card)", name)
+		}
+		kinds[name] = true
+	}
+	for _, k := range piiKinds {
+		if cfg.PII == nil || kinds[k.name] {
+			r.pii = append(r.pii, k)
+		}
+	}
+	return r, nil
+}
+
+func compileRedactPatterns(patterns []string, maxSegs int, want string) ([][]string, error) {
+	var out [][]string
+	for _, p := range patterns {
+		segs := strings.Split(strings.ToLower(strings.TrimSpace(p)), ".")
+		if len(segs) > maxSegs || slices.Contains(segs, "") {
+			return nil, fmt.Errorf("invalid pattern %q: want %s", p, want)
+		}
+		for _, s := range segs {
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+		}
+		out = append(out, segs)
+	}
+	return out, nil
+}
+
+// matchName reports whether pattern segments match a dotted name, comparing
+// from the right: a pattern without a schema matches a table in any schema.
+func matchName(pattern []string, name ...string) bool {
+	if len(pattern) > len(name) {
+		return false
+	}
+	name = name[len(name)-len(pattern):]
+	for i, seg := range pattern {
+		if ok, _ := path.Match(seg, strings.ToLower(name[i])); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Redactor) dropsTable(schemaName, table string) bool {
+	return slices.ContainsFunc(r.tables, func(p []string) bool { return matchName(p, schemaName, table) })
+}
+
+func (r *Redactor) dropsColumn(schemaName, table, column string) bool {
+	return slices.ContainsFunc(r.columns, func(p []string) bool { return matchName(p, schemaName, table, column) })
+}
+
+// SchemaFilter hides the configured tables and columns, along with foreign
+// keys and indexes that mention them, and scrubs column comments.
+func (r *Redactor) SchemaFilter() schema.Filter {
+	return func(t schema.Table) (schema.Table, bool) {
+		if r.dropsTable(t.Schema, t.Name) {
+			return schema.Table{}, false
+		}
+
+		dropped := make(map[string]bool)
+		columns := make([]schema.Column, 0, len(t.Columns))
+		for _, c := range t.Columns {
+			if r.dropsColumn(t.Schema, t.Name, c.Name) {
+				dropped[c.Name] = true
+				continue
+			}
+			c.Comment = r.scrubComment(c.Comment)
+			columns = append(columns, c)
+		}
+		t.Columns = columns
+
+		var fks []schema.ForeignKey
+		for _, fk := range t.ForeignKeys {
+			if dropped[fk.Column] || r.dropsTable(t.Schema, fk.ForeignTable) ||
+				r.dropsColumn(t.Schema, fk.ForeignTable, fk.ForeignColumn) {
+				continue
+			}
+			fks = append(fks, fk)
+		}
+		t.ForeignKeys = fks
+
+		var indexes []schema.Index
+		for _, idx := range t.Indexes {
+			if !slices.ContainsFunc(idx.Columns, func(c string) bool { return dropped[c] }) {
+				indexes = append(indexes, idx)
+			}
+		}
+		t.Indexes = indexes
+		return t, true
+	}
+}
+
+func (r *Redactor) scrubComment(comment string) string {
+	for _, re := range r.comments {
+		comment = re.ReplaceAllString(comment, redactedComment)
+	}
+	return comment
+}
+
+// AllowsQuery reports whether a query stays clear of the redacted tables and
+// columns, e.g. before it's shown to the LLM as an example or its rows are
+// returned to it. Unqualified relations are looked up in tables, the source's
+// catalog. A * or whole-row reference over a table with withheld columns
+// counts as naming them.
+func (r *Redactor) AllowsQuery(q *sqlparse.Query, tables []schema.Table) bool {
+	// The schemas each relation may live in
+	schemas := make(map[string][]string, len(q.Relations))
+	for _, rel := range q.Relations {
+		if rel.Schema != "" {
+			schemas[rel.RefName()] = []string{rel.Schema}
+			continue
+		}
+		for _, t := range tables {
+			if strings.EqualFold(t.Name, rel.Name) {
+				schemas[rel.RefName()] = append(schemas[rel.RefName()], t.Schema)
+			}
+		}
+	}
+
+	for _, rel := range q.Relations {
+		for _, s := range schemas[rel.RefName()] {
+			if r.dropsTable(s, rel.Name) {
+				return false
+			}
+		}
+	}
+
+	// expands reports whether every column of rel could reach the result
+	// through a reference named ref
+	expands := func(ref string, rel sqlparse.Relation) bool {
+		return ref == "" || strings.EqualFold(ref, rel.RefName()) || strings.EqualFold(ref, rel.Name)
+	}
+	hidesColumns := func(ref string) bool {
+		for _, rel := range q.Relations {
+			if !expands(ref, rel) {
+				continue
+			}
+			for _, s := range schemas[rel.RefName()] {
+				if r.dropsAnyColumn(s, rel.Name, tables) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, qualifier := range q.Stars {
+		if hidesColumns(qualifier) {
+			return false
+		}
+	}
+	// Column aliases rename columns positionally, so any could be withheld
+	for _, rel := range q.Relations {
+		if len(rel.ColumnAliases) > 0 && hidesColumns(rel.RefName()) {
+			return false
+		}
+	}
+
+	for _, col := range q.Columns {
+		// A bare relation name is a whole-row reference, e.g. row_to_json(u)
+		if col.Qualifier == "" && slices.ContainsFunc(q.Relations, func(rel sqlparse.Relation) bool {
+			return strings.EqualFold(col.Name, rel.RefName())
+		}) && hidesColumns(col.Name) {
+			return false
+		}
+		qualifier := col.Qualifier
+		if !slices.ContainsFunc(q.Relations, func(rel sqlparse.Relation) bool {
+			return strings.EqualFold(qualifier, rel.RefName())
+		}) {
+			qualifier = "" // Not a table of the query, e.g. a subquery alias: check them all
+		}
+		for _, rel := range q.Relations {
+			if qualifier != "" && !strings.EqualFold(qualifier, rel.RefName()) {
+				continue
+			}
+			for _, s := range schemas[rel.RefName()] {
+				if r.dropsColumn(s, rel.Name, col.Name) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// dropsAnyColumn reports whether a table has a withheld column. Tables missing
+// from the catalog count when any column pattern could apply to them.
+func (r *Redactor) dropsAnyColumn(schemaName, table string, tables []schema.Table) bool {
+	for _, t := range tables {
+		if strings.EqualFold(t.Schema, schemaName) && strings.EqualFold(t.Name, table) {
+			return slices.ContainsFunc(t.Columns, func(c schema.Column) bool {
+				return r.dropsColumn(t.Schema, t.Name, c.Name)
+			})
+		}
+	}
+	return slices.ContainsFunc(r.columns, func(p []string) bool {
+		return matchName(p[:len(p)-1], schemaName, table)
+	})
+}
+
+// Describe summarizes what the redactor removes from a schema, for the log.
+// It returns "" when nothing is removed.
+func (r *Redactor) Describe(tables []schema.Table) string {
+	var droppedTables, droppedColumns []string
+	scrubbed := 0
+	for _, t := range tables {
+		name := t.Name
+		if t.Schema != "" {
+			name = t.Schema + "." + t.Name
+		}
+		if r.dropsTable(t.Schema, t.Name) {
+			droppedTables = append(droppedTables, name)
+			continue
+		}
+		for _, c := range t.Columns {
+			switch {
+			case r.dropsColumn(t.Schema, t.Name, c.Name):
+				droppedColumns = append(droppedColumns, name+"."+c.Name)
+			case c.Comment != "" && r.scrubComment(c.Comment) != c.Comment:
+				scrubbed++
+			}
+		}
+	}
+
+	var parts []string
+	if len(droppedTables) > 0 {
+		parts = append(parts, fmt.Sprintf("tables %s", strings.Join(droppedTables, ", ")))
+	}
+	if len(droppedColumns) > 0 {
+		parts = append(parts, fmt.Sprintf("columns %s", strings.Join(droppedColumns, ", ")))
+	}
+	if scrubbed > 0 {
+		parts = append(parts, fmt.Sprintf("%d column comments scrubbed", scrubbed))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Wrap returns a provider that tokenizes PII in requests to inner and
+// restores it in the answers.
+func (r *Redactor) Wrap(inner Provider) *RedactingProvider {
+	return &RedactingProvider{inner: inner, redactor: r}
+}
+
+// RedactingProvider wraps a provider, replacing PII in prompts and tool
+// results with placeholders such as PII_EMAIL_1 and putting the values back
+// in the SQL, explanations and tool calls of the response.
+type RedactingProvider struct {
+	inner    Provider
+	redactor *Redactor
+}
+
+// Name returns the wrapped provider's name.
+func (p *RedactingProvider) Name() string {
+	return p.inner.Name()
+}
+
+// GenerateSQL redacts the request, calls the wrapped provider and restores
+// the withheld values in its response.
+func (p *RedactingProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	if len(p.redactor.pii) == 0 {
+		return p.inner.GenerateSQL(ctx, req)
+	}
+
+	tokens := &piiTokens{kinds: p.redactor.pii, values: make(map[string]string), byValue: make(map[string]string)}
+	req.Prompt = tokens.tokenize(req.Prompt)
+	if counts := tokens.counts(); counts != "" {
+		log.Printf("llm: redacted %s from the prompt", counts)
+	}
+	promptValues := len(tokens.values)
+
+	if req.Tools != nil && !req.Prose {
+		req.Tools = &redactingToolbox{inner: req.Tools, tokens: tokens}
+	}
+	if promptValues > 0 || (req.Tools != nil && !req.Prose) {
+		req.System = req.SystemPrompt() + redactInstruction
+	}
+
+	resp, err := p.inner.GenerateSQL(ctx, req)
+	if n := tokens.len() - promptValues; n > 0 {
+		log.Printf("llm: redacted %d values from tool results", n)
+	}
+
+	resp.SQL = tokens.restore(resp.SQL, sqlEscape)
+	resp.Missing = tokens.restore(resp.Missing, nil)
+	resp.Text = tokens.restore(resp.Text, nil)
+	for i, a := range resp.Assumptions {
+		resp.Assumptions[i] = tokens.restore(a, nil)
+	}
+	for i, call := range resp.ToolCalls {
+		call.Arguments = json.RawMessage(tokens.restore(string(call.Arguments), toolArgEscape))
+		call.Result = tokens.restore(call.Result, jsonEscape)
+		call.Error = tokens.restore(call.Error, nil)
+		resp.ToolCalls[i] = call
+	}
+	return resp, err
+}
+
+// redactingToolbox puts withheld values back into the arguments of the
+// model's tool calls and withholds the PII in their results.
+type redactingToolbox struct {
+	inner  Toolbox
+	tokens *piiTokens
+}
+
+func (t *redactingToolbox) Tools() []Tool {
+	return t.inner.Tools()
+}
+
+func (t *redactingToolbox) Call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	args = json.RawMessage(t.tokens.restore(string(args), toolArgEscape))
+	result, err := t.inner.Call(ctx, name, args)
+	if err != nil {
+		return "", errors.New(t.tokens.tokenize(err.Error()))
+	}
+	return t.tokens.tokenize(result), nil
+}
+
+// piiTokens holds the placeholders of one request. The same value always
+// gets the same placeholder.
+type piiTokens struct {
+	kinds []piiKind
+
+	mu      sync.Mutex
+	values  map[string]string // Placeholder to value
+	byValue map[string]string // Value to placeholder
+	perKind map[string]int
+}
+
+func (t *piiTokens) tokenize(s string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, kind := range t.kinds {
+		s = kind.re.ReplaceAllStringFunc(s, func(v string) string {
+			if kind.valid != nil && !kind.valid(v) {
+				return v
+			}
+			if ph, ok := t.byValue[v]; ok {
+				return ph
+			}
+			if t.perKind == nil {
+				t.perKind = make(map[string]int)
+			}
+			t.perKind[kind.name]++
+			ph := "PII_" + strings.ToUpper(kind.name) + "_" + strconv.Itoa(t.perKind[kind.name])
+			t.values[ph] = v
+			t.byValue[v] = ph
+			return ph
+		})
+	}
+	return s
+}
+
+// restore replaces placeholders with their values, passed through escape
+// when it isn't nil. Unknown placeholders are left alone.
+func (t *piiTokens) restore(s string, escape func(string) string) string {
+	if s == "" {
+		return s
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(s, func(ph string) string {
+		v, ok := t.values[ph]
+		if !ok {
+			return ph
+		}
+		if escape != nil {
+			return escape(v)
+		}
+		return v
+	})
+}
+
+func (t *piiTokens) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.values)
+}
+
+// counts describes the values withheld so far, e.g. "2 emails, 1 phone".
+func (t *piiTokens) counts() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	kinds := make([]string, 0, len(t.perKind))
+	for k := range t.perKind {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, k := range kinds {
+		n := t.perKind[k]
+		if n == 1 {
+			parts[i] = "1 " + k
+		} else {
+			parts[i] = fmt.Sprintf("%d %ss", n, k)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sqlEscape prepares a value for a SQL string literal.
+func sqlEscape(v string) string {
+	return strings.ReplaceAll(v, "'", "''")
+}
+
+// jsonEscape prepares a value for a JSON string.
+func jsonEscape(v string) string {
+	b, _ := json.Marshal(v)
+	return string(b[1 : len(b)-1])
+}
+
+// toolArgEscape prepares a value for a SQL literal inside a JSON argument.
+func toolArgEscape(v string) string {
+	return jsonEscape(sqlEscape(v))
+}
+
+// luhn reports whether a run of digits, spaces and dashes passes the Luhn
+// check card numbers carry.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// phoneLike weeds out dates, IP addresses and number ranges from the phone
+// pattern's matches.
+func phoneLike(s string) bool {
+	digits, groups := 0, 1
+	for i, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case i > 0 && (c == ' ' || c == '.' || c == '-'):
+			groups++
+		}
+	}
+	if digits < 7 || digits > 15 || datePattern.MatchString(s) || ipv4Pattern.MatchString(s) {
+		return false
+	}
+	return strings.ContainsAny(s, "+(") || groups >= 3 || localPattern.MatchString(s)
+}
@@ -0,0 +1,52 @@
+package llm
+
+import (
+	"testing"
+
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+func TestRedactorAllowsQuery(t *testing.T) {
+	r, err := NewRedactor(RedactConfig{Tables: []string{"secrets"}, Columns: []string{"users.ssn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []schema.Table{
+		{Schema: "public", Name: "users", Columns: []schema.Column{{Name: "id"}, {Name: "name"}, {Name: "ssn"}}},
+		{Schema: "public", Name: "orders", Columns: []schema.Column{{Name: "id"}, {Name: "user_id"}}},
+		{Schema: "public", Name: "secrets", Columns: []schema.Column{{Name: "id"}}},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT id, name FROM users", true},
+		{"SELECT * FROM orders", true},
+		{"SELECT o.* FROM orders o JOIN users u ON u.id = o.user_id", true},
+		{"SELECT ssn FROM users", false},
+		{"SELECT u.ssn FROM users u", false},
+		{"SELECT id FROM secrets", false},
+		{"SELECT * FROM users", false},
+		{"SELECT u.* FROM orders o JOIN users u ON u.id = o.user_id", false},
+		{"SELECT * FROM orders o JOIN users u ON u.id = o.user_id", false},
+		{"TABLE users", false},
+		{"SELECT row_to_json(u) FROM users u", false},
+		{"WITH x AS (SELECT * FROM users) SELECT name FROM x", false},
+		{"SELECT u.ssn FROM (users u CROSS JOIN orders o)", false},
+		{"SELECT u.s FROM users u(i, n, s)", false},
+		{"SELECT o.a FROM orders o(a, b)", true},
+		{"SELECT x.ssn FROM users u", false},
+		{"SELECT s.name FROM (SELECT name FROM users) s", true},
+	}
+	for _, tt := range tests {
+		q, err := sqlparse.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.query, err)
+		}
+		if got := r.AllowsQuery(q, tables); got != tt.want {
+			t.Errorf("AllowsQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
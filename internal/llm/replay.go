@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoFixture is returned by the replay provider for a request it has no
+// recorded response for.
+var ErrNoFixture = errors.New("no recorded response for this request")
+
+// Fixture is a recorded response, one JSON object per line of a fixture file.
+// Hand-written fixtures may leave out the key and match on the prompt, and
+// leave out the dialect to match every dialect.
+type Fixture struct {
+	Key         string    `json:"key"` // FixtureKey of the request
+	Prompt      string    `json:"prompt"`
+	Dialect     string    `json:"dialect,omitempty"`
+	SQL         string    `json:"sql,omitempty"`
+	Missing     string    `json:"missing,omitempty"`
+	Text        string    `json:"text,omitempty"` // Answer to a prose request, e.g. a summary
+	Tokens      int       `json:"tokens,omitempty"`
+	Assumptions []string  `json:"assumptions,omitempty"`
+	TablesUsed  []string  `json:"tablesUsed,omitempty"`
+	Confidence  float64   `json:"confidence,omitempty"`
+	Provider    string    `json:"provider,omitempty"` // Provider that produced the response
+	RecordedAt  time.Time `json:"recordedAt"`
+}
+
+// FixtureKey hashes the parts of a request that determine its answer: the
+// dialect, the schema and the prompt. The rendered system prompt is left out
+// since it contains today's date.
+func FixtureKey(req GenerateRequest) string {
+	h := sha256.New()
+	for _, part := range []string{dialectOrDefault(req.Dialect), req.Schema, normalizePrompt(req.Prompt)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func dialectOrDefault(dialect string) string {
+	if dialect == "" {
+		return "postgres"
+	}
+	return dialect
+}
+
+// normalizePrompt ignores case and whitespace differences between prompts.
+func normalizePrompt(prompt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
+
+// ReplayProvider answers from a fixture file without any network access.
+// Requests are matched by FixtureKey; failing that, by prompt and dialect
+// alone, so fixtures survive schema changes and per-user schema filtering.
+// When several fixtures match, the last one recorded wins.
+type ReplayProvider struct {
+	byKey    map[string]Fixture
+	byPrompt map[string]Fixture
+}
+
+// NewReplayProvider loads the fixtures in path.
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	fixtures, err := LoadFixtures(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &ReplayProvider{
+		byKey:    make(map[string]Fixture),
+		byPrompt: make(map[string]Fixture),
+	}
+	for _, f := range fixtures {
+		if f.Key != "" {
+			p.byKey[f.Key] = f
+		}
+		p.byPrompt[promptKey(f.Dialect, f.Prompt)] = f
+	}
+	return p, nil
+}
+
+// promptKey indexes fixtures by prompt. Fixtures without a dialect are
+// indexed under "" and match every dialect.
+func promptKey(dialect, prompt string) string {
+	return dialect + "\x00" + normalizePrompt(prompt)
+}
+
+// LoadFixtures reads a fixture file.
+func LoadFixtures(path string) ([]Fixture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixtures: %w", err)
+	}
+	defer f.Close()
+
+	var fixtures []Fixture
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var fx Fixture
+		if err := json.Unmarshal([]byte(line), &fx); err != nil {
+			return nil, fmt.Errorf("fixtures line %d: %w", n, err)
+		}
+		if fx.Key == "" && fx.Prompt == "" {
+			return nil, fmt.Errorf("fixtures line %d: key or prompt is required", n)
+		}
+		fixtures = append(fixtures, fx)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read fixtures: %w", err)
+	}
+	return fixtures, nil
+}
+
+// Name returns the provider name.
+func (p *ReplayProvider) Name() string {
+	return "replay"
+}
+
+// GenerateSQL returns the recorded response for the request.
+func (p *ReplayProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	f, ok := p.byKey[FixtureKey(req)]
+	if !ok {
+		f, ok = p.byPrompt[promptKey(dialectOrDefault(req.Dialect), req.Prompt)]
+	}
+	if !ok {
+		f, ok = p.byPrompt[promptKey("", req.Prompt)]
+	}
+	if !ok {
+		return GenerateResponse{Error: ErrNoFixture.Error()}, ErrNoFixture
+	}
+	return GenerateResponse{
+		SQL:         f.SQL,
+		Missing:     f.Missing,
+		Text:        f.Text,
+		Tokens:      f.Tokens,
+		Assumptions: f.Assumptions,
+		TablesUsed:  f.TablesUsed,
+		Confidence:  f.Confidence,
+	}, nil
+}
+
+// RecordingProvider wraps a provider and appends each successful response to
+// a fixture file for the replay provider.
+type RecordingProvider struct {
+	inner Provider
+	path  string
+	mu    sync.Mutex
+}
+
+// NewRecordingProvider records inner's responses to path, creating it if
+// needed and appending to it otherwise.
+func NewRecordingProvider(inner Provider, path string) (*RecordingProvider, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open fixtures: %w", err)
+	}
+	f.Close()
+	return &RecordingProvider{inner: inner, path: path}, nil
+}
+
+// Name returns the wrapped provider's name.
+func (p *RecordingProvider) Name() string {
+	return p.inner.Name()
+}
+
+// GenerateSQL calls the wrapped provider and records its response. Failing to
+// record fails the request, so a recording session can't silently miss one.
+func (p *RecordingProvider) GenerateSQL(ctx context.Context, req GenerateRequest) (GenerateResponse, error) {
+	resp, err := p.inner.GenerateSQL(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if err := p.record(req, resp); err != nil {
+		return GenerateResponse{Error: "failed to record response"}, err
+	}
+	return resp, nil
+}
+
+func (p *RecordingProvider) record(req GenerateRequest, resp GenerateResponse) error {
+	line, err := json.Marshal(Fixture{
+		Key:         FixtureKey(req),
+		Prompt:      req.Prompt,
+		Dialect:     dialectOrDefault(req.Dialect),
+		SQL:         resp.SQL,
+		Missing:     resp.Missing,
+		Text:        resp.Text,
+		Tokens:      resp.Tokens,
+		Assumptions: resp.Assumptions,
+		TablesUsed:  resp.TablesUsed,
+		Confidence:  resp.Confidence,
+		Provider:    cmp.Or(resp.Provider, p.inner.Name()),
+		RecordedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open fixtures: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write fixtures: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stubProvider answers every request with resp.
+type stubProvider struct {
+	resp  GenerateResponse
+	err   error
+	calls int
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) GenerateSQL(context.Context, GenerateRequest) (GenerateResponse, error) {
+	p.calls++
+	return p.resp, p.err
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.jsonl")
+	inner := &stubProvider{resp: GenerateResponse{
+		SQL:         "SELECT count(*) FROM users",
+		Tokens:      42,
+		Assumptions: []string{"users are rows of users"},
+		TablesUsed:  []string{"users"},
+		Confidence:  0.8,
+	}}
+	rec, err := NewRecordingProvider(inner, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := GenerateRequest{Prompt: "How many users?", Schema: "users(id)", Dialect: "mysql"}
+	if _, err := rec.GenerateSQL(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures aren't recorded
+	inner.err = errors.New("boom")
+	if _, err := rec.GenerateSQL(context.Background(), GenerateRequest{Prompt: "other"}); err == nil {
+		t.Fatal("expected the inner error")
+	}
+	fixtures, err := LoadFixtures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 1 || fixtures[0].Provider != "stub" || fixtures[0].Dialect != "mysql" {
+		t.Fatalf("fixtures = %+v", fixtures)
+	}
+
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		req  GenerateRequest
+		ok   bool
+	}{
+		{"same request", req, true},
+		{"prompt case and spacing", GenerateRequest{Prompt: "  how many   USERS? ", Schema: "users(id)", Dialect: "mysql"}, true},
+		{"changed schema", GenerateRequest{Prompt: "How many users?", Schema: "users(id, name)", Dialect: "mysql"}, true},
+		{"other dialect", GenerateRequest{Prompt: "How many users?", Schema: "users(id)", Dialect: "postgres"}, false},
+		{"other prompt", GenerateRequest{Prompt: "How many orders?", Schema: "users(id)", Dialect: "mysql"}, false},
+	}
+	for _, tt := range tests {
+		resp, err := replay.GenerateSQL(context.Background(), tt.req)
+		if !tt.ok {
+			if !errors.Is(err, ErrNoFixture) {
+				t.Errorf("%s: err = %v, want ErrNoFixture", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if resp.SQL != inner.resp.SQL || resp.Tokens != 42 || resp.Confidence != 0.8 ||
+			!slices.Equal(resp.Assumptions, inner.resp.Assumptions) || !slices.Equal(resp.TablesUsed, inner.resp.TablesUsed) {
+			t.Errorf("%s: replayed %+v", tt.name, resp)
+		}
+	}
+}
+
+func TestReplayHandWrittenFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.jsonl")
+	data := `{"prompt": "top customers", "sql": "SELECT 1"}
+
+{"prompt": "Top customers", "sql": "SELECT 2"}
+{"prompt": "top customers", "dialect": "sqlite", "sql": "SELECT 3"}
+{"prompt": "summarize", "text": "Sales rose."}
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for dialect, want := range map[string]string{"": "SELECT 2", "postgres": "SELECT 2", "sqlite": "SELECT 3"} {
+		resp, err := replay.GenerateSQL(context.Background(), GenerateRequest{Prompt: "top customers", Dialect: dialect})
+		if err != nil || resp.SQL != want {
+			t.Errorf("dialect %q: %q, %v; want %q", dialect, resp.SQL, err, want)
+		}
+	}
+	resp, err := replay.GenerateSQL(context.Background(), GenerateRequest{Prompt: "summarize", Prose: true})
+	if err != nil || resp.Text != "Sales rose." {
+		t.Errorf("prose: %+v, %v", resp, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"sql": "SELECT 1"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFixtures(path); err == nil {
+		t.Error("fixture without key or prompt accepted")
+	}
+}
@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxSteps bounds the model turns of a tool-calling request.
+	defaultMaxSteps = 8
+
+	// maxToolResult bounds the tool output sent back to the model.
+	maxToolResult = 4000
+)
+
+// agentInstruction is appended to the system prompt when tools are offered.
+const agentInstruction = `
+
+TOOLS: before answering you may call the tools provided to explore the database, for instance to check the distinct values of a status column or how two tables join. Call them only when the schema above leaves you unsure, and keep calls few; you have a limited number of steps.`
+
+// Tool describes a server-side function the model may call.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any // JSON schema of the arguments object
+}
+
+// Toolbox runs the tools a model calls while working on a request.
+type Toolbox interface {
+	Tools() []Tool
+
+	// Call runs a tool. An error is reported to the model, which may try
+	// again, rather than failing the request.
+	Call(ctx context.Context, name string, args json.RawMessage) (string, error)
+}
+
+// ToolCall records one tool call made during generation.
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Result    string          `json:"result,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// maxSteps returns the model turns allowed for the request.
+func (r GenerateRequest) maxSteps() int {
+	if r.MaxSteps > 0 {
+		return r.MaxSteps
+	}
+	return defaultMaxSteps
+}
+
+// callTool runs one tool call and returns its record along with the text to
+// send back to the model.
+func callTool(ctx context.Context, tools Toolbox, name string, args json.RawMessage) (ToolCall, string) {
+	if len(args) == 0 || !json.Valid(args) {
+		args = json.RawMessage("{}")
+	}
+	call := ToolCall{Name: name, Arguments: args}
+	result, err := tools.Call(ctx, name, args)
+	if err != nil {
+		call.Error = err.Error()
+		return call, "error: " + err.Error()
+	}
+	call.Result = truncate(result, maxToolResult)
+	return call, call.Result
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "\n[truncated]"
+}
@@ -0,0 +1,265 @@
+// Package mask hides sensitive values in query results, such as emails shown
+// as j***@example.com or phone numbers reduced to their last four digits.
+//
+// Rules select result columns either by a dotted key, [[schema.]table.]column,
+// where each segment is a glob, or by a regular expression on the result
+// column name. Keyed rules apply when the query reads from a matching table and
+// returns a column of that name, so aliasing a column (email AS e) escapes
+// them; pair sensitive columns with a regex rule or an access policy deny.
+package mask
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// Strategy is how a masked value is rewritten.
+type Strategy string
+
+const (
+	Redact  Strategy = "redact"  // Replace the whole value
+	Partial Strategy = "partial" // Keep the first letter of an email's local part, or the last few characters
+	Hash    Strategy = "hash"    // Keyed hash: hides the value but keeps equal values equal
+	Null    Strategy = "null"    // Replace with NULL
+)
+
+// redacted replaces values under the redact strategy.
+const redacted = "[REDACTED]"
+
+// defaultKeep is how many trailing characters partial masking leaves visible.
+const defaultKeep = 4
+
+// Config is the on-disk masking file (JSON).
+type Config struct {
+	DefaultSchema string       `json:"defaultSchema"` // Schema for unqualified tables, default "public"
+	UnmaskRoles   []string     `json:"unmaskRoles"`   // Roles that see raw values
+	HashKey       string       `json:"hashKey"`       // Key for the hash strategy; random per process when empty
+	Rules         []RuleConfig `json:"rules"`
+}
+
+// RuleConfig selects columns by Column or Match (one of the two) and masks them.
+type RuleConfig struct {
+	Column   string   `json:"column"` // [[schema.]table.]column glob
+	Match    string   `json:"match"`  // Regular expression on the result column name
+	Strategy Strategy `json:"strategy"`
+	Keep     int      `json:"keep"` // Partial: trailing characters left visible
+}
+
+// Masker applies compiled masking rules.
+type Masker struct {
+	defaultSchema string
+	unmaskRoles   []string
+	hashKey       []byte
+	rules         []rule
+}
+
+type rule struct {
+	key      []string // Dotted key segments, column last; nil for regex rules
+	match    *regexp.Regexp
+	strategy Strategy
+	keep     int
+}
+
+// Load reads and compiles a masking file.
+func Load(path string) (*Masker, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mask config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse mask config: %w", err)
+	}
+	return New(cfg)
+}
+
+// New compiles a masking config.
+func New(cfg Config) (*Masker, error) {
+	m := &Masker{
+		defaultSchema: strings.ToLower(cfg.DefaultSchema),
+		unmaskRoles:   cfg.UnmaskRoles,
+		hashKey:       []byte(cfg.HashKey),
+	}
+	if m.defaultSchema == "" {
+		m.defaultSchema = "public"
+	}
+	if len(m.hashKey) == 0 {
+		m.hashKey = make([]byte, 32)
+		if _, err := rand.Read(m.hashKey); err != nil {
+			return nil, fmt.Errorf("generate hash key: %w", err)
+		}
+	}
+
+	for i, rc := range cfg.Rules {
+		r := rule{strategy: rc.Strategy, keep: rc.Keep}
+		switch r.strategy {
+		case Redact, Partial, Hash, Null:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown strategy %q", i, rc.Strategy)
+		}
+		if r.keep <= 0 {
+			r.keep = defaultKeep
+		}
+
+		switch {
+		case (rc.Column == "") == (rc.Match == ""):
+			return nil, fmt.Errorf("rule %d: set exactly one of column or match", i)
+		case rc.Match != "":
+			re, err := regexp.Compile(rc.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			r.match = re
+		default:
+			segs := strings.Split(strings.ToLower(strings.TrimSpace(rc.Column)), ".")
+			if len(segs) > 3 || slices.Contains(segs, "") {
+				return nil, fmt.Errorf("rule %d: invalid column %q: want [[schema.]table.]column", i, rc.Column)
+			}
+			for _, s := range segs {
+				if _, err := path.Match(s, ""); err != nil {
+					return nil, fmt.Errorf("rule %d: invalid column %q: %w", i, rc.Column, err)
+				}
+			}
+			r.key = segs
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// CanUnmask reports whether any of the roles grants access to raw values.
+func (m *Masker) CanUnmask(roles []string) bool {
+	for _, role := range roles {
+		if slices.Contains(m.unmaskRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan decides which result columns of a query are masked. q holds the
+// query's relations; when it is nil (the query couldn't be analysed), keyed
+// rules match on the column name alone. Plan returns nil when nothing is masked.
+func (m *Masker) Plan(columns []string, q *sqlparse.Query) *Plan {
+	p := &Plan{rules: make([]*rule, len(columns))}
+	for i, col := range columns {
+		for j := range m.rules {
+			if m.matches(&m.rules[j], col, q) {
+				p.rules[i] = &m.rules[j]
+				p.masked = append(p.masked, i)
+				break
+			}
+		}
+	}
+	if len(p.masked) == 0 {
+		return nil
+	}
+	p.hashKey = m.hashKey
+	return p
+}
+
+func (m *Masker) matches(r *rule, column string, q *sqlparse.Query) bool {
+	if r.match != nil {
+		return r.match.MatchString(column)
+	}
+
+	key := r.key
+	if ok, _ := path.Match(key[len(key)-1], strings.ToLower(column)); !ok {
+		return false
+	}
+	if len(key) == 1 || q == nil {
+		return true
+	}
+	for _, rel := range q.Relations {
+		schemaName := rel.Schema
+		if schemaName == "" {
+			schemaName = m.defaultSchema
+		}
+		if ok, _ := path.Match(key[len(key)-2], strings.ToLower(rel.Name)); !ok {
+			continue
+		}
+		if len(key) == 2 {
+			return true
+		}
+		if ok, _ := path.Match(key[0], strings.ToLower(schemaName)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan masks the columns of one result set. A nil Plan masks nothing.
+type Plan struct {
+	rules   []*rule // Per result column; nil when the column is shown as is
+	masked  []int
+	hashKey []byte
+}
+
+// Masked returns the indices of masked columns.
+func (p *Plan) Masked() []int {
+	if p == nil {
+		return nil
+	}
+	return p.masked
+}
+
+// Apply masks the value of result column col. NULLs stay NULL.
+func (p *Plan) Apply(col int, v any) any {
+	if p == nil || col >= len(p.rules) || p.rules[col] == nil || v == nil {
+		return v
+	}
+
+	r := p.rules[col]
+	switch r.strategy {
+	case Null:
+		return nil
+	case Redact:
+		return redacted
+	case Hash:
+		mac := hmac.New(sha256.New, p.hashKey)
+		mac.Write([]byte(stringify(v)))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	default:
+		return partial(stringify(v), r.keep)
+	}
+}
+
+// partial keeps the first character of an email's local part and its domain,
+// or otherwise the last keep characters.
+func partial(s string, keep int) string {
+	if at := strings.LastIndexByte(s, '@'); at > 0 && at < len(s)-1 {
+		first := []rune(s[:at])[0]
+		return string(first) + "***" + s[at:]
+	}
+
+	runes := []rune(s)
+	if len(runes) <= keep {
+		return "***"
+	}
+	return "***" + string(runes[len(runes)-keep:])
+}
+
+func stringify(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
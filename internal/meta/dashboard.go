@@ -0,0 +1,198 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/params"
+)
+
+// Dashboard grid dimensions.
+const (
+	GridColumns  = 12
+	maxRowSpan   = 24
+	defaultWidth = 6
+	defaultRows  = 4
+
+	// MinRefresh is the shortest panel refresh interval, in seconds.
+	MinRefresh = 10
+)
+
+// Visualizations a panel may use.
+var Visualizations = []string{
+	"table",
+	"number",                              // The first value of the result, large
+	"chart",                               // The chart recommended for the result
+	"line", "bar", "area", "point", "arc", // The recommended chart, drawn with this mark
+}
+
+var panelIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Dashboard is a named grid of panels with a shared parameter bar.
+type Dashboard struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Params      []params.Param `json:"params,omitempty"` // Parameter bar shared by the panels
+	Panels      []Panel        `json:"panels"`
+	CreatedBy   string         `json:"createdBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// Panel shows the result of a saved query.
+type Panel struct {
+	ID       string            `json:"id"` // Unique within the dashboard; assigned when empty
+	Title    string            `json:"title,omitempty"`
+	QueryID  string            `json:"queryId"`
+	Viz      string            `json:"viz"`                // One of Visualizations; table when empty
+	Limit    int               `json:"limit,omitempty"`    // Row cap; the /query default when zero
+	Refresh  int               `json:"refresh,omitempty"`  // Seconds between refreshes; 0 refreshes with the dashboard only
+	Bindings map[string]string `json:"bindings,omitempty"` // Query parameter to dashboard parameter
+
+	// Position on the grid, GridColumns wide, in columns and rows
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w,omitempty"` // defaultWidth when zero
+	H int `json:"h,omitempty"` // defaultRows when zero
+}
+
+// Panel returns the panel with the given ID.
+func (d Dashboard) Panel(id string) (Panel, bool) {
+	i := slices.IndexFunc(d.Panels, func(p Panel) bool { return p.ID == id })
+	if i < 0 {
+		return Panel{}, false
+	}
+	return d.Panels[i], true
+}
+
+// Normalize fills in panel defaults and checks the fields a caller sets.
+// Whether panel queries exist and take the bound parameters is up to the
+// caller, which knows the saved queries.
+func (d *Dashboard) Normalize() error {
+	if strings.TrimSpace(d.Name) == "" {
+		return errors.New("name is required")
+	}
+	if err := params.ValidateDefs(d.Params); err != nil {
+		return err
+	}
+	if params.Find(d.Params, "run") != nil {
+		return errors.New(`"run" is reserved and can't name a dashboard parameter`)
+	}
+
+	ids := make(map[string]bool)
+	for _, p := range d.Panels {
+		if p.ID != "" {
+			if !panelIDPattern.MatchString(p.ID) {
+				return fmt.Errorf("invalid panel id %q (use letters, digits, - and _)", p.ID)
+			}
+			if ids[p.ID] {
+				return fmt.Errorf("duplicate panel id %q", p.ID)
+			}
+			ids[p.ID] = true
+		}
+	}
+	next := 1
+	for i := range d.Panels {
+		p := &d.Panels[i]
+		if p.ID == "" {
+			for ids["p"+strconv.Itoa(next)] {
+				next++
+			}
+			p.ID = "p" + strconv.Itoa(next)
+			ids[p.ID] = true
+		}
+		if p.QueryID == "" {
+			return fmt.Errorf("panel %s: queryId is required", p.ID)
+		}
+		if p.Viz == "" {
+			p.Viz = "table"
+		}
+		if !slices.Contains(Visualizations, p.Viz) {
+			return fmt.Errorf("panel %s: unknown viz %q (use %s)", p.ID, p.Viz, strings.Join(Visualizations, ", "))
+		}
+		if p.Limit < 0 {
+			return fmt.Errorf("panel %s: limit must not be negative", p.ID)
+		}
+		if p.Refresh != 0 && p.Refresh < MinRefresh {
+			return fmt.Errorf("panel %s: refresh must be 0 or at least %d seconds", p.ID, MinRefresh)
+		}
+		if p.W == 0 {
+			p.W = defaultWidth
+		}
+		if p.H == 0 {
+			p.H = defaultRows
+		}
+		if p.X < 0 || p.Y < 0 || p.W < 1 || p.X+p.W > GridColumns || p.H < 1 || p.H > maxRowSpan {
+			return fmt.Errorf("panel %s: position must fit a %d-column grid, at most %d rows high", p.ID, GridColumns, maxRowSpan)
+		}
+		for qp, dp := range p.Bindings {
+			if params.Find(d.Params, dp) == nil {
+				return fmt.Errorf("panel %s: parameter %s is bound to unknown dashboard parameter %q", p.ID, qp, dp)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateDashboard assigns an ID to a dashboard and stores it.
+func (s *Store) CreateDashboard(d Dashboard) (Dashboard, error) {
+	if err := d.Normalize(); err != nil {
+		return Dashboard{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Dashboard{}, err
+	}
+	d.ID = id
+	d.CreatedAt = time.Now().UTC()
+	d.UpdatedAt = d.CreatedAt
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return d, write(s, kindDashboards, id, d)
+}
+
+// Dashboard returns a dashboard.
+func (s *Store) Dashboard(id string) (Dashboard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return read[Dashboard](s, kindDashboards, id)
+}
+
+// Dashboards returns every dashboard, ordered by name.
+func (s *Store) Dashboards() ([]Dashboard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readAll(s, kindDashboards, func(d Dashboard) string { return d.Name })
+}
+
+// UpdateDashboard replaces a dashboard, keeping its ID and creation details.
+func (s *Store) UpdateDashboard(id string, d Dashboard) (Dashboard, error) {
+	if err := d.Normalize(); err != nil {
+		return Dashboard{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := read[Dashboard](s, kindDashboards, id)
+	if err != nil {
+		return Dashboard{}, err
+	}
+	d.ID, d.CreatedBy, d.CreatedAt = old.ID, old.CreatedBy, old.CreatedAt
+	d.UpdatedAt = time.Now().UTC()
+	return d, write(s, kindDashboards, id, d)
+}
+
+// DeleteDashboard removes a dashboard.
+func (s *Store) DeleteDashboard(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(kindDashboards, id)
+}
@@ -0,0 +1,150 @@
+// Package meta is the local metadata store for saved queries and the
+// dashboards and schedules built from them. Each record is a JSON file in a
+// directory per kind, written atomically.
+package meta
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned for unknown or malformed IDs.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInUse is returned when deleting a record others refer to.
+	ErrInUse = errors.New("in use")
+)
+
+// Record kinds, each stored in its own directory.
+const (
+	kindQueries    = "queries"
+	kindDashboards = "dashboards"
+	kindSchedules  = "schedules"
+)
+
+// Store keeps metadata records under a directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open prepares a metadata store rooted at dir.
+func Open(dir string) (*Store, error) {
+	for _, kind := range []string{kindQueries, kindDashboards, kindSchedules} {
+		if err := os.MkdirAll(filepath.Join(dir, kind), 0o700); err != nil {
+			return nil, fmt.Errorf("create metadata dir: %w", err)
+		}
+	}
+	return &Store{dir: dir}, nil
+}
+
+// The helpers below expect the caller to hold s.mu.
+
+func (s *Store) path(kind, id string) string {
+	return filepath.Join(s.dir, kind, id+".json")
+}
+
+func write[T any](s *Store, kind, id string, v T) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temp file first so readers never see a partial record
+	tmp := s.path(kind, id) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("write %s: %w", kind, err)
+	}
+	if err := os.Rename(tmp, s.path(kind, id)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write %s: %w", kind, err)
+	}
+	return nil
+}
+
+func read[T any](s *Store, kind, id string) (T, error) {
+	var v T
+	if !validID(id) {
+		return v, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(kind, id))
+	if os.IsNotExist(err) {
+		return v, ErrNotFound
+	}
+	if err != nil {
+		return v, fmt.Errorf("read %s: %w", kind, err)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("decode %s %s: %w", kind, id, err)
+	}
+	return v, nil
+}
+
+// readAll returns every record of a kind, ordered by name.
+func readAll[T any](s *Store, kind string, name func(T) string) ([]T, error) {
+	files, err := os.ReadDir(filepath.Join(s.dir, kind))
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", kind, err)
+	}
+	out := []T{}
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || !validID(id) {
+			continue
+		}
+		v, err := read[T](s, kind, id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	slices.SortFunc(out, func(a, b T) int {
+		return cmp.Compare(strings.ToLower(name(a)), strings.ToLower(name(b)))
+	})
+	return out, nil
+}
+
+func (s *Store) remove(kind, id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	err := os.Remove(s.path(kind, id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+const idBytes = 12
+
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validID rejects anything that isn't a URL-safe base64 ID, so IDs can be
+// used as file names without path traversal.
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(idBytes) {
+		return false
+	}
+	for _, c := range id {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/params"
+)
+
+// Query is a saved query.
+type Query struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	SQL         string         `json:"sql"`              // May refer to parameters as {{name}}
+	Source      string         `json:"source,omitempty"` // Data source; empty for the default
+	Params      []params.Param `json:"params,omitempty"`
+	CreatedBy   string         `json:"createdBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// Validate checks the fields a caller sets.
+func (q Query) Validate() error {
+	if strings.TrimSpace(q.Name) == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(q.SQL) == "" {
+		return errors.New("sql is required")
+	}
+	return params.Validate(q.SQL, q.Params)
+}
+
+// CreateQuery assigns an ID to a saved query and stores it.
+func (s *Store) CreateQuery(q Query) (Query, error) {
+	if err := q.Validate(); err != nil {
+		return Query{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Query{}, err
+	}
+	q.ID = id
+	q.CreatedAt = time.Now().UTC()
+	q.UpdatedAt = q.CreatedAt
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return q, write(s, kindQueries, id, q)
+}
+
+// Query returns a saved query.
+func (s *Store) Query(id string) (Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return read[Query](s, kindQueries, id)
+}
+
+// Queries returns every saved query, ordered by name.
+func (s *Store) Queries() ([]Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readAll(s, kindQueries, func(q Query) string { return q.Name })
+}
+
+// UpdateQuery replaces a saved query, keeping its ID and creation details.
+func (s *Store) UpdateQuery(id string, q Query) (Query, error) {
+	if err := q.Validate(); err != nil {
+		return Query{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := read[Query](s, kindQueries, id)
+	if err != nil {
+		return Query{}, err
+	}
+	q.ID, q.CreatedBy, q.CreatedAt = old.ID, old.CreatedBy, old.CreatedAt
+	q.UpdatedAt = time.Now().UTC()
+	return q, write(s, kindQueries, id, q)
+}
+
+// DeleteQuery removes a saved query. It fails with ErrInUse while a
+// dashboard panel or a schedule refers to it.
+func (s *Store) DeleteQuery(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dashboards, err := readAll(s, kindDashboards, func(d Dashboard) string { return d.Name })
+	if err != nil {
+		return err
+	}
+	for _, d := range dashboards {
+		for _, p := range d.Panels {
+			if p.QueryID == id {
+				return fmt.Errorf("%w by dashboard %q", ErrInUse, d.Name)
+			}
+		}
+	}
+	schedules, err := readAll(s, kindSchedules, func(sc Schedule) string { return sc.Name })
+	if err != nil {
+		return err
+	}
+	for _, sc := range schedules {
+		if sc.QueryID == id {
+			return fmt.Errorf("%w by schedule %q", ErrInUse, sc.Name)
+		}
+	}
+	return s.remove(kindQueries, id)
+}
@@ -0,0 +1,167 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/schedule"
+)
+
+// Scheduled result formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Retry limits for scheduled runs.
+const (
+	MaxRetries        = 5
+	defaultRetryDelay = time.Minute
+	maxRetryDelay     = time.Hour
+)
+
+// Schedule runs a saved query on a cron expression and delivers the result
+// to sinks.
+type Schedule struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	QueryID    string            `json:"queryId"`
+	Params     map[string]string `json:"params,omitempty"` // Parameter values; defaults fill the rest
+	Cron       string            `json:"cron"`
+	Timezone   string            `json:"timezone,omitempty"` // IANA zone the cron and "today" follow; UTC when empty
+	Format     string            `json:"format"`             // FormatCSV or FormatJSON; CSV when empty
+	Sinks      []string          `json:"sinks"`
+	Retries    int               `json:"retries,omitempty"`    // Extra attempts after a failure, up to MaxRetries
+	RetryDelay string            `json:"retryDelay,omitempty"` // Go duration before the first retry, doubling after; 1m when empty
+	Paused     bool              `json:"paused,omitempty"`
+	Roles      []string          `json:"roles,omitempty"` // Roles of the user the query runs as, taken when they last saved it
+	CreatedBy  string            `json:"createdBy"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+}
+
+// Normalize fills in defaults and checks the fields a caller sets. Whether
+// the query and sinks exist is up to the caller.
+func (s *Schedule) Normalize() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if s.QueryID == "" {
+		return errors.New("queryId is required")
+	}
+	if _, err := schedule.ParseCron(s.Cron); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	if s.Format == "" {
+		s.Format = FormatCSV
+	}
+	if s.Format != FormatCSV && s.Format != FormatJSON {
+		return fmt.Errorf("format must be %q or %q", FormatCSV, FormatJSON)
+	}
+	if len(s.Sinks) == 0 {
+		return errors.New("at least one sink is required")
+	}
+	slices.Sort(s.Sinks)
+	s.Sinks = slices.Compact(s.Sinks)
+	if s.Retries < 0 || s.Retries > MaxRetries {
+		return fmt.Errorf("retries must be between 0 and %d", MaxRetries)
+	}
+	if s.RetryDelay != "" {
+		d, err := time.ParseDuration(s.RetryDelay)
+		if err != nil || d < time.Second || d > maxRetryDelay {
+			return fmt.Errorf("retryDelay must be a duration between 1s and %s", maxRetryDelay)
+		}
+	}
+	return nil
+}
+
+// Location returns the zone the schedule follows.
+func (s Schedule) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Next returns the schedule's first run time after t, or the zero time when
+// it is paused or never runs.
+func (s Schedule) Next(t time.Time) time.Time {
+	c, err := schedule.ParseCron(s.Cron)
+	if s.Paused || err != nil {
+		return time.Time{}
+	}
+	return c.Next(t.In(s.Location()))
+}
+
+// Delay returns how long to wait before the given retry, counting from 1.
+func (s Schedule) Delay(retry int) time.Duration {
+	d, err := time.ParseDuration(s.RetryDelay)
+	if err != nil || d <= 0 {
+		d = defaultRetryDelay
+	}
+	return min(d<<(retry-1), maxRetryDelay)
+}
+
+// CreateSchedule assigns an ID to a schedule and stores it.
+func (s *Store) CreateSchedule(sc Schedule) (Schedule, error) {
+	if err := sc.Normalize(); err != nil {
+		return Schedule{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc.ID = id
+	sc.CreatedAt = time.Now().UTC()
+	sc.UpdatedAt = sc.CreatedAt
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sc, write(s, kindSchedules, id, sc)
+}
+
+// Schedule returns a schedule.
+func (s *Store) Schedule(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return read[Schedule](s, kindSchedules, id)
+}
+
+// Schedules returns every schedule, ordered by name.
+func (s *Store) Schedules() ([]Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return readAll(s, kindSchedules, func(sc Schedule) string { return sc.Name })
+}
+
+// UpdateSchedule replaces a schedule, keeping its ID and creation details.
+func (s *Store) UpdateSchedule(id string, sc Schedule) (Schedule, error) {
+	if err := sc.Normalize(); err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := read[Schedule](s, kindSchedules, id)
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc.ID, sc.CreatedBy, sc.CreatedAt = old.ID, old.CreatedBy, old.CreatedAt
+	sc.UpdatedAt = time.Now().UTC()
+	return sc, write(s, kindSchedules, id, sc)
+}
+
+// DeleteSchedule removes a schedule.
+func (s *Store) DeleteSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(kindSchedules, id)
+}
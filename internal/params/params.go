@@ -0,0 +1,232 @@
+// Package params binds typed parameters into saved queries.
+//
+// A query refers to a parameter as {{name}}. Binding replaces each reference
+// with a literal of the parameter's type, quoted for the dialect, so values
+// can't change the structure of the query. References inside string literals
+// or comments are rejected, since a quoted value there would end the string.
+package params
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// Type is a parameter type.
+type Type string
+
+const (
+	Text   Type = "text"
+	Number Type = "number"
+	Date   Type = "date" // A date or RFC 3339 time, or today, today-N or today+N (days, UTC)
+)
+
+// Param is a declared parameter.
+type Param struct {
+	Name    string `json:"name"`
+	Type    Type   `json:"type,omitempty"`    // Text when empty
+	Label   string `json:"label,omitempty"`   // Shown in the UI instead of the name
+	Default string `json:"default,omitempty"` // Used when no value is given; without one a value is required
+}
+
+var (
+	refPattern  = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	numPattern  = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+	todayOffset = regexp.MustCompile(`^today\s*([+-])\s*(\d+)$`)
+)
+
+// sentinel stands in for references while checking where they sit.
+const sentinel = "__webdbreader_param__"
+
+// Refs returns the names of the parameters a query refers to, in order of
+// first use.
+func Refs(sql string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range refPattern.FindAllStringSubmatch(sql, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// ValidateDefs checks parameter declarations: valid, unique names, known
+// types, and defaults of the right type.
+func ValidateDefs(ps []Param) error {
+	seen := make(map[string]bool)
+	for _, p := range ps {
+		if !namePattern.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		seen[p.Name] = true
+		switch p.Type {
+		case "", Text, Number, Date:
+		default:
+			return fmt.Errorf("parameter %s: unknown type %q (use text, number or date)", p.Name, p.Type)
+		}
+		if p.Default != "" {
+			if _, err := literal(p, p.Default, sqlparse.Postgres, time.Now()); err != nil {
+				return fmt.Errorf("parameter %s: default: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks a query's parameter declarations and that it refers only
+// to declared parameters.
+func Validate(sql string, ps []Param) error {
+	if err := ValidateDefs(ps); err != nil {
+		return err
+	}
+	for _, name := range Refs(sql) {
+		if Find(ps, name) == nil {
+			return fmt.Errorf("{{%s}} is not a declared parameter", name)
+		}
+	}
+	return nil
+}
+
+// Find returns the named parameter, or nil.
+func Find(ps []Param, name string) *Param {
+	for i := range ps {
+		if ps[i].Name == name {
+			return &ps[i]
+		}
+	}
+	return nil
+}
+
+// Bind replaces the parameter references of a query with literals of the
+// given values, falling back to defaults. now resolves relative dates.
+func Bind(sql string, syn sqlparse.Syntax, ps []Param, values map[string]string, now time.Time) (string, error) {
+	matches := refPattern.FindAllStringSubmatchIndex(sql, -1)
+	if len(matches) == 0 {
+		return sql, nil
+	}
+	if err := checkPlacement(sql, syn, matches); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		name := sql[m[2]:m[3]]
+		p := Find(ps, name)
+		if p == nil {
+			return "", fmt.Errorf("{{%s}} is not a declared parameter", name)
+		}
+		v, ok := values[name]
+		if !ok {
+			if p.Default == "" {
+				return "", fmt.Errorf("parameter %s: a value is required", name)
+			}
+			v = p.Default
+		}
+		lit, err := literal(*p, v, syn, now)
+		if err != nil {
+			return "", fmt.Errorf("parameter %s: %w", name, err)
+		}
+		sb.WriteString(sql[last:m[0]])
+		sb.WriteString(lit)
+		last = m[1]
+	}
+	sb.WriteString(sql[last:])
+	return sb.String(), nil
+}
+
+// checkPlacement rejects references the lexer doesn't see as plain tokens,
+// i.e. ones inside string literals, quoted identifiers or comments.
+func checkPlacement(sql string, syn sqlparse.Syntax, matches [][]int) error {
+	if strings.Contains(strings.ToLower(sql), sentinel) {
+		return fmt.Errorf("query may not contain %q", sentinel)
+	}
+	stubbed := refPattern.ReplaceAllString(sql, sentinel)
+	toks, err := sqlparse.TokenizeWith(stubbed, syn)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, t := range toks {
+		if t.Kind == sqlparse.TokIdent && t.Text == sentinel {
+			n++
+		}
+	}
+	if n != len(matches) {
+		return errors.New("parameters can't be used inside strings, quoted names or comments; write {{name}} bare and it is replaced with a quoted value")
+	}
+	return nil
+}
+
+func typeOf(p Param) Type {
+	if p.Type == "" {
+		return Text
+	}
+	return p.Type
+}
+
+// literal renders a value as a SQL literal of the parameter's type.
+func literal(p Param, v string, syn sqlparse.Syntax, now time.Time) (string, error) {
+	switch typeOf(p) {
+	case Number:
+		v = strings.TrimSpace(v)
+		if !numPattern.MatchString(v) {
+			return "", fmt.Errorf("%q is not a number", v)
+		}
+		if strings.HasPrefix(v, "-") {
+			return "(" + v + ")", nil // Keep "x - -1" from becoming a comment
+		}
+		return strings.TrimPrefix(v, "+"), nil
+	case Date:
+		t, err := ParseDate(strings.TrimSpace(v), now)
+		if err != nil {
+			return "", err
+		}
+		if t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+			return syn.QuoteString(t.Format(time.DateOnly)), nil
+		}
+		return syn.QuoteString(t.Format(time.RFC3339)), nil
+	default:
+		if strings.ContainsRune(v, 0) {
+			return "", errors.New("value contains a NUL byte")
+		}
+		return syn.QuoteString(v), nil
+	}
+}
+
+// ParseDate reads a date parameter value: YYYY-MM-DD, an RFC 3339 time, or
+// today, today-N or today+N days, in UTC.
+func ParseDate(v string, now time.Time) (time.Time, error) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	if v == "today" {
+		return today, nil
+	}
+	if m := todayOffset.FindStringSubmatch(v); m != nil {
+		days, err := strconv.Atoi(m[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", v)
+		}
+		if m[1] == "-" {
+			days = -days
+		}
+		return today.AddDate(0, 0, days), nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD, RFC 3339 or today-N)", v)
+}
@@ -0,0 +1,137 @@
+package params
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+var now = time.Date(2024, 3, 15, 13, 30, 0, 0, time.UTC)
+
+func TestBindQuotes(t *testing.T) {
+	tests := []struct {
+		name  string
+		syn   sqlparse.Syntax
+		param Param
+		value string
+		want  string
+	}{
+		{"text", sqlparse.Postgres, Param{Name: "p"}, "O'Brien", `'O''Brien'`},
+		{"postgres backslash", sqlparse.Postgres, Param{Name: "p"}, `a\' OR 1=1 --`, `'a\'' OR 1=1 --'`},
+		{"mysql backslash", sqlparse.MySQL, Param{Name: "p"}, `a\' OR 1=1 --`, `'a\\'' OR 1=1 --'`},
+		{"number", sqlparse.Postgres, Param{Name: "p", Type: Number}, " 42.5 ", "42.5"},
+		{"negative number", sqlparse.Postgres, Param{Name: "p", Type: Number}, "-1", "(-1)"},
+		{"plus number", sqlparse.Postgres, Param{Name: "p", Type: Number}, "+3e2", "3e2"},
+		{"date", sqlparse.Postgres, Param{Name: "p", Type: Date}, "2024-01-02", "'2024-01-02'"},
+		{"relative date", sqlparse.Postgres, Param{Name: "p", Type: Date}, "today-7", "'2024-03-08'"},
+		{"time", sqlparse.Postgres, Param{Name: "p", Type: Date}, "2024-01-02T03:04:05+01:00", "'2024-01-02T03:04:05+01:00'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Bind("SELECT * FROM t WHERE x = {{ p }}", tt.syn, []Param{tt.param}, map[string]string{"p": tt.value}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "SELECT * FROM t WHERE x = " + tt.want; got != want {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestBindBoundTextStaysOneLiteral(t *testing.T) {
+	for _, syn := range []sqlparse.Syntax{sqlparse.Postgres, sqlparse.MySQL, sqlparse.SQLite} {
+		for _, v := range []string{`'; DROP TABLE t; --`, `\'; DROP TABLE t; --`, `x' /* `, "a\nb"} {
+			sql, err := Bind("SELECT {{p}}", syn, []Param{{Name: "p"}}, map[string]string{"p": v}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			toks, err := sqlparse.TokenizeWith(sql, syn)
+			if err != nil {
+				t.Fatalf("%q: %v", sql, err)
+			}
+			if len(toks) != 2 || toks[1].Kind != sqlparse.TokString {
+				t.Errorf("%q binds to %d tokens, want SELECT and one string", v, len(toks))
+			}
+		}
+	}
+}
+
+func TestBindRejectsPlacement(t *testing.T) {
+	ps := []Param{{Name: "p"}}
+	values := map[string]string{"p": "x"}
+	tests := map[string]sqlparse.Syntax{
+		"SELECT '{{p}}'":                        sqlparse.Postgres,
+		"SELECT 'a {{p}} b'":                    sqlparse.Postgres,
+		`SELECT "{{p}}" FROM t`:                 sqlparse.Postgres,
+		"SELECT 1 -- {{p}}":                     sqlparse.Postgres,
+		"SELECT 1 /* {{p}} */":                  sqlparse.Postgres,
+		"SELECT $$ {{p}} $$":                    sqlparse.Postgres,
+		"SELECT 1 # {{p}}":                      sqlparse.MySQL,
+		"SELECT `{{p}}` FROM t":                 sqlparse.MySQL,
+		"SELECT [{{p}}] FROM t":                 sqlparse.SQLite,
+		"SELECT {{p}}, '__webdbreader_param__'": sqlparse.Postgres,
+	}
+	for sql, syn := range tests {
+		if got, err := Bind(sql, syn, ps, values, now); err == nil {
+			t.Errorf("Bind(%q) = %q, want an error", sql, got)
+		}
+	}
+}
+
+func TestBindValues(t *testing.T) {
+	ps := []Param{
+		{Name: "region"},
+		{Name: "since", Type: Date, Default: "today"},
+		{Name: "min", Type: Number},
+	}
+	sql := "SELECT * FROM sales WHERE region = {{region}} AND day >= {{since}} AND total > {{min}} OR region = {{region}}"
+
+	got, err := Bind(sql, sqlparse.Postgres, ps, map[string]string{"region": "EU", "min": "10"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT * FROM sales WHERE region = 'EU' AND day >= '2024-03-15' AND total > 10 OR region = 'EU'"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	errTests := map[string]map[string]string{
+		"a value is required": {"region": "EU"},
+		"is not a number":     {"region": "EU", "min": "1; DROP TABLE t"},
+		"invalid date":        {"region": "EU", "min": "1", "since": "yesterday"},
+		"NUL byte":            {"region": "E\x00U", "min": "1"},
+	}
+	for want, values := range errTests {
+		if _, err := Bind(sql, sqlparse.Postgres, ps, values, now); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Bind(%v) error = %v, want %q", values, err, want)
+		}
+	}
+
+	if _, err := Bind("SELECT {{other}}", sqlparse.Postgres, ps, nil, now); err == nil {
+		t.Error("undeclared parameter bound")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		sql     string
+		ps      []Param
+		wantErr bool
+	}{
+		{"SELECT {{a}}", []Param{{Name: "a"}}, false},
+		{"SELECT {{b}}", []Param{{Name: "a"}}, true},
+		{"SELECT 1", []Param{{Name: "a"}, {Name: "a"}}, true},
+		{"SELECT 1", []Param{{Name: "1a"}}, true},
+		{"SELECT 1", []Param{{Name: "a", Type: "bool"}}, true},
+		{"SELECT 1", []Param{{Name: "a", Type: Number, Default: "x"}}, true},
+		{"SELECT 1", []Param{{Name: "a", Type: Date, Default: "today+1"}}, false},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.sql, tt.ps); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%q, %v) = %v, want error %v", tt.sql, tt.ps, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+// Package policy enforces table- and column-level access rules per role.
+//
+// Rules are dotted patterns of up to three segments, schema.table.column,
+// where each segment is a glob ("*", "audit_*"). Fewer segments cover
+// everything beneath: "public" is every table in public, "public.users" is
+// every column of users. A role may read a column when one of its allow rules
+// covers it and none of its deny rules do; global deny rules apply to everyone.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// ErrAccessDenied is wrapped by every policy violation.
+var ErrAccessDenied = errors.New("access denied")
+
+// Config is the on-disk policy file (JSON).
+type Config struct {
+	DefaultSchema string           `json:"defaultSchema"` // Schema for unqualified names, default "public"
+	Default       Rules            `json:"default"`       // Applies to every caller, signed in or not
+	Roles         map[string]Rules `json:"roles"`
+	Deny          []string         `json:"deny"` // Applies to every role
+}
+
+// Rules grants and restricts access for one role.
+type Rules struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// Engine evaluates a loaded policy.
+type Engine struct {
+	defaultSchema string
+	everyone      ruleSet
+	roles         map[string]ruleSet
+	deny          []pattern
+}
+
+// Load reads and compiles a policy file.
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	return New(cfg)
+}
+
+// New compiles a policy config.
+func New(cfg Config) (*Engine, error) {
+	e := &Engine{
+		defaultSchema: strings.ToLower(cfg.DefaultSchema),
+		roles:         make(map[string]ruleSet),
+	}
+	if e.defaultSchema == "" {
+		e.defaultSchema = "public"
+	}
+
+	var err error
+	if e.everyone, err = compileRules(cfg.Default); err != nil {
+		return nil, fmt.Errorf("default rules: %w", err)
+	}
+	for role, rules := range cfg.Roles {
+		if e.roles[role], err = compileRules(rules); err != nil {
+			return nil, fmt.Errorf("role %q: %w", role, err)
+		}
+	}
+	if e.deny, err = compilePatterns(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("deny rules: %w", err)
+	}
+	return e, nil
+}
+
+// For returns the access a caller holding the given roles has.
+func (e *Engine) For(roles []string) *Access {
+	sets := []ruleSet{e.everyone}
+	for _, role := range roles {
+		if rs, ok := e.roles[role]; ok {
+			sets = append(sets, rs)
+		}
+	}
+	return &Access{engine: e, sets: sets}
+}
+
+// Access answers policy questions for one caller.
+type Access struct {
+	engine *Engine
+	sets   []ruleSet
+}
+
+// TableAllowed reports whether the caller may see the table at all.
+func (a *Access) TableAllowed(schemaName, table string) bool {
+	target := []string{strings.ToLower(schemaName), strings.ToLower(table)}
+	if matchAny(a.engine.deny, target, 2) {
+		return false
+	}
+	for _, rs := range a.sets {
+		if rs.grants(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnAllowed reports whether the caller may read the column.
+func (a *Access) ColumnAllowed(schemaName, table, column string) bool {
+	target := []string{strings.ToLower(schemaName), strings.ToLower(table), strings.ToLower(column)}
+	if matchAny(a.engine.deny, target, 3) {
+		return false
+	}
+	for _, rs := range a.sets {
+		if rs.grants(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// SchemaFilter hides tables and columns the caller may not read, for the
+// schema endpoint and LLM context.
+func (a *Access) SchemaFilter() schema.Filter {
+	return func(t schema.Table) (schema.Table, bool) {
+		s := a.schemaOf(t)
+		if !a.TableAllowed(s, t.Name) {
+			return schema.Table{}, false
+		}
+
+		visible := t
+		visible.Columns = nil
+		for _, c := range t.Columns {
+			if a.ColumnAllowed(s, t.Name, c.Name) {
+				visible.Columns = append(visible.Columns, c)
+			}
+		}
+		if len(visible.Columns) == 0 {
+			return schema.Table{}, false
+		}
+
+		visible.ForeignKeys = nil
+		for _, fk := range t.ForeignKeys {
+			if a.ColumnAllowed(s, t.Name, fk.Column) && a.ColumnAllowed(s, fk.ForeignTable, fk.ForeignColumn) {
+				visible.ForeignKeys = append(visible.ForeignKeys, fk)
+			}
+		}
+		return visible, true
+	}
+}
+
+// dangerousFunctions can run SQL passed as a string or read outside the
+// database, so they would bypass relation analysis.
+var dangerousFunctions = map[string]bool{
+	"query_to_xml": true, "query_to_xml_and_xmlschema": true, "query_to_xmlschema": true,
+	"cursor_to_xml": true, "cursor_to_xmlschema": true,
+	"table_to_xml": true, "table_to_xml_and_xmlschema": true, "table_to_xmlschema": true,
+	"schema_to_xml": true, "schema_to_xml_and_xmlschema": true, "schema_to_xmlschema": true,
+	"database_to_xml": true, "database_to_xml_and_xmlschema": true, "database_to_xmlschema": true,
+	"dblink": true, "dblink_exec": true, "dblink_open": true, "dblink_fetch": true,
+	"pg_read_file": true, "pg_read_binary_file": true, "pg_ls_dir": true, "pg_stat_file": true,
+	"lo_import": true, "lo_export": true, "lo_get": true, "lo_open": true, "loread": true,
+	// DuckDB file and foreign database readers
+	"read_csv": true, "read_csv_auto": true, "sniff_csv": true,
+	"read_parquet": true, "parquet_scan": true, "parquet_metadata": true, "parquet_schema": true,
+	"read_json": true, "read_json_auto": true, "read_json_objects": true,
+	"read_ndjson": true, "read_ndjson_auto": true, "read_ndjson_objects": true,
+	"read_text": true, "read_blob": true, "glob": true,
+	"parquet_file_metadata": true, "parquet_kv_metadata": true,
+	"query": true, "query_table": true,
+	"sqlite_scan": true, "postgres_scan": true, "mysql_scan": true,
+	"iceberg_scan": true, "delta_scan": true,
+	// SQLite
+	"load_extension": true, "readfile": true, "writefile": true,
+}
+
+// CheckExternal rejects queries that call dangerousFunctions or use a string
+// literal as a table, which DuckDB reads as a file path.
+func CheckExternal(q *sqlparse.Query) error {
+	for _, fn := range q.Functions {
+		if dangerousFunctions[fn] {
+			return fmt.Errorf("%w: function %s is not permitted", ErrAccessDenied, fn)
+		}
+	}
+	if len(q.Literals) > 0 {
+		return fmt.Errorf("%w: string literal %q used as a table", ErrAccessDenied, q.Literals[0])
+	}
+	return nil
+}
+
+// CheckViews rejects queries that read any relation but the given views.
+// DuckDB scans a quoted identifier that names no table as a file path, and
+// data file sources can't turn external access off, so only their own views
+// may be read.
+func CheckViews(q *sqlparse.Query, views []string) error {
+	for _, rel := range q.Relations {
+		ok := rel.Schema == "" || strings.EqualFold(rel.Schema, "main")
+		if !ok || !slices.ContainsFunc(views, func(v string) bool { return strings.EqualFold(v, rel.Name) }) {
+			return fmt.Errorf("%w: %s is not one of the source's files", ErrAccessDenied, rel.Name)
+		}
+	}
+	return nil
+}
+
+// CheckQuery verifies that every relation and column a query references is
+// allowed. Unqualified relations must exist in the catalog, so names that
+// would resolve to system catalogs through the search path are rejected.
+func (a *Access) CheckQuery(q *sqlparse.Query, catalog []schema.Table) error {
+	if err := CheckExternal(q); err != nil {
+		return err
+	}
+
+	tables := make(map[string]schema.Table, len(catalog))
+	for _, t := range catalog {
+		tables[strings.ToLower(a.schemaOf(t)+"."+t.Name)] = t
+	}
+
+	// Map every name a relation can be referred to by onto its catalog entry
+	refs := make(map[string]schema.Table)
+	var used []schema.Table
+	for _, rel := range q.Relations {
+		schemaName := rel.Schema
+		if schemaName == "" {
+			schemaName = a.engine.defaultSchema
+		}
+		if !a.TableAllowed(schemaName, rel.Name) {
+			return fmt.Errorf("%w: table %s.%s", ErrAccessDenied, schemaName, rel.Name)
+		}
+		t, known := tables[strings.ToLower(schemaName+"."+rel.Name)]
+		if !known {
+			if rel.Schema == "" {
+				return fmt.Errorf("%w: unknown table %s", ErrAccessDenied, rel.Name)
+			}
+			// Without the column list, only unrestricted tables are safe to read
+			if !a.fullTableAccess(schemaName, rel.Name) {
+				return fmt.Errorf("%w: columns of %s.%s cannot be verified", ErrAccessDenied, schemaName, rel.Name)
+			}
+			t = schema.Table{Schema: rel.Schema, Name: rel.Name}
+		}
+		// Column aliases rename columns positionally, out of sight of the column checks
+		if len(rel.ColumnAliases) > 0 && a.checkAllColumns(t) != nil {
+			return fmt.Errorf("%w: %s has restricted columns; column aliases can't be used on it", ErrAccessDenied, t.Name)
+		}
+		refs[strings.ToLower(rel.Name)] = t
+		refs[strings.ToLower(rel.RefName())] = t
+		used = append(used, t)
+	}
+
+	for _, qualifier := range q.Stars {
+		if qualifier == "" {
+			for _, t := range used {
+				if err := a.checkAllColumns(t); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if t, ok := refs[strings.ToLower(qualifier)]; ok {
+			if err := a.checkAllColumns(t); err != nil {
+				return err
+			}
+		}
+	}
+
+	restricted := slices.ContainsFunc(used, func(t schema.Table) bool { return a.checkAllColumns(t) != nil })
+	for _, col := range q.Columns {
+		if col.Qualifier != "" {
+			t, ok := refs[strings.ToLower(col.Qualifier)]
+			switch {
+			case ok:
+				if err := a.checkColumn(t, col.Name); err != nil {
+					return err
+				}
+				// t.name may also call a function on the whole row
+				if a.checkAllColumns(t) != nil && !hasColumn(t, col.Name) {
+					return fmt.Errorf("%w: %s has no column %s", ErrAccessDenied, t.Name, col.Name)
+				}
+			case q.IsCTE(col.Qualifier) || slices.Contains(q.Derived, col.Qualifier):
+				// Checked where the CTE or subquery reads its tables
+			case restricted:
+				return fmt.Errorf("%w: cannot resolve %s.%s", ErrAccessDenied, col.Qualifier, col.Name)
+			}
+			continue
+		}
+
+		// A bare relation name is a whole-row reference, e.g. row_to_json(u)
+		if t, ok := refs[strings.ToLower(col.Name)]; ok {
+			if err := a.checkAllColumns(t); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Unqualified: reject if any referenced table restricts a column of that name
+		for _, t := range used {
+			if err := a.checkColumn(t, col.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fullTableAccess reports whether a whole-table rule grants the table and no
+// column-level deny rule could restrict it.
+func (a *Access) fullTableAccess(schemaName, table string) bool {
+	target := []string{strings.ToLower(schemaName), strings.ToLower(table)}
+	restricted := func(patterns []pattern) bool {
+		for _, p := range patterns {
+			if len(p) == 3 && p.match(target) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if restricted(a.engine.deny) {
+		return false
+	}
+	for _, rs := range a.sets {
+		if restricted(rs.deny) {
+			return false
+		}
+	}
+	for _, rs := range a.sets {
+		for _, p := range rs.allow {
+			if len(p) <= 2 && p.match(target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *Access) checkColumn(t schema.Table, column string) error {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, column) && !a.ColumnAllowed(a.schemaOf(t), t.Name, c.Name) {
+			return fmt.Errorf("%w: column %s.%s", ErrAccessDenied, t.Name, c.Name)
+		}
+	}
+	return nil
+}
+
+func hasColumn(t schema.Table, column string) bool {
+	return slices.ContainsFunc(t.Columns, func(c schema.Column) bool { return strings.EqualFold(c.Name, column) })
+}
+
+func (a *Access) checkAllColumns(t schema.Table) error {
+	for _, c := range t.Columns {
+		if !a.ColumnAllowed(a.schemaOf(t), t.Name, c.Name) {
+			return fmt.Errorf("%w: %s has restricted columns; list permitted columns explicitly instead of selecting all",
+				ErrAccessDenied, t.Name)
+		}
+	}
+	return nil
+}
+
+func (a *Access) schemaOf(t schema.Table) string {
+	if t.Schema == "" {
+		return a.engine.defaultSchema
+	}
+	return t.Schema
+}
+
+// pattern is a compiled dotted rule.
+type pattern []string
+
+type ruleSet struct {
+	allow []pattern
+	deny  []pattern
+}
+
+// grants reports whether an allow rule covers the target and no deny rule does.
+// For table targets, column-specific allows still grant visibility while only
+// whole-table denies hide it.
+func (rs ruleSet) grants(target []string) bool {
+	if matchAny(rs.deny, target, len(target)) {
+		return false
+	}
+	for _, p := range rs.allow {
+		if p.match(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the pattern covers the target, comparing only the
+// segments both have.
+func (p pattern) match(target []string) bool {
+	n := min(len(p), len(target))
+	for i := 0; i < n; i++ {
+		if ok, _ := path.Match(p[i], target[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether any pattern no longer than maxLen covers the target.
+func matchAny(patterns []pattern, target []string, maxLen int) bool {
+	for _, p := range patterns {
+		if len(p) <= maxLen && p.match(target) {
+			return true
+		}
+	}
+	return false
+}
+
+func compileRules(r Rules) (ruleSet, error) {
+	allow, err := compilePatterns(r.Allow)
+	if err != nil {
+		return ruleSet{}, err
+	}
+	deny, err := compilePatterns(r.Deny)
+	if err != nil {
+		return ruleSet{}, err
+	}
+	return ruleSet{allow: allow, deny: deny}, nil
+}
+
+func compilePatterns(raw []string) ([]pattern, error) {
+	patterns := make([]pattern, 0, len(raw))
+	for _, r := range raw {
+		segs := strings.Split(strings.ToLower(strings.TrimSpace(r)), ".")
+		if len(segs) > 3 || slices.Contains(segs, "") {
+			return nil, fmt.Errorf("invalid rule %q: want schema[.table[.column]]", r)
+		}
+		for _, s := range segs {
+			if _, err := path.Match(s, ""); err != nil {
+				return nil, fmt.Errorf("invalid rule %q: %w", r, err)
+			}
+		}
+		patterns = append(patterns, segs)
+	}
+	return patterns, nil
+}
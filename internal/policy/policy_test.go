@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	e, err := New(Config{
+		Default: Rules{Allow: []string{"public.products", "public.orders"}},
+		Roles: map[string]Rules{
+			"analyst": {Allow: []string{"public"}, Deny: []string{"public.users.ssn", "public.audit_*"}},
+			"support": {Allow: []string{"public.users.id", "public.users.name"}},
+		},
+		Deny: []string{"*.*.password*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestGlobMatching(t *testing.T) {
+	e := testEngine(t)
+	anyone, analyst, support := e.For(nil), e.For([]string{"analyst"}), e.For([]string{"support", "unknown"})
+
+	tables := []struct {
+		access *Access
+		table  string
+		want   bool
+	}{
+		{anyone, "products", true},
+		{anyone, "users", false},
+		{analyst, "users", true},
+		{analyst, "audit_log", false},
+		{analyst, "auditors", true},
+		{support, "users", true}, // A column grant makes the table visible
+		{support, "products", true},
+		{support, "audit_log", false},
+	}
+	for i, tt := range tables {
+		if got := tt.access.TableAllowed("public", tt.table); got != tt.want {
+			t.Errorf("case %d: TableAllowed(%s) = %v, want %v", i, tt.table, got, tt.want)
+		}
+	}
+
+	columns := []struct {
+		access        *Access
+		table, column string
+		want          bool
+	}{
+		{analyst, "users", "email", true},
+		{analyst, "users", "ssn", false},
+		{analyst, "users", "password_hash", false}, // Global deny
+		{support, "users", "name", true},
+		{support, "users", "email", false},
+		{anyone, "orders", "total", true},
+		{anyone, "orders", "PASSWORD", false}, // Case-insensitive
+	}
+	for i, tt := range columns {
+		if got := tt.access.ColumnAllowed("public", tt.table, tt.column); got != tt.want {
+			t.Errorf("case %d: ColumnAllowed(%s.%s) = %v, want %v", i, tt.table, tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	for _, rule := range []string{"a.b.c.d", "public..users", "public.[users"} {
+		if _, err := New(Config{Deny: []string{rule}}); err == nil {
+			t.Errorf("rule %q accepted", rule)
+		}
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	e := testEngine(t)
+	catalog := []schema.Table{
+		{Schema: "public", Name: "users", Columns: []schema.Column{{Name: "id"}, {Name: "name"}, {Name: "ssn"}, {Name: "password_hash"}}},
+		{Schema: "public", Name: "orders", Columns: []schema.Column{{Name: "id"}, {Name: "user_id"}, {Name: "total"}}},
+	}
+
+	tests := []struct {
+		roles []string
+		sql   string
+		ok    bool
+	}{
+		{nil, "SELECT id, total FROM orders", true},
+		{nil, "SELECT * FROM orders", true},
+		{nil, "SELECT name FROM users", false},
+		{[]string{"support"}, "SELECT id, name FROM users", true},
+		{[]string{"support"}, "SELECT * FROM users", false},
+		{[]string{"support"}, "SELECT u.ssn FROM users u", false},
+		{[]string{"support"}, "SELECT o.total, u.name FROM orders o JOIN users u ON u.id = o.user_id", true},
+		{[]string{"support"}, "SELECT row_to_json(u) FROM users u", false},
+		{[]string{"analyst"}, "SELECT name FROM users WHERE ssn IS NOT NULL", false},
+		{[]string{"analyst"}, "SELECT * FROM pg_catalog.pg_authid", false},
+		{[]string{"analyst"}, "SELECT * FROM pg_shadow", false}, // Not in the catalog
+		{[]string{"analyst"}, "SELECT query_to_xml('select * from users', true, true, '')", false},
+		{[]string{"analyst"}, "SELECT * FROM read_text('/etc/passwd')", false},
+		{[]string{"analyst"}, "SELECT * FROM 'secrets.csv'", false},
+
+		// Parenthesized joins
+		{[]string{"analyst"}, "SELECT u.password_hash FROM (users u CROSS JOIN orders o)", false},
+		{nil, "SELECT * FROM (users CROSS JOIN orders)", false},
+		{[]string{"analyst"}, "SELECT password_hash FROM (users CROSS JOIN orders)", false},
+		{[]string{"analyst"}, "SELECT j.ssn FROM (users u JOIN orders o ON u.id = o.user_id) j", false},
+		{[]string{"analyst"}, "SELECT u.name, o.total FROM ((users u) JOIN orders o ON u.id = o.user_id)", true},
+
+		// Column aliases and names that don't resolve
+		{[]string{"analyst"}, "SELECT u.p FROM users u(i, p)", false},
+		{[]string{"analyst"}, "SELECT c FROM users t(a, c)", false},
+		{[]string{"analyst"}, "SELECT o.c FROM orders o(a, b, c)", true},
+		{[]string{"analyst"}, "SELECT x.password_hash FROM users u", false},
+		{[]string{"analyst"}, "SELECT u.full_name FROM users u", false},
+		{[]string{"analyst"}, "SELECT s.name FROM (SELECT name FROM users) s", true},
+		{[]string{"analyst"}, "WITH r AS (SELECT name FROM users) SELECT r.name FROM r", true},
+		{[]string{"analyst"}, "SELECT g.n, u.name FROM users u, generate_series(1, 3) AS g(n)", true},
+		{nil, "SELECT x.anything FROM orders", true}, // Nothing restricted to resolve against
+	}
+	for _, tt := range tests {
+		q, err := sqlparse.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.sql, err)
+		}
+		err = e.For(tt.roles).CheckQuery(q, catalog)
+		if tt.ok && err != nil {
+			t.Errorf("%v %q: %v", tt.roles, tt.sql, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("%v %q: err = %v, want access denied", tt.roles, tt.sql, err)
+		}
+	}
+}
+
+func TestCheckViews(t *testing.T) {
+	views := []string{"orders", "Customers"}
+	tests := []struct {
+		sql string
+		ok  bool
+	}{
+		{"SELECT * FROM orders", true},
+		{"SELECT c.name FROM customers c JOIN main.orders o ON o.customer_id = c.id", true},
+		{"WITH t AS (SELECT * FROM orders) SELECT * FROM t", true},
+		{`SELECT * FROM "/etc/passwd"`, false},
+		{`SELECT * FROM "secrets.csv"`, false},
+		{"SELECT * FROM duckdb_settings()", true}, // Table functions are left to CheckExternal
+		{"SELECT * FROM other.orders", false},
+		{"SELECT * FROM (orders CROSS JOIN secrets)", false},
+		{"SELECT * FROM orders WHERE id IN (SELECT id FROM secrets)", false},
+	}
+	for _, tt := range tests {
+		q, err := sqlparse.Parse(tt.sql)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.sql, err)
+		}
+		err = CheckViews(q, views)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckViews(%q) = %v, want ok=%v", tt.sql, err, tt.ok)
+		}
+	}
+}
+
+func TestCheckExternal(t *testing.T) {
+	for _, query := range []string{
+		"SELECT * FROM parquet_file_metadata('/srv/orders.parquet')",
+		"SELECT * FROM parquet_kv_metadata('/srv/orders.parquet')",
+		"SELECT * FROM query('SELECT * FROM read_text(''/etc/passwd'')')",
+		"SELECT * FROM query_table('secrets')",
+		"SELECT * FROM 'secrets.csv'",
+	} {
+		q, err := sqlparse.Parse(query)
+		if err != nil {
+			t.Fatalf("parse %q: %v", query, err)
+		}
+		if err := CheckExternal(q); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("CheckExternal(%q) = %v, want access denied", query, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package schedule
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Run triggers.
+const (
+	TriggerCron   = "cron"
+	TriggerManual = "manual"
+)
+
+// Run statuses.
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Run is one execution of a schedule, including its retries.
+type Run struct {
+	ID         string           `json:"id"`
+	Schedule   string           `json:"schedule"` // Schedule ID
+	Trigger    string           `json:"trigger"`
+	User       string           `json:"user"` // Who the query ran as
+	Status     string           `json:"status"`
+	Error      string           `json:"error,omitempty"` // Last error, when the run failed
+	Attempts   int              `json:"attempts"`
+	RowCount   int              `json:"rowCount"`
+	Bytes      int              `json:"bytes"`
+	DurationMs int64            `json:"durationMs"` // Including retries
+	StartedAt  time.Time        `json:"startedAt"`
+	Deliveries []DeliveryResult `json:"deliveries,omitempty"`
+}
+
+// DeliveryResult is the outcome of delivering a run's result to one sink.
+type DeliveryResult struct {
+	Sink     string `json:"sink"`
+	Location string `json:"location,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewRunID returns a random run ID.
+func NewRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Runs is the file-backed run history. Runs are appended as JSON lines when
+// they finish and kept in memory for listing.
+type Runs struct {
+	path string
+	runs []Run
+	mu   sync.RWMutex
+}
+
+// OpenRuns loads an existing run history file, creating its directory if needed.
+func OpenRuns(path string) (*Runs, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create run history dir: %w", err)
+	}
+
+	s := &Runs{path: path}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open run history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var r Run
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// Skip a torn trailing write rather than refusing to start
+			continue
+		}
+		s.runs = append(s.runs, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read run history: %w", err)
+	}
+	return s, nil
+}
+
+// Add appends a finished run.
+func (s *Runs) Add(r Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open run history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write run history: %w", err)
+	}
+	s.runs = append(s.runs, r)
+	return nil
+}
+
+// List returns a schedule's runs, newest first, along with their total count.
+func (s *Runs) List(schedule string, limit, offset int) ([]Run, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched := []Run{}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if s.runs[i].Schedule == schedule {
+			matched = append(matched, s.runs[i])
+		}
+	}
+	total := len(matched)
+	if offset >= total {
+		return []Run{}, total
+	}
+	matched = matched[offset:]
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched, total
+}
+
+// Last returns a schedule's most recent run.
+func (s *Runs) Last(schedule string) (Run, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if s.runs[i].Schedule == schedule {
+			return s.runs[i], true
+		}
+	}
+	return Run{}, false
+}
@@ -0,0 +1,299 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sink types.
+const (
+	TypeDir     = "dir"
+	TypeS3      = "s3"
+	TypeWebhook = "webhook"
+)
+
+const defaultSinkTimeout = 30 * time.Second
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Config is the on-disk sink configuration (JSON). Values may refer to
+// environment variables as ${NAME}, to keep credentials out of the file.
+type Config struct {
+	Sinks []SinkConfig `json:"sinks"`
+}
+
+// SinkConfig describes one named destination for scheduled results.
+type SinkConfig struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`              // TypeDir, TypeS3 or TypeWebhook
+	Timeout string `json:"timeout,omitempty"` // Go duration per delivery, default 30s
+
+	// dir
+	Path string `json:"path,omitempty"`
+	Keep int    `json:"keep,omitempty"` // Files kept per schedule; 0 keeps every file
+
+	// s3
+	Endpoint        string `json:"endpoint,omitempty"` // e.g. http://localhost:9000 for MinIO; AWS when empty
+	Region          string `json:"region,omitempty"`   // us-east-1 when empty
+	Bucket          string `json:"bucket,omitempty"`
+	Prefix          string `json:"prefix,omitempty"` // Key prefix, e.g. "reports/"
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	PathStyle       bool   `json:"pathStyle,omitempty"` // bucket in the path rather than the host, as MinIO expects
+
+	// webhook
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Secret  string            `json:"secret,omitempty"` // Signs the body with HMAC-SHA256 when set
+}
+
+// Delivery is one result on its way to a sink.
+type Delivery struct {
+	Schedule    string    // Schedule ID
+	Name        string    // Schedule name
+	Run         string    // Run ID
+	Time        time.Time // When the run started
+	Format      string    // "csv" or "json"
+	ContentType string
+	Body        []byte
+	Rows        int
+}
+
+// FileName names the delivered file after the run's start time, so names
+// sort chronologically.
+func (d Delivery) FileName() string {
+	return d.Time.UTC().Format("20060102T150405Z") + "." + d.Format
+}
+
+// Sink delivers results somewhere. Deliver returns where the result went,
+// for the run history.
+type Sink interface {
+	Deliver(ctx context.Context, d Delivery) (string, error)
+}
+
+// Sinks holds the configured sinks by name.
+type Sinks struct {
+	byName   map[string]Sink
+	timeouts map[string]time.Duration
+	names    []string
+}
+
+// LoadConfig reads a sinks file, expanding environment variables in its values.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read sinks: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse sinks: %w", err)
+	}
+	for i := range cfg.Sinks {
+		s := &cfg.Sinks[i]
+		for _, v := range []*string{&s.Path, &s.Endpoint, &s.Bucket, &s.AccessKeyID, &s.SecretAccessKey, &s.SessionToken, &s.URL, &s.Secret} {
+			*v = os.ExpandEnv(*v)
+		}
+		for k, v := range s.Headers {
+			s.Headers[k] = os.ExpandEnv(v)
+		}
+	}
+	return cfg, nil
+}
+
+// NewSinks checks a configuration and builds its sinks.
+func NewSinks(cfg Config) (*Sinks, error) {
+	s := &Sinks{byName: make(map[string]Sink), timeouts: make(map[string]time.Duration)}
+	for _, sc := range cfg.Sinks {
+		if !validName.MatchString(sc.Name) {
+			return nil, fmt.Errorf("invalid sink name %q", sc.Name)
+		}
+		if _, dup := s.byName[sc.Name]; dup {
+			return nil, fmt.Errorf("duplicate sink %q", sc.Name)
+		}
+		timeout := defaultSinkTimeout
+		if sc.Timeout != "" {
+			d, err := time.ParseDuration(sc.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("sink %s: invalid timeout %q", sc.Name, sc.Timeout)
+			}
+			timeout = d
+		}
+
+		var sink Sink
+		var err error
+		switch sc.Type {
+		case TypeDir:
+			sink, err = newDirSink(sc)
+		case TypeS3:
+			sink, err = newS3Sink(sc)
+		case TypeWebhook:
+			sink, err = newWebhookSink(sc)
+		default:
+			err = fmt.Errorf("unknown type %q (use %s, %s or %s)", sc.Type, TypeDir, TypeS3, TypeWebhook)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sink %s: %w", sc.Name, err)
+		}
+		s.byName[sc.Name] = sink
+		s.timeouts[sc.Name] = timeout
+		s.names = append(s.names, sc.Name)
+	}
+	slices.Sort(s.names)
+	return s, nil
+}
+
+// Names returns the sink names, sorted.
+func (s *Sinks) Names() []string {
+	return s.names
+}
+
+// Has reports whether a sink is configured.
+func (s *Sinks) Has(name string) bool {
+	_, ok := s.byName[name]
+	return ok
+}
+
+// Deliver sends a result to the named sink under its timeout.
+func (s *Sinks) Deliver(ctx context.Context, name string, d Delivery) (string, error) {
+	sink, ok := s.byName[name]
+	if !ok {
+		return "", fmt.Errorf("unknown sink %q", name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeouts[name])
+	defer cancel()
+	return sink.Deliver(ctx, d)
+}
+
+// dirSink writes results to a directory per schedule, keeping the newest files.
+type dirSink struct {
+	path string
+	keep int
+}
+
+func newDirSink(sc SinkConfig) (*dirSink, error) {
+	if sc.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	if sc.Keep < 0 {
+		return nil, errors.New("keep must not be negative")
+	}
+	return &dirSink{path: sc.Path, keep: sc.Keep}, nil
+}
+
+func (s *dirSink) Deliver(ctx context.Context, d Delivery) (string, error) {
+	dir := filepath.Join(s.path, d.Schedule)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, d.FileName())
+	// Write to a temp file first so readers never see a partial result
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, d.Body, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, s.rotate(dir)
+}
+
+// rotate deletes all but the newest keep results in dir.
+func (s *dirSink) rotate(dir string) error {
+	if s.keep == 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if ext := filepath.Ext(e.Name()); e.Type().IsRegular() && (ext == ".csv" || ext == ".json") {
+			files = append(files, e.Name())
+		}
+	}
+	slices.Sort(files)
+	for len(files) > s.keep {
+		if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+			return fmt.Errorf("rotate: %w", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// webhookSink POSTs results to a URL.
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	secret  []byte
+	client  *http.Client
+}
+
+func newWebhookSink(sc SinkConfig) (*webhookSink, error) {
+	if !strings.HasPrefix(sc.URL, "http://") && !strings.HasPrefix(sc.URL, "https://") {
+		return nil, errors.New("url must be an http:// or https:// URL")
+	}
+	return &webhookSink{url: sc.URL, headers: sc.Headers, secret: []byte(sc.Secret), client: http.DefaultClient}, nil
+}
+
+func (s *webhookSink) Deliver(ctx context.Context, d Delivery) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(d.Body))
+	if err != nil {
+		return "", err
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", d.ContentType)
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.FileName()))
+	req.Header.Set("X-WebDbReader-Schedule", d.Schedule)
+	req.Header.Set("X-WebDbReader-Run", d.Run)
+	req.Header.Set("X-WebDbReader-Rows", strconv.Itoa(d.Rows))
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(d.Body)
+		req.Header.Set("X-WebDbReader-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return "", err
+	}
+	// Leave out the query and credentials, which may hold secrets
+	return req.URL.Scheme + "://" + req.URL.Host + req.URL.Path, nil
+}
+
+// checkResponse turns a non-2xx response into an error quoting the start
+// of its body.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return errors.New(resp.Status)
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// Dialect covers what differs between database engines: catalog
+// introspection, query syntax and how to open a read-only transaction.
+type Dialect interface {
+	// Name is the short identifier used in config, e.g. "postgres".
+	Name() string
+
+	// Title is the engine's display name, e.g. "PostgreSQL".
+	Title() string
+
+	// Syntax returns the lexical rules for analysing queries.
+	Syntax() sqlparse.Syntax
+
+	// LoadTables reads the tables, columns, keys and indexes visible to the connection.
+	LoadTables(ctx context.Context, db *sql.DB) ([]Table, error)
+
+	// BeginReadOnly starts a transaction that rejects writes, with a
+	// server-side statement timeout where the engine scopes one to a
+	// transaction.
+	BeginReadOnly(ctx context.Context, db *sql.DB, timeout time.Duration) (*sql.Tx, error)
+
+	// LimitQuery applies a server-side timeout to a validated query, for
+	// engines that only scope one to a statement. Others return it unchanged.
+	LimitQuery(query string, timeout time.Duration) string
+}
+
+// DialectFor returns the dialect for a database/sql driver name.
+func DialectFor(driver string) (Dialect, error) {
+	switch driver {
+	case "postgres", "pgx":
+		return Postgres{}, nil
+	case "mysql":
+		return MySQL{}, nil
+	case "sqlite", "sqlite3":
+		return SQLite{}, nil
+	case "duckdb":
+		return DuckDB{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q (supported: postgres, mysql, sqlite, duckdb)", driver)
+	}
+}
@@ -0,0 +1,225 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// DuckDB introspects a DuckDB database through its duckdb_* catalog
+// functions and information_schema. Attached databases are not loaded.
+type DuckDB struct{}
+
+// Name returns "duckdb".
+func (DuckDB) Name() string { return "duckdb" }
+
+// Title returns "DuckDB".
+func (DuckDB) Title() string { return "DuckDB" }
+
+// Syntax returns the DuckDB lexical rules, which follow Postgres.
+func (DuckDB) Syntax() sqlparse.Syntax { return sqlparse.Postgres }
+
+// BeginReadOnly starts a plain transaction: the driver rejects
+// TxOptions.ReadOnly. That is safe because database files are opened with
+// access_mode=read_only, and data file sources are an in-memory database of
+// views that only ever sees statements validated as a single SELECT. DuckDB
+// has no statement timeout either; the driver interrupts the query when ctx
+// is done.
+func (DuckDB) BeginReadOnly(ctx context.Context, db *sql.DB, _ time.Duration) (*sql.Tx, error) {
+	return db.BeginTx(ctx, nil)
+}
+
+// LimitQuery returns query unchanged.
+func (DuckDB) LimitQuery(query string, _ time.Duration) string { return query }
+
+// duckKey identifies a table across schemas.
+type duckKey struct{ schema, table string }
+
+// LoadTables reads the tables and views of the current database.
+func (DuckDB) LoadTables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	tables, err := duckTables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := duckColumns(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeys, err := duckPrimaryKeys(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys, err := duckForeignKeys(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := duckIndexes(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		t := &tables[i]
+		key := duckKey{t.Schema, t.Name}
+		t.Columns = columns[key]
+		t.ForeignKeys = foreignKeys[key]
+		t.Indexes = indexes[key]
+
+		for j := range t.Columns {
+			for _, pk := range primaryKeys[key] {
+				if t.Columns[j].Name == pk {
+					t.Columns[j].IsPK = true
+					break
+				}
+			}
+		}
+	}
+	return tables, nil
+}
+
+func duckTables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	query := `
+		SELECT schema_name, table_name, COALESCE(estimated_size, 0)
+		FROM duckdb_tables()
+		WHERE database_name = current_database() AND NOT internal
+		UNION ALL
+		SELECT schema_name, view_name, 0
+		FROM duckdb_views()
+		WHERE database_name = current_database() AND NOT internal
+		ORDER BY 1, 2`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []Table
+	for rows.Next() {
+		var t Table
+		if err := rows.Scan(&t.Schema, &t.Name, &t.RowEstimate); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func duckColumns(ctx context.Context, db *sql.DB) (map[duckKey][]Column, error) {
+	query := `
+		SELECT schema_name, table_name, column_name, data_type, is_nullable, COALESCE(comment, '')
+		FROM duckdb_columns()
+		WHERE database_name = current_database() AND NOT internal
+		ORDER BY schema_name, table_name, column_index`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[duckKey][]Column)
+	for rows.Next() {
+		var key duckKey
+		var col Column
+		if err := rows.Scan(&key.schema, &key.table, &col.Name, &col.Type, &col.Nullable, &col.Comment); err != nil {
+			return nil, err
+		}
+		columns[key] = append(columns[key], col)
+	}
+	return columns, rows.Err()
+}
+
+func duckPrimaryKeys(ctx context.Context, db *sql.DB) (map[duckKey][]string, error) {
+	query := `
+		SELECT schema_name, table_name, unnest(constraint_column_names)
+		FROM duckdb_constraints()
+		WHERE database_name = current_database()
+		  AND constraint_type = 'PRIMARY KEY'`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pks := make(map[duckKey][]string)
+	for rows.Next() {
+		var key duckKey
+		var col string
+		if err := rows.Scan(&key.schema, &key.table, &col); err != nil {
+			return nil, err
+		}
+		pks[key] = append(pks[key], col)
+	}
+	return pks, rows.Err()
+}
+
+func duckForeignKeys(ctx context.Context, db *sql.DB) (map[duckKey][]ForeignKey, error) {
+	query := `
+		SELECT kcu.table_schema, kcu.table_name, kcu.column_name, ref.table_name, ref.column_name
+		FROM information_schema.referential_constraints rc
+		JOIN information_schema.key_column_usage kcu
+		  ON kcu.constraint_schema = rc.constraint_schema
+		 AND kcu.constraint_name = rc.constraint_name
+		JOIN information_schema.key_column_usage ref
+		  ON ref.constraint_schema = rc.unique_constraint_schema
+		 AND ref.constraint_name = rc.unique_constraint_name
+		 AND ref.ordinal_position = kcu.position_in_unique_constraint
+		WHERE rc.constraint_catalog = current_database()
+		ORDER BY kcu.table_schema, kcu.table_name, kcu.constraint_name, kcu.ordinal_position`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fks := make(map[duckKey][]ForeignKey)
+	for rows.Next() {
+		var key duckKey
+		var fk ForeignKey
+		if err := rows.Scan(&key.schema, &key.table, &fk.Column, &fk.ForeignTable, &fk.ForeignColumn); err != nil {
+			return nil, err
+		}
+		fks[key] = append(fks[key], fk)
+	}
+	return fks, rows.Err()
+}
+
+// duckIndexes reports UNIQUE constraints; DuckDB's ART indexes only list
+// their key expressions as text.
+func duckIndexes(ctx context.Context, db *sql.DB) (map[duckKey][]Index, error) {
+	query := `
+		SELECT schema_name, table_name, constraint_index, unnest(constraint_column_names)
+		FROM duckdb_constraints()
+		WHERE database_name = current_database()
+		  AND constraint_type = 'UNIQUE'
+		ORDER BY schema_name, table_name, constraint_index`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make(map[duckKey][]Index)
+	for rows.Next() {
+		var key duckKey
+		var n int
+		var col string
+		if err := rows.Scan(&key.schema, &key.table, &n, &col); err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s_unique_%d", key.table, n)
+		indexes[key] = appendIndexColumn(indexes[key], name, true, col)
+	}
+	return indexes, rows.Err()
+}
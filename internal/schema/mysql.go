@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// MySQL introspects MySQL and MariaDB through information_schema, using the
+// STATISTICS table (what SHOW INDEX reads) for primary keys and indexes.
+// Only the connection's current database is loaded.
+type MySQL struct{}
+
+// Name returns "mysql".
+func (MySQL) Name() string { return "mysql" }
+
+// Title returns "MySQL".
+func (MySQL) Title() string { return "MySQL" }
+
+// Syntax returns the MySQL lexical rules.
+func (MySQL) Syntax() sqlparse.Syntax { return sqlparse.MySQL }
+
+// BeginReadOnly starts a READ ONLY transaction. MySQL has no transaction
+// scoped timeout, and a session variable would stay set on the pooled
+// connection afterwards, so LimitQuery caps each statement instead.
+func (MySQL) BeginReadOnly(ctx context.Context, db *sql.DB, _ time.Duration) (*sql.Tx, error) {
+	return db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+}
+
+// LimitQuery caps a SELECT's run time for this statement only: a
+// MAX_EXECUTION_TIME hint on its top-level SELECT for MySQL, which ignores
+// the hint in CTEs and subqueries, and a SET STATEMENT prefix in a comment
+// that only MariaDB executes. Each engine reads the other's as a plain comment.
+func (MySQL) LimitQuery(query string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return query
+	}
+	toks, err := sqlparse.TokenizeWith(query, sqlparse.MySQL)
+	if err != nil {
+		return query
+	}
+	// The least nested SELECT: the top level, or the first branch of a
+	// parenthesized UNION
+	top, topDepth, depth := -1, 0, 0
+	for i, t := range toks {
+		switch {
+		case t.Is("("):
+			depth++
+		case t.Is(")"):
+			depth--
+		case t.Is("select") && (top < 0 || depth < topDepth):
+			top, topDepth = i, depth
+		}
+	}
+	if top >= 0 {
+		end := toks[top].Pos + len("select")
+		query = fmt.Sprintf("%s /*+ MAX_EXECUTION_TIME(%d) */%s", query[:end], timeout.Milliseconds(), query[end:])
+	}
+	return fmt.Sprintf("/*M!100102 SET STATEMENT max_statement_time=%.3f FOR */ %s", timeout.Seconds(), query)
+}
+
+// LoadTables reads the current database from information_schema.
+func (MySQL) LoadTables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	var database sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&database); err != nil {
+		return nil, err
+	}
+	if !database.Valid {
+		return nil, fmt.Errorf("no database selected; add one to the DSN path")
+	}
+
+	tables, err := mysqlTables(ctx, db, database.String)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := mysqlColumns(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeys, indexes, err := mysqlIndexes(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys, err := mysqlForeignKeys(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tables {
+		t := &tables[i]
+		t.Columns = columns[t.Name]
+		t.ForeignKeys = foreignKeys[t.Name]
+		t.Indexes = indexes[t.Name]
+
+		for j := range t.Columns {
+			for _, pk := range primaryKeys[t.Name] {
+				if t.Columns[j].Name == pk {
+					t.Columns[j].IsPK = true
+					break
+				}
+			}
+		}
+	}
+	return tables, nil
+}
+
+func mysqlTables(ctx context.Context, db *sql.DB, database string) ([]Table, error) {
+	// TABLE_ROWS is an estimate for InnoDB, like reltuples in Postgres
+	query := `
+		SELECT TABLE_NAME, COALESCE(TABLE_ROWS, 0)
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE()
+		  AND TABLE_TYPE = 'BASE TABLE'
+		ORDER BY TABLE_NAME`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []Table
+	for rows.Next() {
+		t := Table{Schema: database}
+		if err := rows.Scan(&t.Name, &t.RowEstimate); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func mysqlColumns(ctx context.Context, db *sql.DB) (map[string][]Column, error) {
+	query := `
+		SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'YES', COLUMN_COMMENT
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE()
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string][]Column)
+	for rows.Next() {
+		var tableName string
+		var col Column
+		if err := rows.Scan(&tableName, &col.Name, &col.Type, &col.Nullable, &col.Comment); err != nil {
+			return nil, err
+		}
+		columns[tableName] = append(columns[tableName], col)
+	}
+	return columns, rows.Err()
+}
+
+// mysqlIndexes returns primary key columns and secondary indexes per table.
+func mysqlIndexes(ctx context.Context, db *sql.DB) (map[string][]string, map[string][]Index, error) {
+	query := `
+		SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE = 0, COLUMN_NAME
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE()
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	pks := make(map[string][]string)
+	indexes := make(map[string][]Index)
+	for rows.Next() {
+		var tableName, indexName string
+		var unique bool
+		var colName sql.NullString // NULL for functional key parts
+		if err := rows.Scan(&tableName, &indexName, &unique, &colName); err != nil {
+			return nil, nil, err
+		}
+		if !colName.Valid {
+			continue
+		}
+		if indexName == "PRIMARY" {
+			pks[tableName] = append(pks[tableName], colName.String)
+			continue
+		}
+		indexes[tableName] = appendIndexColumn(indexes[tableName], indexName, unique, colName.String)
+	}
+	return pks, indexes, rows.Err()
+}
+
+func mysqlForeignKeys(ctx context.Context, db *sql.DB) (map[string][]ForeignKey, error) {
+	query := `
+		SELECT TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE()
+		  AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fks := make(map[string][]ForeignKey)
+	for rows.Next() {
+		var tableName string
+		var fk ForeignKey
+		if err := rows.Scan(&tableName, &fk.Column, &fk.ForeignTable, &fk.ForeignColumn); err != nil {
+			return nil, err
+		}
+		fks[tableName] = append(fks[tableName], fk)
+	}
+	return fks, rows.Err()
+}
@@ -0,0 +1,223 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMySQLLimitQuery(t *testing.T) {
+	const prefix = "/*M!100102 SET STATEMENT max_statement_time=5.000 FOR */ "
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			"SELECT id FROM users",
+			"SELECT /*+ MAX_EXECUTION_TIME(5000) */ id FROM users",
+		},
+		{
+			"WITH t AS (select 1 AS n) SELECT n FROM t",
+			"WITH t AS (select 1 AS n) SELECT /*+ MAX_EXECUTION_TIME(5000) */ n FROM t",
+		},
+		{
+			"SELECT n FROM (SELECT 1 AS n) t WHERE n IN (SELECT 1)",
+			"SELECT /*+ MAX_EXECUTION_TIME(5000) */ n FROM (SELECT 1 AS n) t WHERE n IN (SELECT 1)",
+		},
+		{
+			"(SELECT 1) UNION (SELECT 2)",
+			"(SELECT /*+ MAX_EXECUTION_TIME(5000) */ 1) UNION (SELECT 2)",
+		},
+		{
+			"-- select in a comment\nSELECT 'select'",
+			"-- select in a comment\nSELECT /*+ MAX_EXECUTION_TIME(5000) */ 'select'",
+		},
+	}
+	for _, tt := range tests {
+		if got := (MySQL{}).LimitQuery(tt.query, 5*time.Second); got != prefix+tt.want {
+			t.Errorf("LimitQuery(%q)\n got %q\nwant %q", tt.query, got, prefix+tt.want)
+		}
+	}
+
+	if got := (MySQL{}).LimitQuery("SELECT 1", 0); got != "SELECT 1" {
+		t.Errorf("LimitQuery without a timeout = %q", got)
+	}
+}
+
+func TestMySQLLoadTables(t *testing.T) {
+	db := sql.OpenDB(fakeMySQL{
+		"SELECT DATABASE()": {{"shop"}},
+		"information_schema.TABLES": {
+			{"orders", int64(120)},
+			{"users", int64(10)},
+		},
+		"information_schema.COLUMNS": {
+			{"orders", "id", "bigint", int64(0), ""},
+			{"orders", "user_id", "bigint", int64(0), ""},
+			{"orders", "note", "text", int64(1), "Free text"},
+			{"users", "id", "bigint", int64(0), ""},
+			{"users", "email", "varchar(255)", int64(0), "Login"},
+		},
+		"information_schema.STATISTICS": {
+			{"orders", "PRIMARY", int64(1), "id"},
+			{"orders", "by_user", int64(0), "user_id"},
+			{"orders", "by_user", int64(0), "id"},
+			{"orders", "functional", int64(0), nil},
+			{"users", "PRIMARY", int64(1), "id"},
+			{"users", "email", int64(1), "email"},
+		},
+		"information_schema.KEY_COLUMN_USAGE": {
+			{"orders", "user_id", "users", "id"},
+		},
+	})
+	defer db.Close()
+
+	got, err := (MySQL{}).LoadTables(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Table{
+		{
+			Schema: "shop",
+			Name:   "orders",
+			Columns: []Column{
+				{Name: "id", Type: "bigint", IsPK: true},
+				{Name: "user_id", Type: "bigint"},
+				{Name: "note", Type: "text", Nullable: true, Comment: "Free text"},
+			},
+			ForeignKeys: []ForeignKey{{Column: "user_id", ForeignTable: "users", ForeignColumn: "id"}},
+			Indexes:     []Index{{Name: "by_user", Columns: []string{"user_id", "id"}}},
+			RowEstimate: 120,
+		},
+		{
+			Schema: "shop",
+			Name:   "users",
+			Columns: []Column{
+				{Name: "id", Type: "bigint", IsPK: true},
+				{Name: "email", Type: "varchar(255)", Comment: "Login"},
+			},
+			Indexes:     []Index{{Name: "email", Columns: []string{"email"}, Unique: true}},
+			RowEstimate: 10,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadTables:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestMySQLLoadTablesNoDatabase(t *testing.T) {
+	db := sql.OpenDB(fakeMySQL{"SELECT DATABASE()": {{nil}}})
+	defer db.Close()
+	if _, err := (MySQL{}).LoadTables(context.Background(), db); err == nil {
+		t.Error("LoadTables without a database succeeded")
+	}
+}
+
+// TestMySQLLoadTablesLive runs against a real server, e.g. a local container:
+//
+//	docker run -d -p 3306:3306 -e MYSQL_ALLOW_EMPTY_PASSWORD=1 -e MYSQL_DATABASE=test mysql:8
+//	MYSQL_TEST_DSN='root@tcp(localhost:3306)/test' go test ./internal/schema
+func TestMySQLLoadTablesLive(t *testing.T) {
+	dsn := os.Getenv("MYSQL_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_TEST_DSN not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS wdr_orders, wdr_users",
+		"CREATE TABLE wdr_users (id BIGINT PRIMARY KEY, email VARCHAR(255) NOT NULL UNIQUE COMMENT 'Login')",
+		`CREATE TABLE wdr_orders (id BIGINT PRIMARY KEY, user_id BIGINT NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES wdr_users (id))`,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { db.Exec("DROP TABLE IF EXISTS wdr_orders, wdr_users") })
+
+	tables, err := (MySQL{}).LoadTables(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]Table)
+	for _, tbl := range tables {
+		byName[tbl.Name] = tbl
+	}
+	users, orders := byName["wdr_users"], byName["wdr_orders"]
+	if len(users.Columns) != 2 || !users.Columns[0].IsPK || users.Columns[1].Comment != "Login" {
+		t.Errorf("wdr_users = %+v", users)
+	}
+	if len(users.Indexes) != 1 || !users.Indexes[0].Unique {
+		t.Errorf("wdr_users indexes = %+v", users.Indexes)
+	}
+	if want := []ForeignKey{{Column: "user_id", ForeignTable: "wdr_users", ForeignColumn: "id"}}; !reflect.DeepEqual(orders.ForeignKeys, want) {
+		t.Errorf("wdr_orders foreign keys = %+v", orders.ForeignKeys)
+	}
+
+	// The hint and MariaDB prefix must be accepted by the server
+	var n int
+	query := (MySQL{}).LimitQuery("WITH t AS (SELECT 1 AS n) SELECT n FROM t", 5*time.Second)
+	if err := db.QueryRowContext(ctx, query).Scan(&n); err != nil || n != 1 {
+		t.Errorf("limited query: %d, %v", n, err)
+	}
+}
+
+// fakeMySQL is an in-process stand-in for a MySQL server. It answers each
+// query with the rows of the first key the query contains.
+type fakeMySQL map[string][][]any
+
+func (f fakeMySQL) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f fakeMySQL) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ answers fakeMySQL }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	for key, rows := range c.answers {
+		if strings.Contains(query, key) {
+			return &fakeRows{rows: rows}, nil
+		}
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+type fakeRows struct {
+	rows [][]any
+	next int
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	for i, v := range r.rows[r.next] {
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
@@ -0,0 +1,286 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// Postgres introspects PostgreSQL through information_schema and pg_catalog.
+type Postgres struct{}
+
+// Name returns "postgres".
+func (Postgres) Name() string { return "postgres" }
+
+// Title returns "PostgreSQL".
+func (Postgres) Title() string { return "PostgreSQL" }
+
+// Syntax returns the Postgres lexical rules.
+func (Postgres) Syntax() sqlparse.Syntax { return sqlparse.Postgres }
+
+// BeginReadOnly starts a READ ONLY transaction with a local statement_timeout.
+func (Postgres) BeginReadOnly(ctx context.Context, db *sql.DB, timeout time.Duration) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		stmt := fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// LimitQuery returns query unchanged; BeginReadOnly sets the timeout.
+func (Postgres) LimitQuery(query string, _ time.Duration) string { return query }
+
+// LoadTables reads the public schema from the Postgres catalogs.
+func (Postgres) LoadTables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	tableNames, err := getTableNames(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := getColumns(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeys, err := getPrimaryKeys(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys, err := getForeignKeys(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	rowEstimates, err := getRowEstimates(ctx, db)
+	if err != nil {
+		// Non-fatal: continue without estimates
+		rowEstimates = make(map[string]int64)
+	}
+
+	indexes, err := getIndexes(ctx, db)
+	if err != nil {
+		// Non-fatal: continue without indexes
+		indexes = make(map[string][]Index)
+	}
+
+	tables := make([]Table, 0, len(tableNames))
+	for _, name := range tableNames {
+		table := Table{
+			Schema:      "public",
+			Name:        name,
+			Columns:     columns[name],
+			ForeignKeys: foreignKeys[name],
+			RowEstimate: rowEstimates[name],
+			Indexes:     indexes[name],
+		}
+
+		// Mark primary key columns
+		pkCols := primaryKeys[name]
+		for i := range table.Columns {
+			for _, pk := range pkCols {
+				if table.Columns[i].Name == pk {
+					table.Columns[i].IsPK = true
+					break
+				}
+			}
+		}
+
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+func getTableNames(ctx context.Context, db *sql.DB) ([]string, error) {
+	query := `
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = 'public'
+		  AND table_type = 'BASE TABLE'
+		ORDER BY table_name`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func getColumns(ctx context.Context, db *sql.DB) (map[string][]Column, error) {
+	query := `
+		SELECT
+			c.table_name,
+			c.column_name,
+			c.data_type,
+			c.is_nullable = 'YES' AS nullable,
+			COALESCE(pgd.description, '') AS comment
+		FROM information_schema.columns c
+		LEFT JOIN pg_catalog.pg_statio_all_tables st
+			ON st.schemaname = c.table_schema AND st.relname = c.table_name
+		LEFT JOIN pg_catalog.pg_description pgd
+			ON pgd.objoid = st.relid AND pgd.objsubid = c.ordinal_position
+		WHERE c.table_schema = 'public'
+		ORDER BY c.table_name, c.ordinal_position`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string][]Column)
+	for rows.Next() {
+		var tableName string
+		var col Column
+		if err := rows.Scan(&tableName, &col.Name, &col.Type, &col.Nullable, &col.Comment); err != nil {
+			return nil, err
+		}
+		columns[tableName] = append(columns[tableName], col)
+	}
+	return columns, rows.Err()
+}
+
+func getPrimaryKeys(ctx context.Context, db *sql.DB) (map[string][]string, error) {
+	query := `
+		SELECT
+			tc.table_name,
+			kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON tc.constraint_name = kcu.constraint_name
+			AND tc.table_schema = kcu.table_schema
+		WHERE tc.constraint_type = 'PRIMARY KEY'
+		  AND tc.table_schema = 'public'
+		ORDER BY tc.table_name, kcu.ordinal_position`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pks := make(map[string][]string)
+	for rows.Next() {
+		var tableName, colName string
+		if err := rows.Scan(&tableName, &colName); err != nil {
+			return nil, err
+		}
+		pks[tableName] = append(pks[tableName], colName)
+	}
+	return pks, rows.Err()
+}
+
+func getForeignKeys(ctx context.Context, db *sql.DB) (map[string][]ForeignKey, error) {
+	query := `
+		SELECT
+			tc.table_name,
+			kcu.column_name,
+			ccu.table_name AS foreign_table,
+			ccu.column_name AS foreign_column
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON tc.constraint_name = kcu.constraint_name
+			AND tc.table_schema = kcu.table_schema
+		JOIN information_schema.constraint_column_usage ccu
+			ON tc.constraint_name = ccu.constraint_name
+			AND tc.table_schema = ccu.table_schema
+		WHERE tc.constraint_type = 'FOREIGN KEY'
+		  AND tc.table_schema = 'public'`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fks := make(map[string][]ForeignKey)
+	for rows.Next() {
+		var tableName string
+		var fk ForeignKey
+		if err := rows.Scan(&tableName, &fk.Column, &fk.ForeignTable, &fk.ForeignColumn); err != nil {
+			return nil, err
+		}
+		fks[tableName] = append(fks[tableName], fk)
+	}
+	return fks, rows.Err()
+}
+
+func getRowEstimates(ctx context.Context, db *sql.DB) (map[string]int64, error) {
+	query := `
+		SELECT relname, reltuples::bigint
+		FROM pg_class
+		WHERE relnamespace = 'public'::regnamespace
+		  AND relkind = 'r'`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	estimates := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var count int64
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			count = 0
+		}
+		estimates[name] = count
+	}
+	return estimates, rows.Err()
+}
+
+func getIndexes(ctx context.Context, db *sql.DB) (map[string][]Index, error) {
+	query := `
+		SELECT t.relname, i.relname, ix.indisunique, a.attname
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = 'public'
+		  AND NOT ix.indisprimary
+		ORDER BY t.relname, i.relname, k.ord`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make(map[string][]Index)
+	for rows.Next() {
+		var tableName, indexName, colName string
+		var unique bool
+		if err := rows.Scan(&tableName, &indexName, &unique, &colName); err != nil {
+			return nil, err
+		}
+		indexes[tableName] = appendIndexColumn(indexes[tableName], indexName, unique, colName)
+	}
+	return indexes, rows.Err()
+}
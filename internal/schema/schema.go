@@ -3,7 +3,10 @@ package schema
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -14,14 +17,22 @@ import (
 type Cache struct {
 	Tables      []Table
 	LastRefresh time.Time
+	dialect     Dialect
+	fingerprint string
 	mu          sync.RWMutex
 }
 
+// Filter restricts what a caller may see of a table. It returns the table
+// with hidden columns removed, or false to hide the table entirely.
+type Filter func(Table) (Table, bool)
+
 // Table represents a database table and its structure.
 type Table struct {
+	Schema      string
 	Name        string
 	Columns     []Column
 	ForeignKeys []ForeignKey
+	Indexes     []Index // Secondary indexes; the primary key is marked on columns
 	RowEstimate int64
 }
 
@@ -41,26 +52,61 @@ type ForeignKey struct {
 	ForeignColumn string
 }
 
-// NewCache creates an empty schema cache.
-func NewCache() *Cache {
-	return &Cache{}
+// Index represents a secondary index.
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// NewCache creates an empty schema cache for a database of the given dialect.
+func NewCache(dialect Dialect) *Cache {
+	return &Cache{dialect: dialect}
+}
+
+// Dialect returns the dialect the cache introspects with.
+func (c *Cache) Dialect() Dialect {
+	return c.dialect
 }
 
 // Load fetches the schema from the database and caches it.
 func (c *Cache) Load(ctx context.Context, db *sql.DB) error {
-	tables, err := loadTables(ctx, db)
+	tables, err := c.dialect.LoadTables(ctx, db)
 	if err != nil {
 		return fmt.Errorf("load tables: %w", err)
 	}
 
+	fingerprint := Fingerprint(tables)
+
 	c.mu.Lock()
 	c.Tables = tables
 	c.LastRefresh = time.Now()
+	c.fingerprint = fingerprint
 	c.mu.Unlock()
 
 	return nil
 }
 
+// Fingerprint returns a hash of the cached schema. It is empty before the
+// first Load.
+func (c *Cache) Fingerprint() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.fingerprint
+}
+
+// Fingerprint hashes the structure of tables: it changes whenever a table,
+// column, key or index does, but not with row estimates.
+func Fingerprint(tables []Table) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, t := range tables {
+		t.RowEstimate = 0
+		_ = enc.Encode(t) // Plain structs always encode
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
 // GetTables returns a copy of the cached tables.
 func (c *Cache) GetTables() []Table {
 	c.mu.RLock()
@@ -71,17 +117,37 @@ func (c *Cache) GetTables() []Table {
 	return tables
 }
 
+// GetTablesFiltered returns the cached tables visible through the filter.
+// A nil filter returns every table.
+func (c *Cache) GetTablesFiltered(f Filter) []Table {
+	tables := c.GetTables()
+	if f == nil {
+		return tables
+	}
+
+	visible := tables[:0]
+	for _, t := range tables {
+		if t, ok := f(t); ok {
+			visible = append(visible, t)
+		}
+	}
+	return visible
+}
+
 // ToText serializes the schema to a text format suitable for LLM prompts.
 func (c *Cache) ToText() string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	return c.ToTextFiltered(nil)
+}
 
-	if len(c.Tables) == 0 {
+// ToTextFiltered serializes only the tables and columns visible through the filter.
+func (c *Cache) ToTextFiltered(f Filter) string {
+	tables := c.GetTablesFiltered(f)
+	if len(tables) == 0 {
 		return "(no tables found)"
 	}
 
 	var sb strings.Builder
-	for i, table := range c.Tables {
+	for i, table := range tables {
 		if i > 0 {
 			sb.WriteString("\n")
 		}
@@ -140,210 +206,23 @@ func tableToText(t Table) string {
 		sb.WriteString("\n")
 	}
 
-	return sb.String()
-}
-
-func loadTables(ctx context.Context, db *sql.DB) ([]Table, error) {
-	tableNames, err := getTableNames(ctx, db)
-	if err != nil {
-		return nil, err
-	}
-
-	columns, err := getColumns(ctx, db)
-	if err != nil {
-		return nil, err
-	}
-
-	primaryKeys, err := getPrimaryKeys(ctx, db)
-	if err != nil {
-		return nil, err
-	}
-
-	foreignKeys, err := getForeignKeys(ctx, db)
-	if err != nil {
-		return nil, err
-	}
-
-	rowEstimates, err := getRowEstimates(ctx, db)
-	if err != nil {
-		// Non-fatal: continue without estimates
-		rowEstimates = make(map[string]int64)
-	}
-
-	tables := make([]Table, 0, len(tableNames))
-	for _, name := range tableNames {
-		table := Table{
-			Name:        name,
-			Columns:     columns[name],
-			ForeignKeys: foreignKeys[name],
-			RowEstimate: rowEstimates[name],
-		}
-
-		// Mark primary key columns
-		pkCols := primaryKeys[name]
-		for i := range table.Columns {
-			for _, pk := range pkCols {
-				if table.Columns[i].Name == pk {
-					table.Columns[i].IsPK = true
-					break
-				}
-			}
-		}
-
-		tables = append(tables, table)
-	}
-
-	return tables, nil
-}
-
-func getTableNames(ctx context.Context, db *sql.DB) ([]string, error) {
-	query := `
-		SELECT table_name
-		FROM information_schema.tables
-		WHERE table_schema = 'public'
-		  AND table_type = 'BASE TABLE'
-		ORDER BY table_name`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var names []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return nil, err
-		}
-		names = append(names, name)
-	}
-	return names, rows.Err()
-}
-
-func getColumns(ctx context.Context, db *sql.DB) (map[string][]Column, error) {
-	query := `
-		SELECT
-			c.table_name,
-			c.column_name,
-			c.data_type,
-			c.is_nullable = 'YES' AS nullable,
-			COALESCE(pgd.description, '') AS comment
-		FROM information_schema.columns c
-		LEFT JOIN pg_catalog.pg_statio_all_tables st
-			ON st.schemaname = c.table_schema AND st.relname = c.table_name
-		LEFT JOIN pg_catalog.pg_description pgd
-			ON pgd.objoid = st.relid AND pgd.objsubid = c.ordinal_position
-		WHERE c.table_schema = 'public'
-		ORDER BY c.table_name, c.ordinal_position`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	columns := make(map[string][]Column)
-	for rows.Next() {
-		var tableName string
-		var col Column
-		if err := rows.Scan(&tableName, &col.Name, &col.Type, &col.Nullable, &col.Comment); err != nil {
-			return nil, err
-		}
-		columns[tableName] = append(columns[tableName], col)
-	}
-	return columns, rows.Err()
-}
-
-func getPrimaryKeys(ctx context.Context, db *sql.DB) (map[string][]string, error) {
-	query := `
-		SELECT
-			tc.table_name,
-			kcu.column_name
-		FROM information_schema.table_constraints tc
-		JOIN information_schema.key_column_usage kcu
-			ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-		WHERE tc.constraint_type = 'PRIMARY KEY'
-		  AND tc.table_schema = 'public'
-		ORDER BY tc.table_name, kcu.ordinal_position`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	pks := make(map[string][]string)
-	for rows.Next() {
-		var tableName, colName string
-		if err := rows.Scan(&tableName, &colName); err != nil {
-			return nil, err
+	for _, idx := range t.Indexes {
+		kind := "INDEX"
+		if idx.Unique {
+			kind = "UNIQUE INDEX"
 		}
-		pks[tableName] = append(pks[tableName], colName)
+		sb.WriteString(fmt.Sprintf("  %s %s (%s)\n", kind, idx.Name, strings.Join(idx.Columns, ", ")))
 	}
-	return pks, rows.Err()
-}
 
-func getForeignKeys(ctx context.Context, db *sql.DB) (map[string][]ForeignKey, error) {
-	query := `
-		SELECT
-			tc.table_name,
-			kcu.column_name,
-			ccu.table_name AS foreign_table,
-			ccu.column_name AS foreign_column
-		FROM information_schema.table_constraints tc
-		JOIN information_schema.key_column_usage kcu
-			ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-		JOIN information_schema.constraint_column_usage ccu
-			ON tc.constraint_name = ccu.constraint_name
-			AND tc.table_schema = ccu.table_schema
-		WHERE tc.constraint_type = 'FOREIGN KEY'
-		  AND tc.table_schema = 'public'`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	fks := make(map[string][]ForeignKey)
-	for rows.Next() {
-		var tableName string
-		var fk ForeignKey
-		if err := rows.Scan(&tableName, &fk.Column, &fk.ForeignTable, &fk.ForeignColumn); err != nil {
-			return nil, err
-		}
-		fks[tableName] = append(fks[tableName], fk)
-	}
-	return fks, rows.Err()
+	return sb.String()
 }
 
-func getRowEstimates(ctx context.Context, db *sql.DB) (map[string]int64, error) {
-	query := `
-		SELECT relname, reltuples::bigint
-		FROM pg_class
-		WHERE relnamespace = 'public'::regnamespace
-		  AND relkind = 'r'`
-
-	rows, err := db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	estimates := make(map[string]int64)
-	for rows.Next() {
-		var name string
-		var count int64
-		if err := rows.Scan(&name, &count); err != nil {
-			return nil, err
-		}
-		if count < 0 {
-			count = 0
-		}
-		estimates[name] = count
+// appendIndexColumn adds a column to the named index, creating it if it is
+// new. Rows must arrive grouped by index in column order.
+func appendIndexColumn(indexes []Index, name string, unique bool, column string) []Index {
+	if n := len(indexes); n > 0 && indexes[n-1].Name == name {
+		indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+		return indexes
 	}
-	return estimates, rows.Err()
+	return append(indexes, Index{Name: name, Columns: []string{column}, Unique: unique})
 }
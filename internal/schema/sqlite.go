@@ -0,0 +1,174 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+)
+
+// SQLite introspects a SQLite file through sqlite_master and the table-valued
+// pragma functions. Attached databases are not loaded.
+type SQLite struct{}
+
+// Name returns "sqlite".
+func (SQLite) Name() string { return "sqlite" }
+
+// Title returns "SQLite".
+func (SQLite) Title() string { return "SQLite" }
+
+// Syntax returns the SQLite lexical rules.
+func (SQLite) Syntax() sqlparse.Syntax { return sqlparse.SQLite }
+
+// BeginReadOnly starts a read-only transaction. SQLite has no statement
+// timeout; the driver interrupts the query when ctx is done.
+func (SQLite) BeginReadOnly(ctx context.Context, db *sql.DB, _ time.Duration) (*sql.Tx, error) {
+	return db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+}
+
+// LimitQuery returns query unchanged.
+func (SQLite) LimitQuery(query string, _ time.Duration) string { return query }
+
+// LoadTables reads the tables and views of the main database.
+func (SQLite) LoadTables(ctx context.Context, db *sql.DB) ([]Table, error) {
+	names, err := sqliteTableNames(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]Table, 0, len(names))
+	pks := make(map[string]string) // Single-column primary key per table, for implicit FK targets
+	for _, name := range names {
+		t := Table{Schema: "main", Name: name}
+		if t.Columns, err = sqliteColumns(ctx, db, name); err != nil {
+			return nil, err
+		}
+		if t.ForeignKeys, err = sqliteForeignKeys(ctx, db, name); err != nil {
+			return nil, err
+		}
+		if t.Indexes, err = sqliteIndexes(ctx, db, name); err != nil {
+			return nil, err
+		}
+
+		var pkCols []string
+		for _, c := range t.Columns {
+			if c.IsPK {
+				pkCols = append(pkCols, c.Name)
+			}
+		}
+		if len(pkCols) == 1 {
+			pks[name] = pkCols[0]
+		}
+		tables = append(tables, t)
+	}
+
+	// REFERENCES t without a column list points at t's primary key
+	for i := range tables {
+		for j, fk := range tables[i].ForeignKeys {
+			if fk.ForeignColumn == "" {
+				tables[i].ForeignKeys[j].ForeignColumn = pks[fk.ForeignTable]
+			}
+		}
+	}
+	return tables, nil
+}
+
+func sqliteTableNames(ctx context.Context, db *sql.DB) ([]string, error) {
+	query := `
+		SELECT name
+		FROM sqlite_master
+		WHERE type IN ('table', 'view')
+		  AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func sqliteColumns(ctx context.Context, db *sql.DB, table string) ([]Column, error) {
+	query := `SELECT name, type, "notnull", pk FROM pragma_table_info(?) ORDER BY cid`
+
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []Column
+	for rows.Next() {
+		var col Column
+		var notNull bool
+		var pk int
+		if err := rows.Scan(&col.Name, &col.Type, &notNull, &pk); err != nil {
+			return nil, err
+		}
+		col.Nullable = !notNull
+		col.IsPK = pk > 0
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+func sqliteForeignKeys(ctx context.Context, db *sql.DB, table string) ([]ForeignKey, error) {
+	query := `SELECT "from", "table", COALESCE("to", '') FROM pragma_foreign_key_list(?) ORDER BY id, seq`
+
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []ForeignKey
+	for rows.Next() {
+		var fk ForeignKey
+		if err := rows.Scan(&fk.Column, &fk.ForeignTable, &fk.ForeignColumn); err != nil {
+			return nil, err
+		}
+		fks = append(fks, fk)
+	}
+	return fks, rows.Err()
+}
+
+func sqliteIndexes(ctx context.Context, db *sql.DB, table string) ([]Index, error) {
+	// origin 'pk' is the primary key, already marked on the columns
+	query := `
+		SELECT il.name, il."unique", ii.name
+		FROM pragma_index_list(?) il, pragma_index_info(il.name) ii
+		WHERE il.origin <> 'pk'
+		ORDER BY il.name, ii.seqno`
+
+	rows, err := db.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []Index
+	for rows.Next() {
+		var indexName string
+		var unique bool
+		var colName sql.NullString // NULL for expressions
+		if err := rows.Scan(&indexName, &unique, &colName); err != nil {
+			return nil, err
+		}
+		if !colName.Valid {
+			continue
+		}
+		indexes = appendIndexColumn(indexes, indexName, unique, colName.String)
+	}
+	return indexes, rows.Err()
+}
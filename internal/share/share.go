@@ -0,0 +1,197 @@
+// Package share stores shareable query permalinks and frozen result snapshots.
+package share
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned for unknown, malformed or expired share IDs.
+var ErrNotFound = errors.New("share not found")
+
+// Share is a stored permalink.
+type Share struct {
+	ID        string    `json:"id"`
+	SQL       string    `json:"sql"`
+	Source    string    `json:"source,omitempty"` // Data source the SQL runs against
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Snapshot  *Snapshot `json:"snapshot,omitempty"`
+}
+
+// Snapshot is a frozen copy of a query result.
+type Snapshot struct {
+	Columns    []string  `json:"columns"`
+	Rows       [][]any   `json:"rows"`
+	Count      int       `json:"count"`
+	More       bool      `json:"more"`
+	Masked     []int     `json:"masked,omitempty"` // Indices of masked columns
+	CapturedAt time.Time `json:"capturedAt"`
+}
+
+// Expired reports whether the share is past its expiry at the given time.
+func (s Share) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// Store keeps one JSON file per share in a directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open prepares a share store rooted at dir.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create share dir: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Create assigns an unguessable ID to the share and persists it.
+func (s *Store) Create(sh Share) (Share, error) {
+	id, err := newID()
+	if err != nil {
+		return Share{}, err
+	}
+	sh.ID = id
+	if sh.CreatedAt.IsZero() {
+		sh.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(sh)
+	if err != nil {
+		return Share{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write to a temp file first so readers never see a partial share
+	tmp := s.path(id) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return Share{}, fmt.Errorf("write share: %w", err)
+	}
+	if err := os.Rename(tmp, s.path(id)); err != nil {
+		os.Remove(tmp)
+		return Share{}, fmt.Errorf("write share: %w", err)
+	}
+	return sh, nil
+}
+
+// Get returns an unexpired share.
+func (s *Store) Get(id string) (Share, error) {
+	if !validID(id) {
+		return Share{}, ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sh, err := s.read(id)
+	if err != nil {
+		return Share{}, err
+	}
+	if sh.Expired(time.Now()) {
+		os.Remove(s.path(id))
+		return Share{}, ErrNotFound
+	}
+	return sh, nil
+}
+
+// Delete removes a share.
+func (s *Store) Delete(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// PurgeExpired deletes every share that has expired and returns how many were removed.
+func (s *Store) PurgeExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("list shares: %w", err)
+	}
+
+	purged := 0
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || !validID(id) {
+			continue
+		}
+		sh, err := s.read(id)
+		if err != nil || !sh.Expired(now) {
+			continue
+		}
+		if err := os.Remove(s.path(id)); err == nil {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *Store) read(id string) (Share, error) {
+	data, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return Share{}, ErrNotFound
+	}
+	if err != nil {
+		return Share{}, fmt.Errorf("read share: %w", err)
+	}
+
+	var sh Share
+	if err := json.Unmarshal(data, &sh); err != nil {
+		return Share{}, fmt.Errorf("decode share: %w", err)
+	}
+	return sh, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+const idBytes = 24
+
+func newID() (string, error) {
+	b := make([]byte, idBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate share id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validID rejects anything that isn't a URL-safe base64 ID, so IDs can be
+// used as file names without path traversal.
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(idBytes) {
+		return false
+	}
+	for _, c := range id {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// fileSchemes are DSN prefixes for local file databases. As in SQLAlchemy the
+// path follows the third slash, so sqlite:///data.db is relative and
+// sqlite:////srv/data.db absolute.
+var fileSchemes = map[string]string{
+	"sqlite:///": "sqlite",
+	"duckdb:///": "duckdb",
+}
+
+// dataFileReaders maps file extensions DuckDB can query directly to the
+// function that reads them.
+var dataFileReaders = map[string]string{
+	".parquet": "read_parquet",
+	".csv":     "read_csv_auto",
+	".tsv":     "read_csv_auto",
+}
+
+// fileSource is a local database file, or for DuckDB a data file or a folder
+// of them, resolved from a sqlite:/// or duckdb:/// DSN.
+type fileSource struct {
+	driver string
+	dsn    string   // What to pass to sql.Open
+	files  []string // Data files to expose as views
+}
+
+// resolveDSN picks the driver for a definition and translates file DSNs into
+// read-only driver DSNs. ok is false for DSNs that aren't file URLs.
+func resolveDSN(driver, dsn string) (fileSource, bool, error) {
+	for prefix, scheme := range fileSchemes {
+		if !strings.HasPrefix(dsn, prefix) {
+			continue
+		}
+		if driver != "" && driver != scheme && !(scheme == "sqlite" && driver == "sqlite3") {
+			return fileSource{}, false, fmt.Errorf("%s DSN given for driver %q", scheme, driver)
+		}
+		path, params, _ := strings.Cut(strings.TrimPrefix(dsn, prefix), "?")
+		if path == "" {
+			return fileSource{}, false, fmt.Errorf("%s DSN has no path", scheme)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fileSource{}, false, fmt.Errorf("open %s: %w", scheme, err)
+		}
+
+		fs := fileSource{driver: scheme}
+		switch {
+		case scheme == "sqlite":
+			fs.dsn = "file:" + path + "?mode=ro&_pragma=query_only(1)"
+		case info.IsDir():
+			if fs.files, err = dataFiles(path); err != nil {
+				return fileSource{}, false, err
+			}
+		case dataFileReaders[strings.ToLower(filepath.Ext(path))] != "":
+			fs.files = []string{path}
+		default:
+			fs.dsn = path + "?access_mode=read_only"
+		}
+		if params != "" {
+			sep := "&"
+			if !strings.Contains(fs.dsn, "?") {
+				sep = "?"
+			}
+			fs.dsn += sep + params
+		}
+		return fs, true, nil
+	}
+	return fileSource{}, false, nil
+}
+
+// dataFiles lists the queryable files directly inside dir.
+func dataFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read data folder: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && dataFileReaders[strings.ToLower(filepath.Ext(e.Name()))] != "" {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s contains no parquet or CSV files", dir)
+	}
+	return files, nil
+}
+
+// createFileViews exposes each data file as a view named after the file, in
+// an in-memory DuckDB database, and returns the view names. Views are
+// replaced, so a failed attempt can be retried.
+func createFileViews(ctx context.Context, db *sql.DB, files []string) ([]string, error) {
+	var names []string
+	for _, f := range files {
+		base := filepath.Base(f)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("two data files would both be named %q", name)
+		}
+		names = append(names, name)
+
+		reader := dataFileReaders[strings.ToLower(filepath.Ext(f))]
+		stmt := fmt.Sprintf(`CREATE OR REPLACE VIEW "%s" AS SELECT * FROM %s('%s')`,
+			strings.ReplaceAll(name, `"`, `""`), reader, strings.ReplaceAll(f, "'", "''"))
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("load %s: %w", base, err)
+		}
+	}
+	return names, nil
+}
+
+// lockDuckDB stops a DuckDB database file from reading other files or
+// databases, and stops queries from turning that back on. Data file sources
+// can't be locked this way because their views read the files on every query;
+// queries against those may only read the views.
+func lockDuckDB(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range []string{
+		"SET enable_external_access = false",
+		"SET lock_configuration = true",
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("lock duckdb configuration: %w", err)
+		}
+	}
+	return nil
+}
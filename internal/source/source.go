@@ -0,0 +1,271 @@
+// Package source manages the named databases queries can run against. Each
+// source has its own connection pool, schema cache, read-only setting and,
+// optionally, its own access policy.
+package source
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/policy"
+	"github.com/JonMunkholm/WebDbReader/internal/schema"
+)
+
+// DefaultName names the single source built from DB_DRIVER / DB_DSN.
+const DefaultName = "default"
+
+// ErrUnknownSource is returned for names that aren't configured.
+var ErrUnknownSource = errors.New("unknown data source")
+
+// ErrUnavailable is returned for sources that can't be reached.
+var ErrUnavailable = errors.New("data source unavailable")
+
+// connectTimeout bounds retrying a source that was unreachable at startup.
+const connectTimeout = 10 * time.Second
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Config is the on-disk sources file (JSON).
+type Config struct {
+	Default string       `json:"default"` // Used when a request names no source; defaults to the first
+	Sources []Definition `json:"sources"`
+}
+
+// Definition describes one data source.
+type Definition struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Driver       string `json:"driver"`   // Inferred from sqlite:/// and duckdb:/// DSNs
+	DSN          string `json:"dsn"`      // ${VAR} references are expanded from the environment
+	ReadOnly     bool   `json:"readOnly"` // Run every query in a read-only transaction
+	MaxOpenConns int    `json:"maxOpenConns"`
+	MaxIdleConns int    `json:"maxIdleConns"`
+	Policy       string `json:"policy"` // Access policy file; overrides POLICY_CONFIG for this source
+}
+
+// Source is an opened data source.
+type Source struct {
+	Name        string
+	Description string
+	Driver      string
+	Dialect     schema.Dialect
+	ReadOnly    bool
+	DB          *sql.DB
+	Schema      *schema.Cache
+	Policy      *policy.Engine // nil when no policy applies
+	Views       []string       // For data file sources, the views over the files; nothing else may be read
+
+	files     []string // Data files to expose as views
+	mu        sync.Mutex
+	connected bool
+}
+
+// Registry holds the configured sources.
+type Registry struct {
+	sources map[string]*Source
+	order   []string
+	def     string
+}
+
+// LoadConfig reads a sources file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read sources: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse sources: %w", err)
+	}
+	// Keep credentials out of the file
+	for i := range cfg.Sources {
+		cfg.Sources[i].DSN = os.ExpandEnv(cfg.Sources[i].DSN)
+	}
+	return cfg, nil
+}
+
+// Open connects to every source and loads its schema. defaultPolicy applies
+// to sources without a policy of their own. Only the default source must be
+// reachable; others that fail to connect are kept and retried when first
+// requested.
+func Open(ctx context.Context, cfg Config, defaultPolicy *policy.Engine) (*Registry, error) {
+	if len(cfg.Sources) == 0 {
+		return nil, errors.New("no data sources configured")
+	}
+
+	reg := &Registry{sources: make(map[string]*Source), def: cfg.Default}
+	if reg.def == "" {
+		reg.def = cfg.Sources[0].Name
+	}
+
+	for _, sc := range cfg.Sources {
+		if !validName.MatchString(sc.Name) {
+			reg.Close()
+			return nil, fmt.Errorf("invalid source name %q", sc.Name)
+		}
+		if _, dup := reg.sources[sc.Name]; dup {
+			reg.Close()
+			return nil, fmt.Errorf("duplicate source %q", sc.Name)
+		}
+
+		src, err := open(ctx, sc, defaultPolicy, sc.Name == reg.def)
+		if err != nil {
+			reg.Close()
+			return nil, fmt.Errorf("source %s: %w", sc.Name, err)
+		}
+		reg.sources[sc.Name] = src
+		reg.order = append(reg.order, sc.Name)
+	}
+
+	if _, ok := reg.sources[reg.def]; !ok {
+		reg.Close()
+		return nil, fmt.Errorf("default source %q is not configured", reg.def)
+	}
+	return reg, nil
+}
+
+func open(ctx context.Context, sc Definition, defaultPolicy *policy.Engine, required bool) (*Source, error) {
+	driver, dsn, readOnly := sc.Driver, sc.DSN, sc.ReadOnly
+	file, isFile, err := resolveDSN(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if isFile {
+		// Local files are always opened read-only
+		driver, dsn, readOnly = file.driver, file.dsn, true
+	}
+	if driver == "" {
+		driver = "postgres"
+	}
+
+	dialect, err := schema.DialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		if driver == "duckdb" {
+			return nil, errors.New("duckdb support is not compiled in; build with -tags duckdb")
+		}
+		return nil, fmt.Errorf("database driver %q is not compiled in", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if sc.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(sc.MaxOpenConns)
+	}
+	if sc.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(sc.MaxIdleConns)
+	}
+
+	src := &Source{
+		Name:        sc.Name,
+		Description: sc.Description,
+		Driver:      driver,
+		Dialect:     dialect,
+		ReadOnly:    readOnly,
+		DB:          db,
+		Schema:      schema.NewCache(dialect),
+		Policy:      defaultPolicy,
+		files:       file.files,
+	}
+	if sc.Policy != "" {
+		if src.Policy, err = policy.Load(sc.Policy); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	if err := src.connect(ctx); err != nil {
+		if required || !errors.Is(err, ErrUnavailable) {
+			db.Close()
+			return nil, err
+		}
+		log.Printf("warning: source %s unreachable: %v", sc.Name, err)
+	}
+	return src, nil
+}
+
+// connect pings the database and, the first time it answers, locks it down
+// and loads its schema. A source unreachable at startup is connected on first
+// use, so it never runs a query before it is locked.
+func (s *Source) connect(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connected {
+		return nil
+	}
+
+	if err := s.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("%w: ping database: %w", ErrUnavailable, err)
+	}
+	if len(s.files) > 0 {
+		views, err := createFileViews(ctx, s.DB, s.files)
+		if err != nil {
+			return err
+		}
+		s.Views = views
+	} else if s.Driver == "duckdb" {
+		if err := lockDuckDB(ctx, s.DB); err != nil {
+			return err
+		}
+	}
+	s.connected = true
+
+	if err := s.Schema.Load(ctx, s.DB); err != nil {
+		log.Printf("warning: source %s: failed to load schema: %v", s.Name, err)
+	} else {
+		log.Printf("source %s: loaded schema: %d tables", s.Name, s.Schema.TableCount())
+	}
+	return nil
+}
+
+// Get returns the named source, or the default source for an empty name,
+// connecting to it first if it was unreachable at startup.
+func (r *Registry) Get(name string) (*Source, error) {
+	if name == "" {
+		name = r.def
+	}
+	src, ok := r.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSource, name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := src.connect(ctx); err != nil {
+		return nil, fmt.Errorf("source %s: %w", name, err)
+	}
+	return src, nil
+}
+
+// Default returns the source used when a request names none.
+func (r *Registry) Default() *Source {
+	return r.sources[r.def]
+}
+
+// List returns the sources in configuration order.
+func (r *Registry) List() []*Source {
+	list := make([]*Source, 0, len(r.order))
+	for _, name := range r.order {
+		list = append(list, r.sources[name])
+	}
+	return list
+}
+
+// Close closes every connection pool.
+func (r *Registry) Close() {
+	for _, src := range r.sources {
+		src.DB.Close()
+	}
+}
@@ -0,0 +1,308 @@
+// Package sqlparse performs lightweight lexical analysis of SELECT queries to
+// find the relations and columns they reference. It is not a full SQL parser:
+// it errs on the side of reporting too many references rather than too few.
+package sqlparse
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TokenKind classifies a lexical token.
+type TokenKind int
+
+const (
+	TokIdent  TokenKind = iota // Unquoted identifier or keyword (lower-cased)
+	TokQuoted                  // Quoted identifier, "x" or `x` (case preserved)
+	TokString                  // String literal
+	TokNumber                  // Numeric literal
+	TokParam                   // Bind parameter: $1 or ?
+	TokPunct                   // Operator or punctuation
+)
+
+// Token is a single lexical token.
+type Token struct {
+	Kind TokenKind
+	Text string // Identifier name, literal body or punctuation
+	Pos  int    // Byte offset in the source
+}
+
+// IsIdent reports whether the token names an identifier (quoted or not).
+func (t Token) IsIdent() bool {
+	return t.Kind == TokIdent || t.Kind == TokQuoted
+}
+
+// Is reports whether the token is the given keyword or punctuation.
+// Quoted identifiers never match keywords.
+func (t Token) Is(text string) bool {
+	return (t.Kind == TokIdent || t.Kind == TokPunct) && t.Text == text
+}
+
+// Syntax selects the lexical rules of a SQL dialect. Getting these right
+// matters: text the lexer wrongly treats as a comment or string would hide
+// table references from analysis.
+type Syntax struct {
+	NestedComments     bool // /* */ comments nest (Postgres)
+	EscapeStrings      bool // E'...' strings with backslash escapes (Postgres)
+	DollarQuotes       bool // $tag$...$tag$ strings and $1 parameters (Postgres)
+	HashComments       bool // # starts a line comment (MySQL)
+	DashCommentSpace   bool // -- only starts a comment when followed by whitespace (MySQL)
+	BackslashEscapes   bool // Backslash escapes in every quoted string (MySQL)
+	DoubleQuoteStrings bool // "..." is a string literal, not an identifier (MySQL)
+	ExecComments       bool // /*! ... */ comments are executed (MySQL); rejected
+	BracketIdents      bool // [name] is a quoted identifier (SQLite)
+}
+
+// Dialect syntaxes.
+var (
+	Postgres = Syntax{NestedComments: true, EscapeStrings: true, DollarQuotes: true}
+	MySQL    = Syntax{
+		HashComments:       true,
+		DashCommentSpace:   true,
+		BackslashEscapes:   true,
+		DoubleQuoteStrings: true,
+		ExecComments:       true,
+	}
+	SQLite = Syntax{BracketIdents: true}
+)
+
+// QuoteIdent quotes an identifier for the dialect: with backticks where
+// double quotes delimit strings (MySQL), double quotes otherwise.
+func (s Syntax) QuoteIdent(name string) string {
+	if s.DoubleQuoteStrings {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteString quotes a string literal for the dialect, doubling quotes and,
+// where backslashes escape (MySQL), backslashes too.
+func (s Syntax) QuoteString(v string) string {
+	if s.BackslashEscapes {
+		v = strings.ReplaceAll(v, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+}
+
+// Tokenize splits a Postgres query into tokens, dropping whitespace and comments.
+func Tokenize(src string) ([]Token, error) {
+	return TokenizeWith(src, Postgres)
+}
+
+// TokenizeWith splits a query into tokens using the given dialect syntax.
+func TokenizeWith(src string, syn Syntax) ([]Token, error) {
+	var toks []Token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case isSpace(c):
+			i++
+
+		case strings.HasPrefix(src[i:], "--") &&
+			(!syn.DashCommentSpace || i+2 == len(src) || isSpace(src[i+2])),
+			c == '#' && syn.HashComments:
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 1
+			}
+
+		case strings.HasPrefix(src[i:], "/*"):
+			if syn.ExecComments && strings.HasPrefix(src[i:], "/*!") {
+				return nil, fmt.Errorf("executable comments are not supported (offset %d)", i)
+			}
+			end, ok := commentEnd(src, i, syn.NestedComments)
+			if !ok {
+				return nil, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			i = end
+
+		case c == '\'':
+			body, end, err := readQuoted(src, i, '\'', syn.BackslashEscapes)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, Token{Kind: TokString, Text: body, Pos: i})
+			i = end
+
+		case syn.EscapeStrings && (c == 'E' || c == 'e') && i+1 < len(src) && src[i+1] == '\'':
+			body, end, err := readQuoted(src, i+1, '\'', true)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, Token{Kind: TokString, Text: body, Pos: i})
+			i = end
+
+		case c == '"' && syn.DoubleQuoteStrings:
+			body, end, err := readQuoted(src, i, c, syn.BackslashEscapes)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, Token{Kind: TokString, Text: body, Pos: i})
+			i = end
+
+		case c == '"' || c == '`':
+			body, end, err := readQuoted(src, i, c, false)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, Token{Kind: TokQuoted, Text: body, Pos: i})
+			i = end
+
+		case c == '[' && syn.BracketIdents:
+			end := strings.IndexByte(src[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier at offset %d", i)
+			}
+			toks = append(toks, Token{Kind: TokQuoted, Text: src[i+1 : i+end], Pos: i})
+			i += end + 1
+
+		case c == '$' && syn.DollarQuotes:
+			if tag, ok := dollarTag(src[i:]); ok {
+				rest := src[i+len(tag):]
+				end := strings.Index(rest, tag)
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated dollar-quoted string at offset %d", i)
+				}
+				toks = append(toks, Token{Kind: TokString, Text: rest[:end], Pos: i})
+				i += len(tag) + end + len(tag)
+				continue
+			}
+			j := i + 1
+			for j < len(src) && isDigit(src[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("unexpected '$' at offset %d", i)
+			}
+			toks = append(toks, Token{Kind: TokParam, Text: src[i:j], Pos: i})
+			i = j
+
+		case c == '?':
+			toks = append(toks, Token{Kind: TokParam, Text: "?", Pos: i})
+			i++
+
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			j := i
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.' || src[j] == '_' ||
+				src[j] == 'e' || src[j] == 'E' ||
+				((src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			toks = append(toks, Token{Kind: TokNumber, Text: src[i:j], Pos: i})
+			i = j
+
+		case isIdentStart(rune(c)) || c >= 0x80:
+			j := i
+			for j < len(src) {
+				r := rune(src[j])
+				if !isIdentPart(r) && src[j] < 0x80 {
+					break
+				}
+				j++
+			}
+			toks = append(toks, Token{Kind: TokIdent, Text: strings.ToLower(src[i:j]), Pos: i})
+			i = j
+
+		default:
+			n := punctLen(src[i:])
+			toks = append(toks, Token{Kind: TokPunct, Text: src[i : i+n], Pos: i})
+			i += n
+		}
+	}
+	return toks, nil
+}
+
+// commentEnd returns the offset just past the block comment starting at i.
+func commentEnd(src string, i int, nested bool) (int, bool) {
+	depth, j := 1, i+2
+	for j < len(src) && depth > 0 {
+		switch {
+		case nested && strings.HasPrefix(src[j:], "/*"):
+			depth++
+			j += 2
+		case strings.HasPrefix(src[j:], "*/"):
+			depth--
+			j += 2
+		default:
+			j++
+		}
+	}
+	return j, depth == 0
+}
+
+// readQuoted reads a quoted literal or identifier starting at src[start],
+// where a doubled quote escapes itself.
+func readQuoted(src string, start int, quote byte, backslash bool) (string, int, error) {
+	var sb strings.Builder
+	i := start + 1
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case backslash && c == '\\' && i+1 < len(src):
+			sb.WriteByte(src[i+1])
+			i += 2
+		case c == quote && i+1 < len(src) && src[i+1] == quote:
+			sb.WriteByte(quote)
+			i += 2
+		case c == quote:
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted text at offset %d", start)
+}
+
+// dollarTag returns the opening tag of a dollar-quoted string ($$ or $tag$).
+func dollarTag(s string) (string, bool) {
+	if len(s) < 2 {
+		return "", false
+	}
+	if s[1] == '$' {
+		return "$$", true
+	}
+	if !isIdentStart(rune(s[1])) {
+		return "", false
+	}
+	for j := 2; j < len(s); j++ {
+		if s[j] == '$' {
+			return s[:j+1], true
+		}
+		if !isIdentPart(rune(s[j])) {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+var multiCharPunct = []string{"::", "<=", ">=", "<>", "!=", "||", "->>", "->", "#>>", "#>", "@>", "<@", ":="}
+
+func punctLen(s string) int {
+	for _, p := range multiCharPunct {
+		if strings.HasPrefix(s, p) {
+			return len(p)
+		}
+	}
+	return 1
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,427 @@
+package sqlparse
+
+// Query summarizes what a SELECT statement touches.
+type Query struct {
+	Relations []Relation  // Tables referenced in FROM / JOIN, excluding CTEs
+	Columns   []ColumnRef // Identifiers that may name columns (over-reported)
+	Stars     []string    // Qualifiers of * expansions; "" for a bare *
+	Functions []string    // Names of called functions
+	CTEs      []string    // Names defined by WITH
+	Derived   []string    // Aliases of subqueries and table functions in FROM
+	Literals  []string    // String literals used as table references: files in DuckDB, tables in SQLite
+}
+
+// Relation is a table referenced in a FROM or JOIN clause.
+type Relation struct {
+	Schema string // Empty when unqualified
+	Name   string
+	Alias  string // Empty when not aliased
+
+	ColumnAliases []string // Column names given after the alias, as in "FROM t AS x(a, b)"
+}
+
+// RefName returns the name the relation is referred to by elsewhere in the query.
+func (r Relation) RefName() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	return r.Name
+}
+
+// ColumnRef is an identifier that may refer to a column.
+type ColumnRef struct {
+	Qualifier string // Table name or alias; empty when unqualified
+	Name      string
+}
+
+// IsCTE reports whether name is defined by the query's WITH clause.
+func (q *Query) IsCTE(name string) bool {
+	for _, c := range q.CTEs {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse analyses a Postgres query and reports the relations and columns it references.
+func Parse(sql string) (*Query, error) {
+	return ParseWith(sql, Postgres)
+}
+
+// ParseWith analyses a query written in the given dialect syntax.
+func ParseWith(sql string, syn Syntax) (*Query, error) {
+	toks, err := TokenizeWith(sql, syn)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		toks:     toks,
+		consumed: make([]bool, len(toks)),
+		q:        &Query{},
+		frames:   []frame{{hasSelect: true}},
+	}
+	p.scanRelations()
+	p.scanColumns()
+
+	// References to CTEs aren't tables
+	rels := p.q.Relations[:0]
+	for _, r := range p.q.Relations {
+		if r.Schema == "" && p.q.IsCTE(r.Name) {
+			continue
+		}
+		rels = append(rels, r)
+	}
+	p.q.Relations = rels
+
+	return p.q, nil
+}
+
+// frame tracks one level of parentheses.
+type frame struct {
+	hasSelect  bool // A SELECT opened in this level, so FROM introduces tables
+	inFromList bool // Commas at this level separate table references
+	joined     bool // A parenthesized join in FROM, so its first token starts a table reference
+	derived    bool // A subquery or table function arguments in FROM, so an alias may follow
+}
+
+type parser struct {
+	toks     []Token
+	consumed []bool // Tokens already used as relation names, aliases or CTE names
+	q        *Query
+	frames   []frame
+}
+
+// fromListEnders close a comma-separated FROM list.
+var fromListEnders = map[string]bool{
+	"where": true, "group": true, "having": true, "order": true, "limit": true,
+	"offset": true, "fetch": true, "for": true, "window": true, "union": true,
+	"intersect": true, "except": true, "returning": true, "select": true,
+}
+
+func (p *parser) top() *frame {
+	return &p.frames[len(p.frames)-1]
+}
+
+func (p *parser) scanRelations() {
+	for i := 0; i < len(p.toks); i++ {
+		t := p.toks[i]
+		switch {
+		case t.Is("("):
+			f := frame{}
+			switch {
+			case p.startsFromItem(i) && !p.startsSubquery(i+1):
+				// FROM (a JOIN b): the parentheses hold table references
+				f.joined, f.inFromList = true, true
+				p.frames = append(p.frames, f)
+				i = p.tableRef(i+1) - 1
+				continue
+			case p.startsFromItem(i):
+				f.derived = true
+			case i > 0 && p.toks[i-1].IsIdent() && p.startsFromItem(i-1):
+				f.derived = true // FROM unnest(...) AS u
+			}
+			p.frames = append(p.frames, f)
+		case t.Is(")"):
+			if len(p.frames) > 1 {
+				closed := *p.top()
+				p.frames = p.frames[:len(p.frames)-1]
+				if closed.derived {
+					i = p.derivedAlias(i+1) - 1
+				}
+			}
+		case t.Is("select"):
+			p.top().hasSelect = true
+			p.top().inFromList = false
+		case t.Is("from") && p.top().hasSelect && !p.isDistinctFrom(i):
+			p.top().inFromList = true
+			i = p.tableRef(i+1) - 1
+		case t.Is("join"):
+			i = p.tableRef(i+1) - 1
+		case t.Is("table"):
+			// TABLE t is shorthand for SELECT * FROM t
+			n := len(p.q.Relations)
+			i = p.tableRef(i+1) - 1
+			if len(p.q.Relations) > n {
+				p.q.Stars = append(p.q.Stars, p.q.Relations[n].RefName())
+			}
+		case t.Is(",") && p.top().inFromList:
+			i = p.tableRef(i+1) - 1
+		case t.Kind == TokIdent && fromListEnders[t.Text]:
+			p.top().inFromList = false
+		case t.IsIdent() && p.isCTEName(i):
+			p.consumed[i] = true
+			p.q.CTEs = append(p.q.CTEs, t.Text)
+		}
+	}
+}
+
+// startsFromItem reports whether the token at i begins an item of a FROM
+// list: it follows FROM, JOIN, LATERAL, ONLY or a FROM-list comma, or opens a
+// parenthesized join.
+func (p *parser) startsFromItem(i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev, top := p.toks[i-1], p.top()
+	switch {
+	case prev.Is("join"), prev.Is("lateral"), prev.Is("only"):
+		return true
+	case prev.Is("from"):
+		return top.hasSelect && !p.isDistinctFrom(i-1)
+	case prev.Is(","):
+		return top.inFromList
+	case prev.Is("("):
+		return top.joined
+	}
+	return false
+}
+
+// startsSubquery reports whether the token at i begins a query.
+func (p *parser) startsSubquery(i int) bool {
+	if i >= len(p.toks) {
+		return false
+	}
+	t := p.toks[i]
+	return t.Is("select") || t.Is("with") || t.Is("values") || t.Is("table")
+}
+
+// derivedAlias records the alias of a subquery or table function whose
+// closing parenthesis precedes i, and returns the index after it.
+func (p *parser) derivedAlias(i int) int {
+	if i < len(p.toks) && p.toks[i].Is("as") {
+		i++
+	}
+	if i < len(p.toks) && p.toks[i].IsIdent() && !isReserved(p.toks[i]) {
+		p.q.Derived = append(p.q.Derived, p.toks[i].Text)
+		p.consumed[i] = true
+		i++
+	}
+	return i
+}
+
+// isDistinctFrom detects the FROM in "IS [NOT] DISTINCT FROM".
+func (p *parser) isDistinctFrom(i int) bool {
+	return i >= 2 && p.toks[i-1].Is("distinct") &&
+		(p.toks[i-2].Is("is") || p.toks[i-2].Is("not"))
+}
+
+// isCTEName detects "name AS (", "name AS [NOT] MATERIALIZED (" and
+// "name (cols) AS (" following WITH, RECURSIVE or a comma.
+func (p *parser) isCTEName(i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := p.toks[i-1]
+	if !prev.Is("with") && !prev.Is("recursive") && !prev.Is(",") {
+		return false
+	}
+
+	j := i + 1
+	if j < len(p.toks) && p.toks[j].Is("(") {
+		j = p.skipParens(j)
+	}
+	if j >= len(p.toks) || !p.toks[j].Is("as") {
+		return false
+	}
+	j++
+	if j < len(p.toks) && p.toks[j].Is("not") {
+		j++
+	}
+	if j < len(p.toks) && p.toks[j].Is("materialized") {
+		j++
+	}
+	return j < len(p.toks) && p.toks[j].Is("(")
+}
+
+// skipParens returns the index just past the parenthesis group opening at i.
+func (p *parser) skipParens(i int) int {
+	depth := 0
+	for j := i; j < len(p.toks); j++ {
+		switch {
+		case p.toks[j].Is("("):
+			depth++
+		case p.toks[j].Is(")"):
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(p.toks)
+}
+
+// tableRef consumes one table reference starting at i and returns the index
+// after it. Subqueries and table functions are left for the main scan.
+func (p *parser) tableRef(i int) int {
+	for i < len(p.toks) && (p.toks[i].Is("lateral") || p.toks[i].Is("only")) {
+		i++
+	}
+	if i < len(p.toks) && p.toks[i].Kind == TokString {
+		p.q.Literals = append(p.q.Literals, p.toks[i].Text)
+		return i + 1
+	}
+	if i >= len(p.toks) || !p.toks[i].IsIdent() || isReserved(p.toks[i]) {
+		return i
+	}
+
+	start := i
+	parts := []string{p.toks[i].Text}
+	i++
+	for i+1 < len(p.toks) && p.toks[i].Is(".") && p.toks[i+1].IsIdent() {
+		parts = append(parts, p.toks[i+1].Text)
+		i += 2
+	}
+
+	// name(...) is a table function, not a relation
+	if i < len(p.toks) && p.toks[i].Is("(") {
+		return start
+	}
+	for j := start; j < i; j++ {
+		p.consumed[j] = true
+	}
+
+	rel := Relation{Name: parts[len(parts)-1]}
+	if len(parts) > 1 {
+		rel.Schema = parts[len(parts)-2]
+	}
+
+	// Postgres inheritance marker: FROM t *
+	if i < len(p.toks) && p.toks[i].Is("*") {
+		i++
+	}
+
+	if i < len(p.toks) && p.toks[i].Is("as") {
+		i++
+	}
+	if i < len(p.toks) && p.toks[i].IsIdent() && !isReserved(p.toks[i]) {
+		rel.Alias = p.toks[i].Text
+		p.consumed[i] = true
+		i++
+
+		// Column aliases: FROM t AS x(a, b)
+		if i < len(p.toks) && p.toks[i].Is("(") {
+			end := p.skipParens(i)
+			for j := i + 1; j < end-1; j++ {
+				if p.toks[j].IsIdent() {
+					rel.ColumnAliases = append(rel.ColumnAliases, p.toks[j].Text)
+					p.consumed[j] = true
+				}
+			}
+			i = end
+		}
+	}
+
+	p.q.Relations = append(p.q.Relations, rel)
+	return i
+}
+
+func (p *parser) scanColumns() {
+	for i := 0; i < len(p.toks); i++ {
+		t := p.toks[i]
+
+		if t.Is("*") && p.isBareStar(i) {
+			p.q.Stars = append(p.q.Stars, "")
+			continue
+		}
+
+		if !t.IsIdent() || p.consumed[i] || isReserved(t) {
+			continue
+		}
+		if i > 0 && (p.toks[i-1].Is("::") || p.toks[i-1].Is("as") || p.toks[i-1].Is(".")) {
+			// Type names, aliases, and chain tails (handled with their head)
+			continue
+		}
+
+		parts := []string{t.Text}
+		j := i + 1
+		star := false
+		for j+1 < len(p.toks) && p.toks[j].Is(".") {
+			next := p.toks[j+1]
+			if next.Is("*") {
+				star = true
+				j += 2
+				break
+			}
+			if !next.IsIdent() {
+				break
+			}
+			parts = append(parts, next.Text)
+			j += 2
+		}
+
+		switch {
+		case star:
+			p.q.Stars = append(p.q.Stars, parts[len(parts)-1])
+		case j < len(p.toks) && p.toks[j].Is("("):
+			p.q.Functions = append(p.q.Functions, parts[len(parts)-1])
+		case len(parts) == 1:
+			p.q.Columns = append(p.q.Columns, ColumnRef{Name: parts[0]})
+		default:
+			p.q.Columns = append(p.q.Columns, ColumnRef{
+				Qualifier: parts[len(parts)-2],
+				Name:      parts[len(parts)-1],
+			})
+		}
+		i = j - 1
+	}
+}
+
+// isBareStar distinguishes a select-list * from multiplication or COUNT(*).
+func (p *parser) isBareStar(i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := p.toks[i-1]
+	switch {
+	case prev.Is("select"), prev.Is("distinct"), prev.Is("all"), prev.Is(","):
+		return true
+	case prev.Is(")"):
+		// SELECT DISTINCT ON (...) *
+		depth := 0
+		for j := i - 1; j >= 0; j-- {
+			switch {
+			case p.toks[j].Is(")"):
+				depth++
+			case p.toks[j].Is("("):
+				depth--
+				if depth == 0 {
+					return j > 0 && p.toks[j-1].Is("on")
+				}
+			}
+		}
+	}
+	return false
+}
+
+// reserved holds Postgres reserved keywords, which can't be unquoted column
+// or table names. Non-reserved keywords are deliberately treated as identifiers.
+var reserved = map[string]bool{
+	"all": true, "analyse": true, "analyze": true, "and": true, "any": true,
+	"array": true, "as": true, "asc": true, "asymmetric": true, "authorization": true,
+	"binary": true, "both": true, "case": true, "cast": true, "check": true,
+	"collate": true, "collation": true, "column": true, "concurrently": true,
+	"constraint": true, "create": true, "cross": true, "current_catalog": true,
+	"current_date": true, "current_role": true, "current_schema": true,
+	"current_time": true, "current_timestamp": true, "current_user": true,
+	"default": true, "deferrable": true, "desc": true, "distinct": true, "do": true,
+	"else": true, "end": true, "except": true, "false": true, "fetch": true,
+	"for": true, "foreign": true, "freeze": true, "from": true, "full": true,
+	"grant": true, "group": true, "having": true, "ilike": true, "in": true,
+	"initially": true, "inner": true, "intersect": true, "into": true, "is": true,
+	"isnull": true, "join": true, "lateral": true, "leading": true, "left": true,
+	"like": true, "limit": true, "localtime": true, "localtimestamp": true,
+	"natural": true, "not": true, "notnull": true, "null": true, "offset": true,
+	"on": true, "only": true, "or": true, "order": true, "outer": true,
+	"overlaps": true, "placing": true, "primary": true, "references": true,
+	"returning": true, "right": true, "select": true, "session_user": true,
+	"similar": true, "some": true, "symmetric": true, "table": true,
+	"tablesample": true, "then": true, "to": true, "trailing": true, "true": true,
+	"union": true, "unique": true, "user": true, "using": true, "variadic": true,
+	"verbose": true, "when": true, "where": true, "window": true, "with": true,
+}
+
+func isReserved(t Token) bool {
+	return t.Kind == TokIdent && reserved[t.Text]
+}
@@ -0,0 +1,135 @@
+package sqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRelations(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []Relation
+	}{
+		{"SELECT id FROM users", []Relation{{Name: "users"}}},
+		{"SELECT u.id FROM public.users AS u", []Relation{{Schema: "public", Name: "users", Alias: "u"}}},
+		{
+			"SELECT * FROM orders o JOIN users u ON u.id = o.user_id LEFT JOIN items ON true",
+			[]Relation{{Name: "orders", Alias: "o"}, {Name: "users", Alias: "u"}, {Name: "items"}},
+		},
+		{"SELECT a.x, b.y FROM a, b WHERE a.id = b.id", []Relation{{Name: "a"}, {Name: "b"}}},
+		{
+			"SELECT * FROM (SELECT id FROM secrets) s",
+			[]Relation{{Name: "secrets"}},
+		},
+		{
+			"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent JOIN users ON true",
+			[]Relation{{Name: "orders"}, {Name: "users"}},
+		},
+		{
+			"SELECT id FROM users WHERE id IN (SELECT user_id FROM orders)",
+			[]Relation{{Name: "users"}, {Name: "orders"}},
+		},
+		{"SELECT 1 FROM a UNION SELECT 2 FROM b", []Relation{{Name: "a"}, {Name: "b"}}},
+		{`SELECT "Id" FROM "My Table"`, []Relation{{Name: "My Table"}}},
+		{"SELECT x IS DISTINCT FROM y FROM t", []Relation{{Name: "t"}}},
+		{"TABLE users", []Relation{{Name: "users"}}},
+		{"SELECT * FROM (users CROSS JOIN orders)", []Relation{{Name: "users"}, {Name: "orders"}}},
+		{
+			"SELECT * FROM ((users u) JOIN (orders o JOIN items i ON true) ON true) j, tags",
+			[]Relation{{Name: "users", Alias: "u"}, {Name: "orders", Alias: "o"}, {Name: "items", Alias: "i"}, {Name: "tags"}},
+		},
+		{"SELECT * FROM ONLY (users)", []Relation{{Name: "users"}}},
+		{
+			"SELECT u.p FROM users u(i, p)",
+			[]Relation{{Name: "users", Alias: "u", ColumnAliases: []string{"i", "p"}}},
+		},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.sql)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.sql, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Relations, tt.want) {
+			t.Errorf("Parse(%q).Relations = %+v, want %+v", tt.sql, q.Relations, tt.want)
+		}
+	}
+}
+
+func TestParseColumnsStarsAndFunctions(t *testing.T) {
+	q, err := Parse(`SELECT u.name, email, count(*), o.*, lower(u.city)::text AS c
+		FROM users u JOIN orders o ON o.user_id = u.id
+		WHERE status = 'shipped' -- and secret = 1
+		/* also hidden */`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCols := []ColumnRef{
+		{Qualifier: "u", Name: "name"},
+		{Name: "email"},
+		{Qualifier: "u", Name: "city"},
+		{Qualifier: "o", Name: "user_id"},
+		{Qualifier: "u", Name: "id"},
+		{Name: "status"},
+	}
+	if !reflect.DeepEqual(q.Columns, wantCols) {
+		t.Errorf("Columns = %+v, want %+v", q.Columns, wantCols)
+	}
+	if want := []string{"o"}; !reflect.DeepEqual(q.Stars, want) {
+		t.Errorf("Stars = %q, want %q", q.Stars, want)
+	}
+	if want := []string{"count", "lower"}; !reflect.DeepEqual(q.Functions, want) {
+		t.Errorf("Functions = %q, want %q", q.Functions, want)
+	}
+
+	q, err = Parse("SELECT DISTINCT ON (a) * FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{""}; !reflect.DeepEqual(q.Stars, want) {
+		t.Errorf("DISTINCT ON stars = %q, want %q", q.Stars, want)
+	}
+}
+
+func TestParseDerived(t *testing.T) {
+	q, err := Parse("SELECT * FROM (SELECT 1) AS s, unnest(x) u(v), (VALUES (1)) v JOIN LATERAL (SELECT 2) l ON true, (a JOIN b ON true) j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"s", "u", "v", "l"}; !reflect.DeepEqual(q.Derived, want) {
+		t.Errorf("Derived = %q, want %q", q.Derived, want)
+	}
+	if want := []Relation{{Name: "a"}, {Name: "b"}}; !reflect.DeepEqual(q.Relations, want) {
+		t.Errorf("Relations = %+v, want %+v", q.Relations, want)
+	}
+}
+
+func TestParseLiterals(t *testing.T) {
+	q, err := ParseWith("SELECT * FROM 'data/orders.parquet'", Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"data/orders.parquet"}; !reflect.DeepEqual(q.Literals, want) {
+		t.Errorf("Literals = %q, want %q", q.Literals, want)
+	}
+	if len(q.Relations) != 0 {
+		t.Errorf("Relations = %+v, want none", q.Relations)
+	}
+}
+
+func TestParseDialectComments(t *testing.T) {
+	// In MySQL # starts a comment, so secrets is commented out; in Postgres
+	// it's an operator and secrets is a table
+	sql := "SELECT 1 FROM t # , secrets\n"
+	q, err := ParseWith(sql, MySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Relation{{Name: "t"}}; !reflect.DeepEqual(q.Relations, want) {
+		t.Errorf("MySQL Relations = %+v, want %+v", q.Relations, want)
+	}
+
+	if _, err := ParseWith("SELECT /*! 1 */ FROM t", MySQL); err == nil {
+		t.Error("MySQL executable comment accepted")
+	}
+}
@@ -0,0 +1,293 @@
+// Package summary prepares query results for an LLM to describe in a few
+// sentences: per-column aggregates over every row read, plus as many leading
+// rows as a cell budget allows.
+package summary
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxDistinct = 1000 // Distinct values tracked per column; beyond it counts are lower bounds
+	maxTop      = 3    // Most common values reported per text column
+	maxValueLen = 200  // Longer strings are cut
+)
+
+// Instruction is the system prompt for summarizing a result.
+const Instruction = `You are a data analyst writing for busy managers. You are given a SQL query, optionally the question it answers, and its result: per-column aggregates over all rows read and the first rows.
+
+Write a short summary of what the result shows, in at most three sentences of plain text without markdown. Lead with the most important finding, e.g. "Revenue grew 12% month over month, driven by EMEA."
+
+- Cite the numbers you rely on. Use only numbers given, or ones computed directly from them (differences, percentages, ratios); never invent or extrapolate.
+- When "moreRows" is true the result was cut off: say the figures cover the rows read, not the whole result.
+- When the rows alone can't support a finding, describe what the data contains instead.
+- If a value is a placeholder such as PII_EMAIL_1 or [REDACTED], refer to it as is.`
+
+// Column is the profile of one result column.
+type Column struct {
+	Name     string       `json:"name"`
+	Type     string       `json:"type,omitempty"` // Database type name, when the driver reports it
+	Count    int          `json:"count"`          // Non-null values
+	Nulls    int          `json:"nulls,omitempty"`
+	Distinct int          `json:"distinct"`
+	Min      any          `json:"min,omitempty"`
+	Max      any          `json:"max,omitempty"`
+	Sum      *float64     `json:"sum,omitempty"` // Numeric columns only
+	Avg      *float64     `json:"avg,omitempty"`
+	Top      []ValueCount `json:"top,omitempty"` // Most common values of non-numeric columns
+}
+
+// ValueCount is a value and how many rows hold it.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Profiler accumulates column profiles row by row.
+type Profiler struct {
+	columns []Column
+	numeric []bool // Every non-null value so far was a number
+	sums    []float64
+	minNum  []float64
+	maxNum  []float64
+	minStr  []string
+	maxStr  []string
+	counts  []map[string]int
+	rows    int
+}
+
+// NewProfiler profiles a result with the given column names and types;
+// types may be nil.
+func NewProfiler(names, types []string) *Profiler {
+	n := len(names)
+	p := &Profiler{
+		columns: make([]Column, n),
+		numeric: make([]bool, n),
+		sums:    make([]float64, n),
+		minNum:  make([]float64, n),
+		maxNum:  make([]float64, n),
+		minStr:  make([]string, n),
+		maxStr:  make([]string, n),
+		counts:  make([]map[string]int, n),
+	}
+	for i, name := range names {
+		p.columns[i].Name = name
+		if i < len(types) {
+			p.columns[i].Type = strings.ToLower(types[i])
+		}
+		p.numeric[i] = true
+		p.counts[i] = make(map[string]int)
+	}
+	return p
+}
+
+// Add profiles a row of JSON-friendly values, as normalizeRow produces.
+func (p *Profiler) Add(row []any) {
+	p.rows++
+	for i := range p.columns {
+		if i >= len(row) || row[i] == nil {
+			p.columns[i].Nulls++
+			continue
+		}
+		c := &p.columns[i]
+		c.Count++
+
+		s := cut(fmt.Sprint(row[i]))
+		if n, ok := p.number(i, row[i]); ok && p.numeric[i] {
+			if c.Count == 1 || n < p.minNum[i] {
+				p.minNum[i] = n
+			}
+			if c.Count == 1 || n > p.maxNum[i] {
+				p.maxNum[i] = n
+			}
+			p.sums[i] += n
+		} else {
+			p.numeric[i] = false
+		}
+		if c.Count == 1 || s < p.minStr[i] {
+			p.minStr[i] = s
+		}
+		if c.Count == 1 || s > p.maxStr[i] {
+			p.maxStr[i] = s
+		}
+		if _, seen := p.counts[i][s]; seen || len(p.counts[i]) < maxDistinct {
+			p.counts[i][s]++
+		}
+	}
+}
+
+// number reads a value as a number: Go numbers, and strings of numeric
+// database types such as PostgreSQL's NUMERIC.
+func (p *Profiler) number(i int, v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case float64:
+		return n, !math.IsNaN(n) && !math.IsInf(n, 0)
+	case float32:
+		return float64(n), true
+	case string:
+		if !numericType(p.columns[i].Type) {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func numericType(t string) bool {
+	for _, s := range []string{"int", "numeric", "decimal", "real", "float", "double", "money"} {
+		if strings.Contains(t, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rows returns the number of rows added.
+func (p *Profiler) Rows() int {
+	return p.rows
+}
+
+// Columns returns the column profiles.
+func (p *Profiler) Columns() []Column {
+	out := make([]Column, len(p.columns))
+	for i, c := range p.columns {
+		c.Distinct = len(p.counts[i])
+		if c.Count > 0 {
+			if p.numeric[i] {
+				sum, avg := round(p.sums[i]), round(p.sums[i]/float64(c.Count))
+				c.Min, c.Max, c.Sum, c.Avg = round(p.minNum[i]), round(p.maxNum[i]), &sum, &avg
+			} else {
+				c.Min, c.Max = p.minStr[i], p.maxStr[i]
+				c.Top = top(p.counts[i], maxTop)
+			}
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// round keeps four decimals, enough to cite and short to send.
+func round(f float64) float64 {
+	return math.Round(f*1e4) / 1e4
+}
+
+// top returns the n most common values seen more than once.
+func top(counts map[string]int, n int) []ValueCount {
+	var vcs []ValueCount
+	for v, c := range counts {
+		if c > 1 {
+			vcs = append(vcs, ValueCount{Value: v, Count: c})
+		}
+	}
+	slices.SortFunc(vcs, func(a, b ValueCount) int {
+		return cmp.Or(b.Count-a.Count, strings.Compare(a.Value, b.Value))
+	})
+	return vcs[:min(n, len(vcs))]
+}
+
+func cut(s string) string {
+	if len(s) <= maxValueLen {
+		return s
+	}
+	n := maxValueLen
+	for !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
+
+// Input is what the LLM is given about a result.
+type Input struct {
+	Question string   `json:"question,omitempty"`
+	SQL      string   `json:"sql"`
+	RowsRead int      `json:"rowsRead"`
+	MoreRows bool     `json:"moreRows"` // The result had rows beyond those read
+	Columns  []Column `json:"columns"`
+	Rows     [][]any  `json:"firstRows"`
+}
+
+// SampleRows returns how many of the first rows fit in maxCells values,
+// aggregates aside.
+func SampleRows(rows, columns, maxCells int) int {
+	if columns == 0 {
+		return 0
+	}
+	return min(rows, maxCells/columns)
+}
+
+// Cells counts the result values an input holds: row values, and the values
+// quoted by the aggregates of non-numeric columns (min, max and top values).
+func (in *Input) Cells() int {
+	n := 0
+	for _, row := range in.Rows {
+		n += len(row)
+	}
+	for _, c := range in.Columns {
+		n += len(c.Top) + quoted(c.Min) + quoted(c.Max)
+	}
+	return n
+}
+
+func quoted(v any) int {
+	if _, ok := v.(string); ok {
+		return 1
+	}
+	return 0
+}
+
+// Fit trims an input to at most maxCells values: rows go first, from the
+// end, then the top values of columns, then their min and max.
+func (in *Input) Fit(maxCells int) {
+	for len(in.Rows) > 0 && in.Cells() > maxCells {
+		in.Rows = in.Rows[:len(in.Rows)-1]
+	}
+	for i := range in.Columns {
+		if in.Cells() <= maxCells {
+			return
+		}
+		in.Columns[i].Top = nil
+	}
+	for i := range in.Columns {
+		if in.Cells() <= maxCells {
+			return
+		}
+		if quoted(in.Columns[i].Min)+quoted(in.Columns[i].Max) > 0 {
+			in.Columns[i].Min, in.Columns[i].Max = nil, nil
+		}
+	}
+}
+
+// Prompt renders the user prompt for an input. Long strings in the rows are cut.
+func Prompt(in Input) (string, error) {
+	rows := make([][]any, len(in.Rows))
+	for i, row := range in.Rows {
+		rows[i] = make([]any, len(row))
+		for j, v := range row {
+			if s, ok := v.(string); ok {
+				v = cut(s)
+			}
+			rows[i][j] = v
+		}
+	}
+	in.Rows = rows
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		return "", fmt.Errorf("encode result: %w", err)
+	}
+	return "Summarize this query result.\n\n" + string(data), nil
+}
@@ -0,0 +1,398 @@
+// Package usage accounts for LLM tokens and their cost per user and day, and
+// enforces daily budgets.
+//
+// Every generation is appended to a JSONL file as an Event priced at the
+// time, so later price changes don't rewrite history. Days are UTC days.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is wrapped by the errors Reserve returns.
+var ErrBudgetExceeded = errors.New("daily LLM budget exceeded")
+
+// Config is the on-disk usage config file (JSON).
+type Config struct {
+	Prices []Price           `json:"prices"` // First match wins
+	Budget Budget            `json:"budget"` // Applies to every user
+	Users  map[string]Budget `json:"users"`  // Per-user overrides of Budget
+}
+
+// Price is what a model costs, in USD per million tokens.
+type Price struct {
+	Provider   string  `json:"provider"` // As named in responses; empty for any
+	Model      string  `json:"model"`    // Name or glob pattern (gpt-4o*); empty for any
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Budget caps a user's usage per day. Zero means no cap.
+type Budget struct {
+	DailyTokens int64   `json:"dailyTokens"`
+	DailyCost   float64 `json:"dailyCost"` // USD
+}
+
+// LoadConfig reads a usage config file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read usage config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse usage config: %w", err)
+	}
+	for i, p := range cfg.Prices {
+		if _, err := matchModel(p.Model, ""); err != nil {
+			return Config{}, fmt.Errorf("usage config: price %d: bad model pattern %q", i+1, p.Model)
+		}
+		if p.Prompt < 0 || p.Completion < 0 {
+			return Config{}, fmt.Errorf("usage config: price %d: negative price", i+1)
+		}
+	}
+	return cfg, nil
+}
+
+func matchModel(pattern, name string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+	return path.Match(pattern, name)
+}
+
+// Event is one LLM request.
+type Event struct {
+	Time             time.Time `json:"time"`
+	User             string    `json:"user"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model,omitempty"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	Tokens           int       `json:"tokens"` // At least the sum of the two above
+	Cost             float64   `json:"cost"`   // USD
+	Unpriced         bool      `json:"unpriced,omitempty"`
+}
+
+// ModelUsage totals one provider and model's requests.
+type ModelUsage struct {
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model,omitempty"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Tokens           int64   `json:"tokens"`
+	Cost             float64 `json:"cost"`
+	Unpriced         bool    `json:"unpriced,omitempty"` // Not in the price table; cost is 0
+}
+
+// Day totals a user's usage on one day.
+type Day struct {
+	Date             string       `json:"date"` // YYYY-MM-DD, UTC
+	User             string       `json:"user"`
+	Requests         int          `json:"requests"`
+	PromptTokens     int64        `json:"promptTokens"`
+	CompletionTokens int64        `json:"completionTokens"`
+	Tokens           int64        `json:"tokens"`
+	Cost             float64      `json:"cost"`
+	Models           []ModelUsage `json:"models"`
+}
+
+func (d *Day) add(e Event) {
+	d.Requests++
+	d.PromptTokens += int64(e.PromptTokens)
+	d.CompletionTokens += int64(e.CompletionTokens)
+	d.Tokens += int64(e.Tokens)
+	d.Cost += e.Cost
+
+	for i := range d.Models {
+		m := &d.Models[i]
+		if m.Provider == e.Provider && m.Model == e.Model {
+			m.Requests++
+			m.PromptTokens += int64(e.PromptTokens)
+			m.CompletionTokens += int64(e.CompletionTokens)
+			m.Tokens += int64(e.Tokens)
+			m.Cost += e.Cost
+			m.Unpriced = m.Unpriced || e.Unpriced
+			return
+		}
+	}
+	d.Models = append(d.Models, ModelUsage{
+		Provider:         e.Provider,
+		Model:            e.Model,
+		Requests:         1,
+		PromptTokens:     int64(e.PromptTokens),
+		CompletionTokens: int64(e.CompletionTokens),
+		Tokens:           int64(e.Tokens),
+		Cost:             e.Cost,
+		Unpriced:         e.Unpriced,
+	})
+}
+
+type dayKey struct {
+	date string
+	user string
+}
+
+// defaultEstimate is what a request is assumed to use before any has been
+// recorded.
+const defaultEstimate = 2000
+
+// Tracker records usage to a file and keeps daily totals in memory.
+type Tracker struct {
+	cfg  Config
+	path string
+
+	mu       sync.RWMutex
+	days     map[dayKey]*Day
+	reserved map[dayKey][]*Reservation // Requests in flight
+	requests int64                     // Recorded requests, for the estimate
+	tokens   int64
+	cost     float64
+}
+
+// Open loads the usage recorded in path, creating its directory if needed.
+func Open(path string, cfg Config) (*Tracker, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create usage dir: %w", err)
+	}
+
+	t := &Tracker{cfg: cfg, path: path, days: make(map[dayKey]*Day), reserved: make(map[dayKey][]*Reservation)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open usage: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			// Skip a torn trailing write rather than refusing to start
+			continue
+		}
+		t.add(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read usage: %w", err)
+	}
+	return t, nil
+}
+
+// add counts an event. Callers hold mu.
+func (t *Tracker) add(e Event) {
+	t.day(e.Time, e.User).add(e)
+	t.requests++
+	t.tokens += int64(e.Tokens)
+	t.cost += e.Cost
+}
+
+// day returns the totals of a user's day, creating them. Callers hold mu.
+func (t *Tracker) day(at time.Time, user string) *Day {
+	key := dayKey{date: at.UTC().Format(time.DateOnly), user: user}
+	d, ok := t.days[key]
+	if !ok {
+		d = &Day{Date: key.date, User: user, Models: []ModelUsage{}}
+		t.days[key] = d
+	}
+	return d
+}
+
+// Price computes the cost of a request. It reports false when no price
+// matches the provider and model.
+func (t *Tracker) Price(provider, model string, promptTokens, completionTokens int) (float64, bool) {
+	for _, p := range t.cfg.Prices {
+		if p.Provider != "" && p.Provider != provider {
+			continue
+		}
+		if ok, _ := matchModel(p.Model, model); !ok {
+			continue
+		}
+		return (float64(promptTokens)*p.Prompt + float64(completionTokens)*p.Completion) / 1e6, true
+	}
+	return 0, false
+}
+
+// Record prices an event, appends it to the file and adds it to the totals.
+// Tokens defaults to the sum of the prompt and completion tokens.
+func (t *Tracker) Record(e Event) (Event, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Tokens = max(e.Tokens, e.PromptTokens+e.CompletionTokens)
+	var priced bool
+	e.Cost, priced = t.Price(e.Provider, e.Model, e.PromptTokens, e.CompletionTokens)
+	e.Unpriced = !priced
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Event{}, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Event{}, fmt.Errorf("open usage: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return Event{}, fmt.Errorf("write usage: %w", err)
+	}
+
+	t.add(e)
+	return e, nil
+}
+
+// Budget returns a user's daily budget.
+func (t *Tracker) Budget(user string) Budget {
+	if b, ok := t.cfg.Users[user]; ok {
+		return b
+	}
+	return t.cfg.Budget
+}
+
+// Today returns a user's totals for the day containing now.
+func (t *Tracker) Today(user string, now time.Time) Day {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	key := dayKey{date: now.UTC().Format(time.DateOnly), user: user}
+	if d, ok := t.days[key]; ok {
+		return d.clone()
+	}
+	return Day{Date: key.date, User: user, Models: []ModelUsage{}}
+}
+
+func (d *Day) clone() Day {
+	c := *d
+	c.Models = append([]ModelUsage{}, d.Models...)
+	return c
+}
+
+// BudgetError reports a spent budget.
+type BudgetError struct {
+	Limit   string // "tokens" or "cost"
+	Used    float64
+	Max     float64
+	ResetAt time.Time // When the next day starts
+}
+
+func (e *BudgetError) Error() string {
+	if e.Limit == "cost" {
+		return fmt.Sprintf("%v: $%.2f of $%.2f used today, resets at %s", ErrBudgetExceeded, e.Used, e.Max, e.ResetAt.Format("15:04 MST"))
+	}
+	return fmt.Sprintf("%v: %.0f of %.0f tokens used today, resets at %s", ErrBudgetExceeded, e.Used, e.Max, e.ResetAt.Format("15:04 MST"))
+}
+
+func (e *BudgetError) Unwrap() error { return ErrBudgetExceeded }
+
+// Reservation holds part of a user's budget for a request in flight, so
+// concurrent requests can't all start under budget and together overshoot
+// it. A nil Reservation is valid and holds nothing.
+type Reservation struct {
+	t      *Tracker
+	key    dayKey
+	tokens int64
+	cost   float64
+}
+
+// Reserve holds an estimate of one request's usage, the average recorded
+// request, against the user's budget for the day containing now. It returns
+// a *BudgetError when what is used and held already reaches the budget.
+// Release the reservation once the request's usage is recorded.
+func (t *Tracker) Reserve(user string, now time.Time) (*Reservation, error) {
+	b := t.Budget(user)
+	if b.DailyTokens <= 0 && b.DailyCost <= 0 {
+		return nil, nil
+	}
+	key := dayKey{date: now.UTC().Format(time.DateOnly), user: user}
+	reset := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var tokens int64
+	var cost float64
+	if d, ok := t.days[key]; ok {
+		tokens, cost = d.Tokens, d.Cost
+	}
+	for _, r := range t.reserved[key] {
+		tokens += r.tokens
+		cost += r.cost
+	}
+	switch {
+	case b.DailyTokens > 0 && tokens >= b.DailyTokens:
+		return nil, &BudgetError{Limit: "tokens", Used: float64(tokens), Max: float64(b.DailyTokens), ResetAt: reset}
+	case b.DailyCost > 0 && cost >= b.DailyCost:
+		return nil, &BudgetError{Limit: "cost", Used: cost, Max: b.DailyCost, ResetAt: reset}
+	}
+
+	r := &Reservation{t: t, key: key, tokens: defaultEstimate}
+	if t.requests > 0 {
+		r.tokens = t.tokens / t.requests
+		r.cost = t.cost / float64(t.requests)
+	}
+	t.reserved[key] = append(t.reserved[key], r)
+	return r, nil
+}
+
+// Release gives back what the reservation held. It is safe to call more than
+// once.
+func (r *Reservation) Release() {
+	if r == nil {
+		return
+	}
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	held := slices.DeleteFunc(t.reserved[r.key], func(o *Reservation) bool { return o == r })
+	if len(held) == 0 {
+		delete(t.reserved, r.key)
+	} else {
+		t.reserved[r.key] = held
+	}
+}
+
+// Days returns daily totals from since to until (inclusive dates), newest
+// first. An empty user matches every user.
+func (t *Tracker) Days(user string, since, until time.Time) []Day {
+	from, to := since.UTC().Format(time.DateOnly), until.UTC().Format(time.DateOnly)
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	days := []Day{}
+	for key, d := range t.days {
+		if (user != "" && key.user != user) || key.date < from || key.date > to {
+			continue
+		}
+		days = append(days, d.clone())
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if days[i].Date != days[j].Date {
+			return days[i].Date > days[j].Date
+		}
+		return days[i].User < days[j].User
+	})
+	return days
+}
@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReserveHoldsBudgetForRequestsInFlight(t *testing.T) {
+	tr, err := Open(filepath.Join(t.TempDir(), "usage.jsonl"), Config{Budget: Budget{DailyTokens: 3000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := tr.Record(Event{Time: now, User: "bob", Tokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each request in flight is assumed to use the average so far, 1000
+	first, err := tr.Reserve("alice", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tr.Reserve("alice", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := tr.Reserve("alice", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var budgetErr *BudgetError
+	if _, err := tr.Reserve("alice", now); !errors.As(err, &budgetErr) || budgetErr.Limit != "tokens" {
+		t.Fatalf("fourth concurrent request: err = %v, want a token budget error", err)
+	}
+
+	// Releasing without using anything frees the hold
+	third.Release()
+	third.Release()
+	fourth, err := tr.Reserve("alice", now)
+	if err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+
+	// Recorded usage replaces the hold
+	if _, err := tr.Record(Event{Time: now, User: "alice", Tokens: 2500}); err != nil {
+		t.Fatal(err)
+	}
+	first.Release()
+	second.Release()
+	fourth.Release()
+	if _, err := tr.Reserve("alice", now); err != nil {
+		t.Fatalf("after spending 2500 of 3000: %v", err)
+	}
+	if _, err := tr.Reserve("alice", now); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("with 2500 spent and 1750 held: err = %v, want exceeded", err)
+	}
+	if _, err := tr.Reserve("bob", now); err != nil {
+		t.Fatalf("other users keep their own budget: %v", err)
+	}
+}
+
+func TestReserveWithoutBudget(t *testing.T) {
+	tr, err := Open(filepath.Join(t.TempDir(), "usage.jsonl"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tr.Reserve("alice", time.Now())
+	if err != nil || r != nil {
+		t.Fatalf("Reserve = %v, %v; want nothing held", r, err)
+	}
+	r.Release()
+}
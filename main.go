@@ -1,44 +1,98 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	_ "embed"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+	"github.com/JonMunkholm/WebDbReader/internal/chart"
+	"github.com/JonMunkholm/WebDbReader/internal/gencache"
+	"github.com/JonMunkholm/WebDbReader/internal/history"
+	"github.com/JonMunkholm/WebDbReader/internal/knowledge"
 	"github.com/JonMunkholm/WebDbReader/internal/llm"
+	"github.com/JonMunkholm/WebDbReader/internal/mask"
+	"github.com/JonMunkholm/WebDbReader/internal/meta"
+	"github.com/JonMunkholm/WebDbReader/internal/policy"
+	"github.com/JonMunkholm/WebDbReader/internal/schedule"
 	"github.com/JonMunkholm/WebDbReader/internal/schema"
+	"github.com/JonMunkholm/WebDbReader/internal/share"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+	"github.com/JonMunkholm/WebDbReader/internal/sqlparse"
+	"github.com/JonMunkholm/WebDbReader/internal/usage"
 	"github.com/go-chi/chi/v5"
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 const (
 	defaultAddr         = ":8080"
+	defaultDataDir      = "data"
 	defaultLimit        = 200
 	maxLimit            = 1000
+	maxCacheEntries     = 1000
+	defaultSummaryCells = 200
 	queryTimeout        = 8 * time.Second
 	defaultExampleQuery = "SELECT 1 AS id, 'hello' AS greeting;"
 )
 
 type app struct {
-	db     *sql.DB
-	tmpl   *template.Template
-	schema *schema.Cache
-	llm    llm.Provider
+	sources       *source.Registry
+	tmpl          *template.Template
+	dashboardTmpl *template.Template
+	generation
+	history   *history.Store
+	shares    *share.Store
+	meta      *meta.Store         // nil when the metadata store is unavailable
+	scheduler *scheduler          // nil when scheduling is unavailable
+	auth      *auth.Authenticator // nil when authentication is disabled
+	masker    *mask.Masker        // nil when no masking rules are configured
+	audit     *audit.Log
+	usage     *usage.Tracker                       // nil when usage tracking is unavailable
+	cache     *gencache.Cache[generateSQLResponse] // nil when generations aren't cached
+
+	shareTTL         time.Duration
+	shareMaxTTL      time.Duration
+	dashboardWorkers int // Panels of a dashboard run at once
+}
+
+// generation is what SQL generation needs besides the data sources. The
+// eval command shares it with the server.
+type generation struct {
+	llm       llm.Provider // nil when not configured
+	llmModel  string       // LLM_MODEL, telling apart cached answers of different models
+	prompts   *llm.Prompts
+	promptTZ  *time.Location  // Zone "today" is given in to the LLM
+	knowledge *knowledge.Base // nil when no knowledge file is configured
+	redactor  *llm.Redactor   // nil when nothing is withheld from the LLM
+
+	agentSteps   int // Model turns with database tools; 0 disables them
+	summaryCells int // Most result values /summarize sends to the LLM
 }
 
 type queryRequest struct {
-	Query string `json:"query"`
-	Limit int    `json:"limit"`
+	Query    string `json:"query"`
+	Limit    int    `json:"limit"`
+	Source   string `json:"source"`   // Data source name; empty for the default
+	ParentID string `json:"parentId"` // History entry this query was derived from
+	Chart    string `json:"chart"`    // "auto" (default), "llm" or "none"
 }
 
 type queryResponse struct {
@@ -47,78 +101,351 @@ type queryResponse struct {
 	Count      int      `json:"count"`
 	More       bool     `json:"more"`
 	DurationMs int64    `json:"durationMs"`
+	Masked     []int    `json:"masked,omitempty"` // Indices of masked columns
 	Error      string   `json:"error,omitempty"`
+	HistoryID  string   `json:"historyId,omitempty"`
+
+	Chart *chart.Recommendation `json:"chart,omitempty"`
+	query string                // The query as validated
+	types []string              // Database type names of the columns
 }
 
 func main() {
 	_ = godotenv.Load() // loads .env if present, silently ignores if not
 
-	driver := env("DB_DRIVER", "postgres")
-	dsn := env("DB_DSN", "postgres://localhost/postgres?sslmode=disable")
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		os.Exit(runVerifyAudit(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		os.Exit(runEval(os.Args[2:]))
+	}
+
 	addr := env("ADDR", defaultAddr)
+	dataDir := env("DATA_DIR", defaultDataDir)
+
+	sources := openSources()
+	gen := loadGeneration()
+	for _, src := range sources.List() {
+		gen.logRedactions(src)
+	}
+
+	// Initialize authentication (optional - without it the server is open to anyone who can reach it)
+	var authenticator *auth.Authenticator
+	if path := env("AUTH_CONFIG", ""); path != "" {
+		cfg, err := auth.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("auth: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		authenticator, err = auth.New(ctx, cfg)
+		cancel()
+		if err != nil {
+			log.Fatalf("auth: %v", err)
+		}
+		log.Printf("authentication enabled (%d users, %d tokens, oidc=%t)", len(cfg.Users), len(cfg.Tokens), cfg.OIDC != nil)
+	} else {
+		log.Printf("warning: authentication disabled (set AUTH_CONFIG to enable)")
+	}
+
+	// Initialize column masking (optional)
+	var masker *mask.Masker
+	if path := env("MASK_CONFIG", ""); path != "" {
+		var err error
+		masker, err = mask.Load(path)
+		if err != nil {
+			log.Fatalf("mask: %v", err)
+		}
+		log.Printf("masking rules loaded from %s", path)
+	}
 
-	db, err := sql.Open(driver, dsn)
+	// Initialize query history (optional - the app still works without it)
+	historyStore, err := history.Open(filepath.Join(dataDir, "history.jsonl"))
 	if err != nil {
-		log.Fatalf("open database: %v", err)
+		log.Printf("warning: query history disabled: %v", err)
+		historyStore = nil
 	}
-	if err := db.Ping(); err != nil {
-		log.Fatalf("ping database: %v", err)
+
+	// The audit log is mandatory: refuse to serve queries that can't be audited
+	key := auditKey()
+	if len(key) == 0 {
+		log.Printf("warning: AUDIT_KEY not set; the audit log's hash chain is unkeyed")
+	}
+	auditLog, err := audit.Open(auditLogPath(), key)
+	if err != nil {
+		log.Fatalf("audit: %v (check it with: webdbreader verify-audit)", err)
 	}
 
-	// Initialize schema cache
-	schemaCache := schema.NewCache()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	if err := schemaCache.Load(ctx, db); err != nil {
-		log.Printf("warning: failed to load schema: %v", err)
-	} else {
-		log.Printf("loaded schema: %d tables", schemaCache.TableCount())
+	// Initialize LLM usage accounting (optional, unless budgets are configured)
+	var usageCfg usage.Config
+	if path := env("USAGE_CONFIG", ""); path != "" {
+		if usageCfg, err = usage.LoadConfig(path); err != nil {
+			log.Fatalf("usage: %v", err)
+		}
+		log.Printf("LLM usage config loaded from %s (%d prices)", path, len(usageCfg.Prices))
+	}
+	usageTracker, err := usage.Open(filepath.Join(dataDir, "usage.jsonl"), usageCfg)
+	if err != nil {
+		if usageCfg.Budget != (usage.Budget{}) || len(usageCfg.Users) > 0 {
+			log.Fatalf("usage: %v (needed to enforce budgets)", err)
+		}
+		log.Printf("warning: LLM usage tracking disabled: %v", err)
+		usageTracker = nil
 	}
-	cancel()
 
-	// Initialize LLM provider (optional - only if configured)
-	var llmProvider llm.Provider
-	if os.Getenv("LLM_API_KEY") != "" {
-		llmProvider, err = llm.NewProviderFromEnv()
+	// Initialize the generation cache (optional)
+	var genCache *gencache.Cache[generateSQLResponse]
+	if ttl := envDuration("LLM_CACHE_TTL", 0); ttl > 0 {
+		similarity := envFloat("LLM_CACHE_SIMILARITY", 0.85)
+		genCache = gencache.New[generateSQLResponse](ttl, similarity, maxCacheEntries)
+		log.Printf("generation cache enabled (ttl %s, similarity %.2f)", ttl, similarity)
+	}
+
+	shareStore, err := share.Open(filepath.Join(dataDir, "shares"))
+	if err != nil {
+		log.Printf("warning: sharing disabled: %v", err)
+		shareStore = nil
+	}
+
+	// Initialize saved queries and dashboards (optional)
+	metaStore, err := meta.Open(filepath.Join(dataDir, "meta"))
+	if err != nil {
+		log.Printf("warning: saved queries and dashboards disabled: %v", err)
+		metaStore = nil
+	}
+
+	// Initialize scheduled queries (optional - they need the metadata store)
+	var sched *scheduler
+	if metaStore != nil {
+		sinkCfg := schedule.Config{Sinks: []schedule.SinkConfig{{
+			Name: "local",
+			Type: schedule.TypeDir,
+			Path: filepath.Join(dataDir, "exports"),
+			Keep: defaultExportsKept,
+		}}}
+		if path := env("SCHEDULE_SINKS", ""); path != "" {
+			if sinkCfg, err = schedule.LoadConfig(path); err != nil {
+				log.Fatalf("schedule: %v", err)
+			}
+			log.Printf("schedule sinks loaded from %s (%d sinks)", path, len(sinkCfg.Sinks))
+		}
+		sinks, err := schedule.NewSinks(sinkCfg)
 		if err != nil {
-			log.Printf("warning: failed to initialize LLM: %v", err)
+			log.Fatalf("schedule: %v", err)
+		}
+		runs, err := schedule.OpenRuns(filepath.Join(dataDir, "schedule-runs.jsonl"))
+		if err != nil {
+			log.Printf("warning: scheduled queries disabled: %v", err)
 		} else {
-			log.Printf("LLM provider initialized: %s", llmProvider.Name())
+			sched = &scheduler{
+				sinks:   sinks,
+				runs:    runs,
+				maxRows: envInt("SCHEDULE_MAX_ROWS", defaultScheduleMaxRows),
+				running: make(map[string]string),
+			}
 		}
-	} else {
-		log.Printf("LLM not configured (set LLM_API_KEY to enable)")
 	}
 
 	tmpl := template.Must(template.New("index").Parse(indexHTML))
 	app := &app{
-		db:     db,
-		tmpl:   tmpl,
-		schema: schemaCache,
-		llm:    llmProvider,
+		sources:       sources,
+		tmpl:          tmpl,
+		dashboardTmpl: template.Must(template.New("dashboard").Parse(dashboardHTML)),
+		generation:    gen,
+		history:       historyStore,
+		shares:        shareStore,
+		meta:          metaStore,
+		scheduler:     sched,
+		auth:          authenticator,
+		masker:        masker,
+		audit:         auditLog,
+		usage:         usageTracker,
+		cache:         genCache,
+
+		shareTTL:    envDuration("SHARE_TTL", defaultShareTTL),
+		shareMaxTTL: envDuration("SHARE_MAX_TTL", defaultShareMaxTTL),
+
+		dashboardWorkers: envInt("DASHBOARD_PARALLELISM", defaultDashboardWorkers),
+	}
+	if shareStore != nil {
+		go app.purgeExpiredShares()
+	}
+	if sched != nil {
+		go app.runSchedules()
 	}
 
 	r := chi.NewRouter()
+	r.Use(app.identify)
+
+	// Public: the UI renders its own login screen
 	r.Get("/", app.handleIndex)
-	r.Post("/query", app.handleQuery)
-	r.Post("/export", app.handleExportCSV)
-	r.Post("/generate-sql", app.handleGenerateSQL)
-	r.Get("/schema", app.handleSchema)
-	r.Post("/schema/refresh", app.handleSchemaRefresh)
+	r.Post("/auth/login", app.handleLogin)
+	r.Post("/auth/logout", app.handleLogout)
+	r.Get("/auth/me", app.handleMe)
+	r.Get("/auth/oidc/login", app.handleOIDCLogin)
+	r.Get("/auth/oidc/callback", app.handleOIDCCallback)
+
+	r.Group(func(r chi.Router) {
+		r.Use(app.requireUser)
 
-	log.Printf("listening on %s (driver=%s)", addr, driver)
+		r.Get("/sources", app.handleSources)
+		r.With(app.requireAudit).Post("/query", app.handleQuery)
+		r.With(app.requireAudit).Post("/export", app.handleExportCSV)
+		r.With(app.requireAudit).Post("/generate-sql", app.handleGenerateSQL)
+		r.With(app.requireAudit).Post("/summarize", app.handleSummarize)
+		r.Get("/schema", app.handleSchema)
+		r.Get("/usage", app.handleUsage)
+		r.With(app.requireAudit).Post("/schema/refresh", app.handleSchemaRefresh)
+		r.Get("/history", app.handleHistoryList)
+		r.Get("/history/{id}", app.handleHistoryGet)
+		r.Get("/history/{id}/diff", app.handleHistoryDiff)
+		r.With(app.requireAudit).Post("/history/{id}/rerun", app.handleHistoryRerun)
+		r.With(app.requireAudit).Post("/share", app.handleShareCreate)
+		r.Get("/share/{id}", app.handleShareGet)
+		r.Delete("/share/{id}", app.handleShareDelete)
+		r.Get("/s/{id}", app.handleSharePage)
+		r.Get("/queries", app.handleSavedQueryList)
+		r.Post("/queries", app.handleSavedQueryCreate)
+		r.Get("/queries/{id}", app.handleSavedQueryGet)
+		r.Put("/queries/{id}", app.handleSavedQueryUpdate)
+		r.Delete("/queries/{id}", app.handleSavedQueryDelete)
+		r.With(app.requireAudit).Post("/queries/{id}/run", app.handleSavedQueryRun)
+		r.Get("/dashboards", app.handleDashboardList)
+		r.Post("/dashboards", app.handleDashboardCreate)
+		r.Get("/dashboards/{id}", app.handleDashboardGet)
+		r.Put("/dashboards/{id}", app.handleDashboardUpdate)
+		r.Delete("/dashboards/{id}", app.handleDashboardDelete)
+		r.With(app.requireAudit).Get("/dashboards/{id}/panels/{panel}", app.handleDashboardPanel)
+		r.Get("/schedules", app.handleScheduleList)
+		r.Post("/schedules", app.handleScheduleCreate)
+		r.Get("/schedules/{id}", app.handleScheduleGet)
+		r.Put("/schedules/{id}", app.handleScheduleUpdate)
+		r.Delete("/schedules/{id}", app.handleScheduleDelete)
+		r.Post("/schedules/{id}/run", app.handleScheduleRun)
+		r.Get("/schedules/{id}/runs", app.handleScheduleRuns)
+		r.Get("/d", app.handleDashboardPage)
+		r.Get("/d/{id}", app.handleDashboardPage)
+
+		r.With(app.requireAdmin).Get("/audit", app.handleAuditList)
+	})
+
+	log.Printf("listening on %s (%d data sources, default %s)", addr, len(sources.List()), sources.Default().Name)
 	if err := http.ListenAndServe(addr, r); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func (a *app) handleIndex(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	data := struct {
-		DefaultQuery string
-		DefaultLimit int
-	}{
+// indexData is the template data for the web UI.
+type indexData struct {
+	DefaultQuery string
+	DefaultLimit int
+	Share        *share.Share // Set when the page was opened from a permalink
+	Auth         authView
+}
+
+func (a *app) indexData(r *http.Request) indexData {
+	return indexData{
 		DefaultQuery: defaultExampleQuery,
 		DefaultLimit: defaultLimit,
+		Auth:         a.authView(r),
 	}
+}
+
+// openSources loads the access policy and connects to the configured data
+// sources, exiting on failure.
+func openSources() *source.Registry {
+	// Initialize access policy (optional - without it every caller can read every table)
+	var policyEngine *policy.Engine
+	if path := env("POLICY_CONFIG", ""); path != "" {
+		engine, err := policy.Load(path)
+		if err != nil {
+			log.Fatalf("policy: %v", err)
+		}
+		policyEngine = engine
+		log.Printf("access policy loaded from %s", path)
+	}
+
+	// Initialize data sources: SOURCES_CONFIG, or a single read-only source from DB_DRIVER / DB_DSN
+	driver := env("DB_DRIVER", "") // Inferred from the DSN, else postgres
+	dsn := env("DB_DSN", "postgres://localhost/postgres?sslmode=disable")
+	sourcesCfg := source.Config{
+		Sources: []source.Definition{{Name: source.DefaultName, Driver: driver, DSN: dsn, ReadOnly: true}},
+	}
+	if path := env("SOURCES_CONFIG", ""); path != "" {
+		cfg, err := source.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("sources: %v", err)
+		}
+		sourcesCfg = cfg
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	sources, err := source.Open(ctx, sourcesCfg, policyEngine)
+	cancel()
+	if err != nil {
+		log.Fatalf("sources: %v", err)
+	}
+	return sources
+}
+
+// loadGeneration sets up the LLM provider, prompt templates and knowledge
+// file, exiting on invalid configuration.
+func loadGeneration() generation {
+	var g generation
+
+	// Initialize LLM provider (optional - only if configured)
+	if cfg := llm.ConfigFromEnv(); cfg.Enabled() {
+		provider, err := llm.NewProvider(cfg)
+		if err != nil {
+			log.Printf("warning: failed to initialize LLM: %v", err)
+		} else {
+			g.llm = provider
+			g.llmModel = cfg.Model
+			log.Printf("LLM provider initialized: %s", provider.Name())
+			if cfg.Record != "" {
+				log.Printf("recording LLM responses to %s", cfg.Record)
+			}
+		}
+	} else {
+		log.Printf("LLM not configured (set LLM_API_KEY, or LLM_PROVIDER=replay, to enable)")
+	}
+	var err error
+	if path := env("LLM_REDACT_CONFIG", ""); path != "" {
+		if g.redactor, err = llm.LoadRedactor(path); err != nil {
+			log.Fatalf("redaction: %v", err)
+		}
+		if g.llm != nil {
+			g.llm = g.redactor.Wrap(g.llm)
+		}
+		log.Printf("LLM redaction loaded from %s", path)
+	}
+	if g.prompts, err = llm.LoadPrompts(env("LLM_PROMPT_TEMPLATE", "")); err != nil {
+		log.Fatalf("prompt template: %v", err)
+	}
+	if g.promptTZ, err = time.LoadLocation(env("LLM_TIMEZONE", "UTC")); err != nil {
+		log.Fatalf("LLM_TIMEZONE: %v", err)
+	}
+
+	// Initialize glossary and examples (optional)
+	if path := env("KNOWLEDGE_CONFIG", ""); path != "" {
+		if g.knowledge, err = knowledge.Load(path); err != nil {
+			log.Fatalf("knowledge: %v", err)
+		}
+		terms, examples := g.knowledge.Size()
+		log.Printf("knowledge loaded from %s: %d terms, %d examples", path, terms, examples)
+	}
+
+	if g.agentSteps = envInt("LLM_AGENT_STEPS", 0); g.agentSteps > 0 && g.llm != nil {
+		log.Printf("LLM database tools enabled (up to %d steps)", g.agentSteps)
+	}
+	g.summaryCells = envInt("SUMMARY_MAX_CELLS", defaultSummaryCells)
+	return g
+}
+
+func (a *app) handleIndex(w http.ResponseWriter, r *http.Request) {
+	a.renderIndex(w, a.indexData(r))
+}
+
+func (a *app) renderIndex(w http.ResponseWriter, data indexData) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := a.tmpl.Execute(w, data); err != nil {
 		http.Error(w, "template error", http.StatusInternalServerError)
 	}
@@ -130,28 +457,80 @@ func (a *app) handleQuery(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusBadRequest, queryResponse{Error: "invalid JSON body"})
 		return
 	}
+	if !validChartMode(req.Chart) {
+		respondJSON(w, http.StatusBadRequest, queryResponse{Error: `chart must be "auto", "llm" or "none"`})
+		return
+	}
 
-	query, err := validateSelectQuery(req.Query)
-	if err != nil {
-		respondJSON(w, http.StatusBadRequest, queryResponse{Error: err.Error()})
+	src := a.sourceName(req.Source)
+	resp, status := a.runQuery(r.Context(), src, req.Query, req.Limit)
+	if status == http.StatusOK {
+		resp.Chart = a.recommendChart(w, r, src, resp, req.Chart)
+	}
+	if err := a.recordAudit(r, status, audit.Record{
+		Action:     audit.ActionQuery,
+		Source:     src,
+		SQL:        strings.TrimSpace(req.Query),
+		FromLLM:    a.fromLLM(req.ParentID, req.Query),
+		RowCount:   resp.Count,
+		DurationMs: resp.DurationMs,
+		Error:      resp.Error,
+	}); err != nil {
+		respondJSON(w, http.StatusServiceUnavailable, queryResponse{Error: err.Error()})
 		return
 	}
+	resp.HistoryID = a.recordHistory(r, history.Entry{
+		Kind:       history.KindQuery,
+		ParentID:   req.ParentID,
+		Source:     src,
+		SQL:        strings.TrimSpace(req.Query),
+		RowCount:   resp.Count,
+		DurationMs: resp.DurationMs,
+		Error:      resp.Error,
+	})
 
-	limit := clampLimit(req.Limit)
+	respondJSON(w, status, resp)
+}
 
-	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
+// runQuery validates and executes a query against the named source,
+// collecting up to limit rows. It returns the response along with the HTTP
+// status it should be sent with.
+func (a *app) runQuery(ctx context.Context, sourceName, raw string, limit int) (queryResponse, int) {
+	src, err := a.sources.Get(sourceName)
+	if err != nil {
+		return queryResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+
+	query, err := validateSelectQuery(src.Dialect, raw)
+	if err != nil {
+		return queryResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+
+	limit = clampLimit(limit)
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
 
 	start := time.Now()
-	result, err := a.executeSelectQuery(ctx, query)
+	fail := func(status int, err error) (queryResponse, int) {
+		return queryResponse{Error: err.Error(), DurationMs: time.Since(start).Milliseconds()}, status
+	}
+
+	result, err := a.executeSelectQuery(ctx, src, query)
 	if err != nil {
-		respondJSON(w, http.StatusBadRequest, queryResponse{Error: err.Error()})
-		return
+		return fail(queryErrorStatus(err), err)
 	}
-	defer result.rows.Close()
+	defer result.close()
 
 	resp := queryResponse{
 		Columns: result.columns,
+		Masked:  result.mask.Masked(),
+		query:   query,
+	}
+	if cts, err := result.rows.ColumnTypes(); err == nil {
+		for _, ct := range cts {
+			resp.types = append(resp.types, ct.DatabaseTypeName())
+		}
 	}
 
 	for result.rows.Next() {
@@ -161,20 +540,18 @@ func (a *app) handleQuery(w http.ResponseWriter, r *http.Request) {
 		}
 		values, err := scanRow(result.rows, len(result.columns))
 		if err != nil {
-			respondJSON(w, http.StatusInternalServerError, queryResponse{Error: err.Error()})
-			return
+			return fail(http.StatusInternalServerError, err)
 		}
-		resp.Rows = append(resp.Rows, normalizeRow(values))
+		resp.Rows = append(resp.Rows, normalizeRow(values, result.mask))
 	}
 	if err := result.rows.Err(); err != nil {
-		respondJSON(w, http.StatusInternalServerError, queryResponse{Error: err.Error()})
-		return
+		return fail(http.StatusInternalServerError, err)
 	}
 
 	resp.Count = len(resp.Rows)
 	resp.DurationMs = time.Since(start).Milliseconds()
 
-	respondJSON(w, http.StatusOK, resp)
+	return resp, http.StatusOK
 }
 
 // TODO(shared-use): Improve CSV filename to include table name and date (e.g., "anrok_transactions_2025-12-20.csv").
@@ -182,112 +559,300 @@ func (a *app) handleQuery(w http.ResponseWriter, r *http.Request) {
 // Options: user-provided filename, timestamp-only fallback, or server-side SQL parsing.
 func (a *app) handleExportCSV(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Query string `json:"query"`
+		Query    string `json:"query"`
+		Source   string `json:"source"`
+		ParentID string `json:"parentId"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
-	query, err := validateSelectQuery(req.Query)
+	start := time.Now()
+	status := http.StatusOK
+	entry := history.Entry{
+		Kind:     history.KindExport,
+		ParentID: req.ParentID,
+		Source:   a.sourceName(req.Source),
+		SQL:      strings.TrimSpace(req.Query),
+	}
+	defer func() {
+		entry.DurationMs = time.Since(start).Milliseconds()
+		// The export has already streamed; a failure here stops later requests
+		a.recordAudit(r, status, audit.Record{
+			Action:     audit.ActionExport,
+			Source:     entry.Source,
+			SQL:        entry.SQL,
+			FromLLM:    a.fromLLM(req.ParentID, req.Query),
+			RowCount:   entry.RowCount,
+			DurationMs: entry.DurationMs,
+			Error:      entry.Error,
+		})
+		a.recordHistory(r, entry)
+	}()
+
+	src, err := a.sources.Get(req.Source)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		entry.Error = err.Error()
+		status = http.StatusBadRequest
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	query, err := validateSelectQuery(src.Dialect, req.Query)
+	if err != nil {
+		entry.Error = err.Error()
+		status = http.StatusBadRequest
+		http.Error(w, err.Error(), status)
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), queryTimeout)
 	defer cancel()
 
-	result, err := a.executeSelectQuery(ctx, query)
+	result, err := a.executeSelectQuery(ctx, src, query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		entry.Error = err.Error()
+		status = queryErrorStatus(err)
+		http.Error(w, err.Error(), status)
 		return
 	}
-	defer result.rows.Close()
+	defer result.close()
 
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=export.csv")
+	if masked := result.mask.Masked(); len(masked) > 0 {
+		w.Header().Set("X-Masked-Columns", joinInts(masked))
+	}
+
+	n, err := writeCSV(w, result, 0)
+	entry.RowCount = n
+	if err != nil {
+		entry.Error = err.Error()
+	}
+}
+
+var errTooManyRows = errors.New("too many rows")
 
+// writeCSV writes a result as CSV with a header row and returns the number of
+// rows written. It stops with errTooManyRows past maxRows, unless maxRows is 0.
+func writeCSV(w io.Writer, result *queryResult, maxRows int) (int, error) {
 	csvWriter := csv.NewWriter(w)
 	defer csvWriter.Flush()
 
 	if err := csvWriter.Write(result.columns); err != nil {
-		return
+		return 0, err
 	}
 
+	n := 0
 	for result.rows.Next() {
+		if maxRows > 0 && n >= maxRows {
+			return n, errTooManyRows
+		}
 		values, err := scanRow(result.rows, len(result.columns))
 		if err != nil {
-			return
+			return n, err
 		}
 		record := make([]string, len(result.columns))
 		for i, v := range values {
-			record[i] = formatCSVValue(v)
+			record[i] = formatCSVValue(result.mask.Apply(i, v))
 		}
 		if err := csvWriter.Write(record); err != nil {
-			return
+			return n, err
 		}
+		n++
 	}
+	return n, result.rows.Err()
 }
 
 type generateSQLRequest struct {
-	Prompt string `json:"prompt"`
+	Prompt   string `json:"prompt"`
+	Source   string `json:"source"`
+	ParentID string `json:"parentId"`
+	NoCache  bool   `json:"noCache"` // Ask the LLM even if a cached answer matches
 }
 
 type generateSQLResponse struct {
-	SQL     string `json:"sql,omitempty"`
-	Missing string `json:"missing,omitempty"`
-	Error   string `json:"error,omitempty"`
-	Tokens  int    `json:"tokens,omitempty"`
+	SQL              string   `json:"sql,omitempty"`
+	Missing          string   `json:"missing,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	Tokens           int      `json:"tokens,omitempty"`
+	PromptTokens     int      `json:"promptTokens,omitempty"`
+	CompletionTokens int      `json:"completionTokens,omitempty"`
+	Cost             float64  `json:"cost,omitempty"`          // USD, when the model is in the price table
+	PromptVersion    string   `json:"promptVersion,omitempty"` // System prompt template the LLM was given
+	Knowledge        []string `json:"knowledge,omitempty"`     // Glossary terms and example questions included
+	Provider         string   `json:"provider,omitempty"`      // LLM provider that answered
+	Model            string   `json:"model,omitempty"`         // Model that answered, as configured
+	Assumptions      []string `json:"assumptions,omitempty"`   // How the model interpreted the prompt
+	TablesUsed       []string `json:"tablesUsed,omitempty"`    // Tables the model says it used
+	Confidence       float64  `json:"confidence,omitempty"`    // Model's stated confidence, 0 to 1
+	HistoryID        string   `json:"historyId,omitempty"`
+
+	Cached    *cacheHit      `json:"cached,omitempty"`    // Set when the answer came from the cache
+	ToolCalls []llm.ToolCall `json:"toolCalls,omitempty"` // Database tools the model called
+
+	rawSQL      string      // LLM output, kept when validation rejects it
+	toolQueries []toolQuery // Statements the tools ran, to audit
 }
 
 func (a *app) handleGenerateSQL(w http.ResponseWriter, r *http.Request) {
-	if a.llm == nil {
-		respondJSON(w, http.StatusServiceUnavailable, generateSQLResponse{
-			Error: "LLM not configured. Set LLM_API_KEY environment variable.",
-		})
-		return
-	}
-
 	var req generateSQLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondJSON(w, http.StatusBadRequest, generateSQLResponse{Error: "invalid JSON body"})
 		return
 	}
 
-	if strings.TrimSpace(req.Prompt) == "" {
-		respondJSON(w, http.StatusBadRequest, generateSQLResponse{Error: "prompt is required"})
-		return
+	start := time.Now()
+	src := a.sourceName(req.Source)
+	resp, status := a.generateSQLWithBudget(w, r, src, req.Prompt, !req.NoCache)
+	if strings.TrimSpace(req.Prompt) != "" {
+		err := a.auditToolQueries(r, src, req.Prompt, resp.toolQueries)
+		if err == nil {
+			err = a.recordAudit(r, status, audit.Record{
+				Action:     audit.ActionGenerate,
+				Source:     src,
+				Prompt:     req.Prompt,
+				SQL:        resp.SQL,
+				FromLLM:    true,
+				DurationMs: time.Since(start).Milliseconds(),
+				Error:      resp.Error,
+			})
+		}
+		if err != nil {
+			respondJSON(w, http.StatusServiceUnavailable, generateSQLResponse{Error: err.Error()})
+			return
+		}
+		resp.HistoryID = a.recordHistory(r, history.Entry{
+			Kind:       history.KindGenerate,
+			ParentID:   req.ParentID,
+			Source:     src,
+			Prompt:     req.Prompt,
+			SQL:        resp.SQL,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      resp.Error,
+		})
+	}
+
+	respondJSON(w, status, resp)
+}
+
+// generateSQL asks the LLM for SQL answering prompt against the named source's
+// schema and validates the result. With useCache a cached answer to the same
+// or a similar prompt is returned instead; either way new answers are cached.
+// It returns the response along with the HTTP status it should be sent with.
+func (a *app) generateSQL(ctx context.Context, sourceName, prompt string, useCache bool) (generateSQLResponse, int) {
+	src, err := a.sources.Get(sourceName)
+	if err != nil {
+		return generateSQLResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+
+	if a.llm == nil {
+		return generateSQLResponse{
+			Error: "LLM not configured. Set LLM_API_KEY environment variable.",
+		}, http.StatusServiceUnavailable
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	if strings.TrimSpace(prompt) == "" {
+		return generateSQLResponse{Error: "prompt is required"}, http.StatusBadRequest
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
+	if useCache {
+		if out, ok := a.cachedAnswer(ctx, src, prompt); ok {
+			return out, http.StatusOK
+		}
+	}
+
+	var sel knowledge.Selection
+	if a.knowledge != nil {
+		// Skip examples whose SQL the caller couldn't run, so they don't leak hidden tables
+		sel = a.knowledge.Select(prompt, src.Name, func(ex knowledge.Example) bool {
+			return a.checkQueryAccess(ctx, src, ex.SQL) == nil && a.redactionAllows(src, ex.SQL)
+		})
+	}
+
+	tmpl := a.prompts.For(src.Dialect.Name())
+	schemaText := src.Schema.ToTextFiltered(a.llmSchemaFilter(ctx, src))
+	system, err := tmpl.Render(llm.PromptData{
+		Dialect:      src.Dialect.Title(),
+		Schema:       schemaText,
+		Glossary:     sel.GlossaryText(),
+		Examples:     sel.ExamplesText(),
+		Today:        time.Now().In(a.promptTZ).Format(time.DateOnly),
+		Timezone:     a.promptTZ.String(),
+		DefaultLimit: defaultLimit,
+		MaxLimit:     maxLimit,
+	})
+	if err != nil {
+		return generateSQLResponse{Error: err.Error()}, http.StatusInternalServerError
+	}
+
 	llmReq := llm.GenerateRequest{
-		Prompt: req.Prompt,
-		Schema: a.schema.ToText(),
+		Prompt:  prompt,
+		Schema:  schemaText,
+		Dialect: src.Dialect.Name(),
+		System:  system,
+	}
+	var tools *dbTools
+	if a.agentSteps > 0 {
+		tools = a.newDBTools(ctx, src)
+		llmReq.Tools = tools
+		llmReq.MaxSteps = a.agentSteps
 	}
 
 	resp, err := a.llm.GenerateSQL(ctx, llmReq)
+	var toolQueries []toolQuery
+	if tools != nil {
+		toolQueries = tools.Queries()
+	}
 	if err != nil {
-		respondJSON(w, http.StatusInternalServerError, generateSQLResponse{Error: resp.Error})
-		return
+		// A failure can still have cost tokens, e.g. after tool calls
+		return generateSQLResponse{
+			Error:            resp.Error,
+			Tokens:           resp.Tokens,
+			PromptTokens:     resp.PromptTokens,
+			CompletionTokens: resp.CompletionTokens,
+			PromptVersion:    tmpl.Version,
+			Provider:         cmp.Or(resp.Provider, a.llm.Name()),
+			Model:            resp.Model,
+			ToolCalls:        resp.ToolCalls,
+			toolQueries:      toolQueries,
+		}, http.StatusInternalServerError
 	}
 
+	out := generateSQLResponse{
+		Tokens:           resp.Tokens,
+		PromptTokens:     resp.PromptTokens,
+		CompletionTokens: resp.CompletionTokens,
+		PromptVersion:    tmpl.Version,
+		Knowledge:        sel.Names(),
+		Provider:         cmp.Or(resp.Provider, a.llm.Name()),
+		Model:            resp.Model,
+		Assumptions:      resp.Assumptions,
+		TablesUsed:       resp.TablesUsed,
+		Confidence:       resp.Confidence,
+		ToolCalls:        resp.ToolCalls,
+		rawSQL:           resp.SQL,
+		toolQueries:      toolQueries,
+	}
 	if resp.IsMissing() {
-		respondJSON(w, http.StatusOK, generateSQLResponse{Missing: resp.Missing, Tokens: resp.Tokens})
-		return
+		out.Missing = resp.Missing
+		a.cacheAnswer(ctx, src, prompt, out)
+		return out, http.StatusOK
 	}
 
 	// Validate the generated SQL
-	if _, err := validateSelectQuery(resp.SQL); err != nil {
-		respondJSON(w, http.StatusBadRequest, generateSQLResponse{
-			Error: "LLM generated invalid query: " + err.Error(),
-		})
-		return
+	if _, err := validateSelectQuery(src.Dialect, resp.SQL); err != nil {
+		out.Error = "LLM generated invalid query: " + err.Error()
+		return out, http.StatusBadRequest
 	}
 
-	respondJSON(w, http.StatusOK, generateSQLResponse{SQL: resp.SQL, Tokens: resp.Tokens})
+	out.SQL = resp.SQL
+	a.cacheAnswer(ctx, src, prompt, out)
+	return out, http.StatusOK
 }
 
 type schemaResponse struct {
@@ -297,27 +862,61 @@ type schemaResponse struct {
 }
 
 func (a *app) handleSchema(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, schemaResponse{
-		Tables:      a.schema.GetTables(),
-		TableCount:  a.schema.TableCount(),
-		LastRefresh: a.schema.GetLastRefresh().Format(time.RFC3339),
-	})
+	src, err := a.sources.Get(r.URL.Query().Get("source"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, a.schemaResponse(r.Context(), src))
 }
 
 func (a *app) handleSchemaRefresh(w http.ResponseWriter, r *http.Request) {
+	src, err := a.sources.Get(r.URL.Query().Get("source"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	if err := a.schema.Load(ctx, a.db); err != nil {
+	start := time.Now()
+	err = src.Schema.Load(ctx, src.DB)
+	rec := audit.Record{
+		Action:     audit.ActionSchemaRefresh,
+		Source:     src.Name,
+		RowCount:   src.Schema.TableCount(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+		a.recordAudit(r, http.StatusInternalServerError, rec)
 		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 		return
 	}
+	if err := a.recordAudit(r, http.StatusOK, rec); err != nil {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
 
-	respondJSON(w, http.StatusOK, schemaResponse{
-		Tables:      a.schema.GetTables(),
-		TableCount:  a.schema.TableCount(),
-		LastRefresh: a.schema.GetLastRefresh().Format(time.RFC3339),
-	})
+	if a.cache != nil {
+		if n := a.cache.Invalidate(src.Name, src.Schema.Fingerprint()); n > 0 {
+			log.Printf("schema of %s changed, dropped %d cached generations", src.Name, n)
+		}
+	}
+	a.logRedactions(src)
+
+	respondJSON(w, http.StatusOK, a.schemaResponse(r.Context(), src))
+}
+
+// schemaResponse describes a source's cached schema as visible to the caller.
+func (a *app) schemaResponse(ctx context.Context, src *source.Source) schemaResponse {
+	tables := src.Schema.GetTablesFiltered(a.schemaFilter(ctx, src))
+	return schemaResponse{
+		Tables:      tables,
+		TableCount:  len(tables),
+		LastRefresh: src.Schema.GetLastRefresh().Format(time.RFC3339),
+	}
 }
 
 func formatCSVValue(v any) string {
@@ -333,7 +932,9 @@ func formatCSVValue(v any) string {
 	}
 }
 
-func normalizeRow(values []any) []any {
+// normalizeRow converts scanned values to JSON-friendly types and masks the
+// columns the plan covers.
+func normalizeRow(values []any, plan *mask.Plan) []any {
 	row := make([]any, len(values))
 	for i, v := range values {
 		switch val := v.(type) {
@@ -346,6 +947,7 @@ func normalizeRow(values []any) []any {
 		default:
 			row[i] = val
 		}
+		row[i] = plan.Apply(i, row[i])
 	}
 	return row
 }
@@ -362,40 +964,100 @@ func clampLimit(limit int) int {
 
 var errEmptyQuery = fmt.Errorf("query is required")
 var errNotSelectQuery = fmt.Errorf("only SELECT / CTE queries are allowed")
+var errMultipleStatements = fmt.Errorf("only one statement can be run at a time")
+var errWritingQuery = fmt.Errorf("queries may not write or lock data (INTO, UPDATE, DELETE, FOR UPDATE/SHARE)")
 
-func validateSelectQuery(raw string) (string, error) {
+// validateSelectQuery checks that raw is a single read-only statement. It
+// tokenizes with the dialect's rules so comments and strings can't hide a
+// second statement or a write.
+func validateSelectQuery(dialect schema.Dialect, raw string) (string, error) {
 	query := strings.TrimSpace(raw)
 	if query == "" {
 		return "", errEmptyQuery
 	}
-	lower := strings.ToLower(query)
-	if !strings.HasPrefix(lower, "select") && !strings.HasPrefix(lower, "with") {
+
+	toks, err := sqlparse.TokenizeWith(query, dialect.Syntax())
+	if err != nil {
+		return "", err
+	}
+	if len(toks) == 0 {
+		return "", errEmptyQuery
+	}
+	if !toks[0].Is("select") && !toks[0].Is("with") {
 		return "", errNotSelectQuery
 	}
+
+	for i, t := range toks {
+		var next sqlparse.Token
+		if i+1 < len(toks) {
+			next = toks[i+1]
+		}
+		switch {
+		case t.Is(";") && i+1 < len(toks):
+			return "", errMultipleStatements
+		case t.Is("into"), // SELECT INTO, INTO OUTFILE, INSERT / MERGE INTO
+			t.Is("update"), // UPDATE in a data-modifying CTE, FOR [NO KEY] UPDATE
+			t.Is("delete") && next.Is("from"),
+			t.Is("for") && (next.Is("share") || next.Is("key")),
+			t.Is("lock") && next.Is("in"): // MySQL LOCK IN SHARE MODE
+			return "", errWritingQuery
+		}
+	}
 	return query, nil
 }
 
 // queryResult holds the result of executing a SELECT query.
 type queryResult struct {
 	rows    *sql.Rows
+	tx      *sql.Tx // Read-only transaction the rows belong to, if any
 	columns []string
+	mask    *mask.Plan // nil when no column is masked
+}
+
+// close releases the rows and ends the transaction they were read in.
+func (r *queryResult) close() {
+	r.rows.Close()
+	if r.tx != nil {
+		_ = r.tx.Rollback()
+	}
 }
 
-// executeSelectQuery executes a SELECT query and returns the rows with column names.
-// The caller is responsible for closing the rows.
-func (a *app) executeSelectQuery(ctx context.Context, query string) (*queryResult, error) {
-	rows, err := a.db.QueryContext(ctx, query)
+// executeSelectQuery executes a SELECT query on a source and returns the rows
+// with column names. The query is checked against the caller's access policy
+// first, and the result carries the caller's masking plan. Read-only sources
+// run it in a read-only transaction.
+// The caller is responsible for closing the result.
+func (a *app) executeSelectQuery(ctx context.Context, src *source.Source, query string) (*queryResult, error) {
+	if err := a.checkQueryAccess(ctx, src, query); err != nil {
+		return nil, err
+	}
+
+	result := &queryResult{}
+	var err error
+	if src.ReadOnly {
+		result.tx, err = src.Dialect.BeginReadOnly(ctx, src.DB, queryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		result.rows, err = result.tx.QueryContext(ctx, src.Dialect.LimitQuery(query, queryTimeout))
+	} else {
+		result.rows, err = src.DB.QueryContext(ctx, query)
+	}
 	if err != nil {
+		if result.tx != nil {
+			_ = result.tx.Rollback()
+		}
 		return nil, err
 	}
 
-	columns, err := rows.Columns()
+	result.columns, err = result.rows.Columns()
 	if err != nil {
-		rows.Close()
+		result.close()
 		return nil, err
 	}
 
-	return &queryResult{rows: rows, columns: columns}, nil
+	result.mask = a.maskPlan(ctx, src, query, result.columns)
+	return result, nil
 }
 
 func scanRow(rows *sql.Rows, numCols int) ([]any, error) {
@@ -417,6 +1079,45 @@ func env(key, fallback string) string {
 	return fallback
 }
 
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := env(key, "")
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("warning: invalid %s %q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	v := env(key, "")
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Printf("warning: invalid %s %q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+func envFloat(key string, fallback float64) float64 {
+	v := env(key, "")
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Printf("warning: invalid %s %q, using %g", key, v, fallback)
+		return fallback
+	}
+	return f
+}
+
 func respondJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -425,3 +1126,6 @@ func respondJSON(w http.ResponseWriter, status int, payload any) {
 
 //go:embed templates/index.html
 var indexHTML string
+
+//go:embed templates/dashboard.html
+var dashboardHTML string
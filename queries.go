@@ -0,0 +1,246 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+	"github.com/JonMunkholm/WebDbReader/internal/meta"
+	"github.com/JonMunkholm/WebDbReader/internal/params"
+	"github.com/go-chi/chi/v5"
+)
+
+type savedQueryRequest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	SQL         string         `json:"sql"`
+	Source      string         `json:"source"`
+	Params      []params.Param `json:"params"`
+}
+
+type savedQueryRunRequest struct {
+	Params map[string]string `json:"params"` // Parameter values; defaults fill the rest
+	Limit  int               `json:"limit"`
+	Chart  string            `json:"chart"` // As for /query
+}
+
+func (a *app) handleSavedQueryList(w http.ResponseWriter, r *http.Request) {
+	if !a.requireMeta(w) {
+		return
+	}
+	queries, err := a.meta.Queries()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"queries": queries})
+}
+
+func (a *app) handleSavedQueryCreate(w http.ResponseWriter, r *http.Request) {
+	if !a.requireMeta(w) {
+		return
+	}
+	q, ok := a.decodeSavedQuery(w, r)
+	if !ok {
+		return
+	}
+	q.CreatedBy = requestUser(r)
+	q, err := a.meta.CreateQuery(q)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusCreated, q)
+}
+
+func (a *app) handleSavedQueryGet(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.lookupSavedQuery(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, q)
+}
+
+func (a *app) handleSavedQueryUpdate(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.lookupSavedQuery(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, old.CreatedBy) {
+		return
+	}
+	q, ok := a.decodeSavedQuery(w, r)
+	if !ok {
+		return
+	}
+	q, err := a.meta.UpdateQuery(old.ID, q)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, q)
+}
+
+func (a *app) handleSavedQueryDelete(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.lookupSavedQuery(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, q.CreatedBy) {
+		return
+	}
+	if err := a.meta.DeleteQuery(q.ID); err != nil && !errors.Is(err, meta.ErrNotFound) {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSavedQueryRun runs a saved query with the given parameter values,
+// like /query.
+func (a *app) handleSavedQueryRun(w http.ResponseWriter, r *http.Request) {
+	q, ok := a.lookupSavedQuery(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	var req savedQueryRunRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondJSON(w, http.StatusBadRequest, queryResponse{Error: "invalid JSON body"})
+			return
+		}
+	}
+	if !validChartMode(req.Chart) {
+		respondJSON(w, http.StatusBadRequest, queryResponse{Error: `chart must be "auto", "llm" or "none"`})
+		return
+	}
+
+	resp, status := a.runSavedQuery(r.Context(), q, req.Params, req.Limit)
+	if status == http.StatusOK {
+		resp.Chart = a.recommendChart(w, r, q.Source, resp, req.Chart)
+	}
+	if err := a.recordAudit(r, status, audit.Record{
+		Action:     audit.ActionQuery,
+		Source:     a.sourceName(q.Source),
+		SQL:        cmp.Or(resp.query, q.SQL),
+		RowCount:   resp.Count,
+		DurationMs: resp.DurationMs,
+		Error:      resp.Error,
+	}); err != nil {
+		respondJSON(w, http.StatusServiceUnavailable, queryResponse{Error: err.Error()})
+		return
+	}
+	respondJSON(w, status, resp)
+}
+
+// runSavedQuery binds parameter values into a saved query and runs it like
+// /query. The bound SQL is kept in the response's query field.
+func (a *app) runSavedQuery(ctx context.Context, q meta.Query, values map[string]string, limit int) (queryResponse, int) {
+	src, err := a.sources.Get(q.Source)
+	if err != nil {
+		return queryResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+	query, err := params.Bind(q.SQL, src.Dialect.Syntax(), q.Params, values, time.Now())
+	if err != nil {
+		return queryResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+	resp, status := a.runQuery(ctx, src.Name, query, limit)
+	resp.query = query
+	return resp, status
+}
+
+// decodeSavedQuery reads a saved query from the request body and checks that
+// its source exists and that it is a single read-only query once bound.
+func (a *app) decodeSavedQuery(w http.ResponseWriter, r *http.Request) (meta.Query, bool) {
+	var req savedQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return meta.Query{}, false
+	}
+	q := meta.Query{
+		Name:        req.Name,
+		Description: req.Description,
+		SQL:         req.SQL,
+		Source:      req.Source,
+		Params:      req.Params,
+	}
+	if err := q.Validate(); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return meta.Query{}, false
+	}
+	src, err := a.sources.Get(q.Source)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return meta.Query{}, false
+	}
+
+	// Parameters without defaults get a sample value of their type
+	samples := make(map[string]string)
+	for _, p := range q.Params {
+		switch {
+		case p.Default != "":
+		case p.Type == params.Number:
+			samples[p.Name] = "0"
+		case p.Type == params.Date:
+			samples[p.Name] = "today"
+		default:
+			samples[p.Name] = ""
+		}
+	}
+	bound, err := params.Bind(q.SQL, src.Dialect.Syntax(), q.Params, samples, time.Now())
+	if err == nil {
+		_, err = validateSelectQuery(src.Dialect, bound)
+	}
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return meta.Query{}, false
+	}
+	return q, true
+}
+
+// lookupSavedQuery fetches a saved query, writing an error response if it is unavailable.
+func (a *app) lookupSavedQuery(w http.ResponseWriter, id string) (meta.Query, bool) {
+	if !a.requireMeta(w) {
+		return meta.Query{}, false
+	}
+	q, err := a.meta.Query(id)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": "saved query: " + err.Error()})
+		return meta.Query{}, false
+	}
+	return q, true
+}
+
+// requireMeta writes an error response when the metadata store is unavailable.
+func (a *app) requireMeta(w http.ResponseWriter) bool {
+	if a.meta == nil {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "saved queries are not enabled"})
+		return false
+	}
+	return true
+}
+
+// requireOwner lets only the creator of a record, or an admin, change it, or
+// see it where the record is private.
+func (a *app) requireOwner(w http.ResponseWriter, r *http.Request, createdBy string) bool {
+	if createdBy == requestUser(r) {
+		return true
+	}
+	if u, ok := auth.UserFromContext(r.Context()); ok && u.IsAdmin() {
+		return true
+	}
+	respondJSON(w, http.StatusForbidden, map[string]string{"error": "only the creator or an admin can access this"})
+	return false
+}
+
+// metaErrorStatus maps a metadata store error to an HTTP status.
+func metaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, meta.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, meta.ErrInUse):
+		return http.StatusConflict
+	}
+	log.Printf("error: metadata store: %v", err)
+	return http.StatusInternalServerError
+}
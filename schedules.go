@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+	"github.com/JonMunkholm/WebDbReader/internal/meta"
+	"github.com/JonMunkholm/WebDbReader/internal/params"
+	"github.com/JonMunkholm/WebDbReader/internal/policy"
+	"github.com/JonMunkholm/WebDbReader/internal/schedule"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultScheduleMaxRows = 100000
+	defaultExportsKept     = 10
+	defaultRunsLimit       = 50
+)
+
+// scheduler runs the schedules in the metadata store and delivers their
+// results.
+type scheduler struct {
+	sinks   *schedule.Sinks
+	runs    *schedule.Runs
+	maxRows int // Most rows a scheduled result may have; 0 for no limit
+
+	mu      sync.Mutex
+	running map[string]string // Schedule ID to the ID of its run in progress
+}
+
+// begin claims a schedule for a new run. It fails while the schedule's
+// previous run is still going, so runs never overlap.
+func (s *scheduler) begin(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, busy := s.running[id]; busy {
+		return "", false
+	}
+	runID := schedule.NewRunID()
+	s.running[id] = runID
+	return runID, true
+}
+
+func (s *scheduler) end(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, id)
+}
+
+func (s *scheduler) runningRun(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running[id]
+}
+
+type scheduleRequest struct {
+	Name       string            `json:"name"`
+	QueryID    string            `json:"queryId"`
+	Params     map[string]string `json:"params"`
+	Cron       string            `json:"cron"`
+	Timezone   string            `json:"timezone"`
+	Format     string            `json:"format"`
+	Sinks      []string          `json:"sinks"`
+	Retries    int               `json:"retries"`
+	RetryDelay string            `json:"retryDelay"`
+	Paused     bool              `json:"paused"`
+}
+
+type scheduleResponse struct {
+	meta.Schedule
+	NextRun *time.Time    `json:"nextRun,omitempty"`
+	LastRun *schedule.Run `json:"lastRun,omitempty"`
+	Running string        `json:"running,omitempty"` // ID of the run in progress
+}
+
+func (a *app) handleScheduleList(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScheduler(w) {
+		return
+	}
+	schedules, err := a.meta.Schedules()
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	// Schedules carry parameters and delivery targets, so callers only see their own
+	user := requestUser(r)
+	resp := make([]scheduleResponse, 0, len(schedules))
+	for _, sc := range schedules {
+		if sc.CreatedBy == user || isAdmin(r) {
+			resp = append(resp, a.scheduleResponse(sc))
+		}
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"schedules": resp, "sinks": a.scheduler.sinks.Names()})
+}
+
+func (a *app) handleScheduleCreate(w http.ResponseWriter, r *http.Request) {
+	if !a.requireScheduler(w) {
+		return
+	}
+	sc, ok := a.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	sc.CreatedBy = requestUser(r)
+	sc.Roles = requestRoles(r)
+	sc, err := a.meta.CreateSchedule(sc)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusCreated, a.scheduleResponse(sc))
+}
+
+func (a *app) handleScheduleGet(w http.ResponseWriter, r *http.Request) {
+	sc, ok := a.lookupSchedule(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, sc.CreatedBy) {
+		return
+	}
+	respondJSON(w, http.StatusOK, a.scheduleResponse(sc))
+}
+
+func (a *app) handleScheduleUpdate(w http.ResponseWriter, r *http.Request) {
+	old, ok := a.lookupSchedule(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, old.CreatedBy) {
+		return
+	}
+	sc, ok := a.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	// Runs keep the creator's roles; an admin editing it doesn't lend theirs
+	sc.Roles = old.Roles
+	if requestUser(r) == old.CreatedBy {
+		sc.Roles = requestRoles(r)
+	}
+	sc, err := a.meta.UpdateSchedule(old.ID, sc)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, a.scheduleResponse(sc))
+}
+
+func (a *app) handleScheduleDelete(w http.ResponseWriter, r *http.Request) {
+	sc, ok := a.lookupSchedule(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, sc.CreatedBy) {
+		return
+	}
+	if err := a.meta.DeleteSchedule(sc.ID); err != nil && !errors.Is(err, meta.ErrNotFound) {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleScheduleRun starts a run right away, paused or not. The run goes on
+// in the background; its outcome shows up in /schedules/{id}/runs.
+func (a *app) handleScheduleRun(w http.ResponseWriter, r *http.Request) {
+	sc, ok := a.lookupSchedule(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, sc.CreatedBy) {
+		return
+	}
+	runID, ok := a.scheduler.begin(sc.ID)
+	if !ok {
+		respondJSON(w, http.StatusConflict, map[string]string{"error": "a run is already in progress"})
+		return
+	}
+	go a.runSchedule(sc, runID, schedule.TriggerManual)
+	respondJSON(w, http.StatusAccepted, map[string]string{"runId": runID})
+}
+
+// handleScheduleRuns lists a schedule's runs, newest first.
+func (a *app) handleScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	sc, ok := a.lookupSchedule(w, chi.URLParam(r, "id"))
+	if !ok || !a.requireOwner(w, r, sc.CreatedBy) {
+		return
+	}
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 {
+		limit = defaultRunsLimit
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	runs, total := a.scheduler.runs.List(sc.ID, limit, max(offset, 0))
+	respondJSON(w, http.StatusOK, map[string]any{"runs": runs, "total": total})
+}
+
+// runSchedules starts the schedules due at the top of every minute until
+// the process exits. Runs missed while the server was down are not made up.
+func (a *app) runSchedules() {
+	for {
+		tick := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(tick))
+
+		schedules, err := a.meta.Schedules()
+		if err != nil {
+			log.Printf("warning: load schedules: %v", err)
+			continue
+		}
+		for _, sc := range schedules {
+			if !sc.Next(tick.Add(-time.Second)).Equal(tick) {
+				continue
+			}
+			runID, ok := a.scheduler.begin(sc.ID)
+			if !ok {
+				log.Printf("warning: schedule %q skipped: its previous run is still in progress", sc.Name)
+				continue
+			}
+			go a.runSchedule(sc, runID, schedule.TriggerCron)
+		}
+	}
+}
+
+// runSchedule runs a schedule's query and delivers the result to its sinks,
+// retrying what failed: the query, or the sinks that didn't take the result.
+func (a *app) runSchedule(sc meta.Schedule, runID, trigger string) {
+	defer a.scheduler.end(sc.ID)
+
+	run := schedule.Run{
+		ID:        runID,
+		Schedule:  sc.ID,
+		Trigger:   trigger,
+		User:      sc.CreatedBy,
+		StartedAt: time.Now().UTC(),
+	}
+	results := make(map[string]schedule.DeliveryResult)
+	pending := sc.Sinks
+	var d *schedule.Delivery
+	var err error
+	for attempt := 1; ; attempt++ {
+		run.Attempts = attempt
+		err = nil
+		if d == nil {
+			d, err = a.exportSchedule(sc, run)
+		}
+		if d != nil {
+			var failed []string
+			for _, name := range pending {
+				location, derr := a.scheduler.sinks.Deliver(context.Background(), name, *d)
+				res := schedule.DeliveryResult{Sink: name, Location: location}
+				if derr != nil {
+					res.Error = derr.Error()
+					failed = append(failed, name)
+					err = fmt.Errorf("sink %s: %w", name, derr)
+				}
+				results[name] = res
+			}
+			pending = failed
+		}
+		if err == nil || attempt > sc.Retries {
+			break
+		}
+		time.Sleep(sc.Delay(attempt))
+		// Stop retrying a schedule deleted in the meantime
+		if _, lerr := a.meta.Schedule(sc.ID); errors.Is(lerr, meta.ErrNotFound) {
+			break
+		}
+	}
+
+	run.Status = schedule.StatusOK
+	if err != nil {
+		run.Status = schedule.StatusError
+		run.Error = err.Error()
+		log.Printf("warning: schedule %q failed after %d attempts: %v", sc.Name, run.Attempts, err)
+	}
+	if d != nil {
+		run.RowCount = d.Rows
+		run.Bytes = len(d.Body)
+	}
+	for _, name := range sc.Sinks {
+		if res, ok := results[name]; ok {
+			run.Deliveries = append(run.Deliveries, res)
+		}
+	}
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if err := a.scheduler.runs.Add(run); err != nil {
+		log.Printf("error: failed to record schedule run: %v", err)
+	}
+}
+
+// exportSchedule runs a schedule's saved query as the schedule's creator and
+// renders the result in its format. Masking always applies, since the
+// result leaves the app.
+func (a *app) exportSchedule(sc meta.Schedule, run schedule.Run) (delivery *schedule.Delivery, err error) {
+	q, err := a.meta.Query(sc.QueryID)
+	if err != nil {
+		return nil, fmt.Errorf("saved query: %w", err)
+	}
+	src, err := a.sources.Get(q.Source)
+	if err != nil {
+		return nil, err
+	}
+	query, err := params.Bind(q.SQL, src.Dialect.Syntax(), q.Params, sc.Params, time.Now().In(sc.Location()))
+	if err != nil {
+		return nil, err
+	}
+	query, err = validateSelectQuery(src.Dialect, query)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := auth.WithUser(context.Background(), auth.User{Name: sc.CreatedBy, Roles: sc.Roles})
+	ctx, cancel := context.WithTimeout(withMasking(ctx), queryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	rows := 0
+	defer func() {
+		// A run that can't be audited isn't delivered
+		if auditErr := a.recordScheduleAudit(audit.Record{
+			User:       sc.CreatedBy,
+			Action:     audit.ActionScheduledRun,
+			Source:     src.Name,
+			SQL:        query,
+			RowCount:   rows,
+			DurationMs: time.Since(start).Milliseconds(),
+		}, err); auditErr != nil && err == nil {
+			delivery, err = nil, auditErr
+		}
+	}()
+
+	result, err := a.executeSelectQuery(ctx, src, query)
+	if err != nil {
+		return nil, err
+	}
+	defer result.close()
+
+	var buf bytes.Buffer
+	contentType := "text/csv"
+	if sc.Format == meta.FormatJSON {
+		contentType = "application/json"
+		resp := queryResponse{Columns: result.columns, Rows: [][]any{}, Masked: result.mask.Masked()}
+		for result.rows.Next() {
+			if a.scheduler.maxRows > 0 && len(resp.Rows) >= a.scheduler.maxRows {
+				err = errTooManyRows
+				break
+			}
+			values, serr := scanRow(result.rows, len(result.columns))
+			if serr != nil {
+				err = serr
+				break
+			}
+			resp.Rows = append(resp.Rows, normalizeRow(values, result.mask))
+		}
+		if err == nil {
+			err = result.rows.Err()
+		}
+		rows = len(resp.Rows)
+		resp.Count = rows
+		resp.DurationMs = time.Since(start).Milliseconds()
+		if err == nil {
+			err = json.NewEncoder(&buf).Encode(resp)
+		}
+	} else {
+		rows, err = writeCSV(&buf, result, a.scheduler.maxRows)
+	}
+	if errors.Is(err, errTooManyRows) {
+		err = fmt.Errorf("result has more than %d rows (SCHEDULE_MAX_ROWS)", a.scheduler.maxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schedule.Delivery{
+		Schedule:    sc.ID,
+		Name:        sc.Name,
+		Run:         run.ID,
+		Time:        run.StartedAt,
+		Format:      sc.Format,
+		ContentType: contentType,
+		Body:        buf.Bytes(),
+		Rows:        rows,
+	}, nil
+}
+
+// recordScheduleAudit appends an audit record for a statement run by a
+// schedule, outside of any request. It returns errAuditFailed when the record
+// can't be written.
+func (a *app) recordScheduleAudit(rec audit.Record, err error) error {
+	if a.audit == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(err, policy.ErrAccessDenied):
+		rec.Outcome = audit.OutcomeDenied
+		rec.Error = err.Error()
+	case err != nil:
+		rec.Outcome = audit.OutcomeError
+		rec.Error = err.Error()
+	default:
+		rec.Outcome = audit.OutcomeOK
+	}
+	if _, err := a.audit.Append(rec); err != nil {
+		log.Printf("error: failed to write audit record: %v", err)
+		return errAuditFailed
+	}
+	return nil
+}
+
+func (a *app) scheduleResponse(sc meta.Schedule) scheduleResponse {
+	resp := scheduleResponse{Schedule: sc, Running: a.scheduler.runningRun(sc.ID)}
+	if next := sc.Next(time.Now()); !next.IsZero() {
+		resp.NextRun = &next
+	}
+	if last, ok := a.scheduler.runs.Last(sc.ID); ok {
+		resp.LastRun = &last
+	}
+	return resp
+}
+
+// decodeSchedule reads a schedule from the request body and checks that its
+// sinks exist and that its saved query binds the given parameter values.
+func (a *app) decodeSchedule(w http.ResponseWriter, r *http.Request) (meta.Schedule, bool) {
+	var req scheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON body"})
+		return meta.Schedule{}, false
+	}
+	sc := meta.Schedule{
+		Name:       req.Name,
+		QueryID:    req.QueryID,
+		Params:     req.Params,
+		Cron:       req.Cron,
+		Timezone:   req.Timezone,
+		Format:     req.Format,
+		Sinks:      req.Sinks,
+		Retries:    req.Retries,
+		RetryDelay: req.RetryDelay,
+		Paused:     req.Paused,
+	}
+	fail := func(err error) (meta.Schedule, bool) {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return meta.Schedule{}, false
+	}
+	if err := sc.Normalize(); err != nil {
+		return fail(err)
+	}
+	for _, name := range sc.Sinks {
+		if !a.scheduler.sinks.Has(name) {
+			return fail(fmt.Errorf("unknown sink %q", name))
+		}
+	}
+	q, err := a.meta.Query(sc.QueryID)
+	if err != nil {
+		return fail(fmt.Errorf("saved query %q: %w", sc.QueryID, err))
+	}
+	for name := range sc.Params {
+		if params.Find(q.Params, name) == nil {
+			return fail(fmt.Errorf("saved query %q has no parameter %s", q.Name, name))
+		}
+	}
+	src, err := a.sources.Get(q.Source)
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := params.Bind(q.SQL, src.Dialect.Syntax(), q.Params, sc.Params, time.Now().In(sc.Location())); err != nil {
+		return fail(err)
+	}
+	return sc, true
+}
+
+// lookupSchedule fetches a schedule, writing an error response if it is unavailable.
+func (a *app) lookupSchedule(w http.ResponseWriter, id string) (meta.Schedule, bool) {
+	if !a.requireScheduler(w) {
+		return meta.Schedule{}, false
+	}
+	sc, err := a.meta.Schedule(id)
+	if err != nil {
+		respondJSON(w, metaErrorStatus(err), map[string]string{"error": "schedule: " + err.Error()})
+		return meta.Schedule{}, false
+	}
+	return sc, true
+}
+
+// requireScheduler writes an error response when scheduling is unavailable.
+func (a *app) requireScheduler(w http.ResponseWriter) bool {
+	if a.scheduler == nil {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "scheduled queries are not enabled"})
+		return false
+	}
+	return true
+}
+
+// requestRoles returns the caller's roles, if authenticated.
+func requestRoles(r *http.Request) []string {
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		return u.Roles
+	}
+	return nil
+}
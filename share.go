@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/share"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultShareTTL    = 7 * 24 * time.Hour
+	defaultShareMaxTTL = 30 * 24 * time.Hour
+	sharePurgeInterval = time.Hour
+)
+
+type shareRequest struct {
+	Query     string `json:"query"`
+	Source    string `json:"source"`
+	Snapshot  bool   `json:"snapshot"`  // Freeze the current result rows
+	Limit     int    `json:"limit"`     // Row cap for the snapshot
+	ExpiresIn string `json:"expiresIn"` // Go duration, e.g. "72h"
+}
+
+type shareResponse struct {
+	ID        string `json:"id,omitempty"`
+	URL       string `json:"url,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (a *app) handleShareCreate(w http.ResponseWriter, r *http.Request) {
+	if a.shares == nil {
+		respondJSON(w, http.StatusServiceUnavailable, shareResponse{Error: "sharing is not enabled"})
+		return
+	}
+
+	var req shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, shareResponse{Error: "invalid JSON body"})
+		return
+	}
+
+	src, err := a.sources.Get(req.Source)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, shareResponse{Error: err.Error()})
+		return
+	}
+	query, err := validateSelectQuery(src.Dialect, req.Query)
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, shareResponse{Error: err.Error()})
+		return
+	}
+
+	ttl := a.shareTTL
+	if req.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			respondJSON(w, http.StatusBadRequest, shareResponse{Error: "invalid expiresIn duration"})
+			return
+		}
+	}
+	ttl = min(ttl, a.shareMaxTTL)
+
+	now := time.Now().UTC()
+	sh := share.Share{
+		SQL:       query,
+		Source:    src.Name,
+		CreatedBy: requestUser(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	// Snapshots are captured server-side so they obey the same row caps as
+	// /query, and always masked since viewers may lack the creator's roles
+	if req.Snapshot {
+		result, status := a.runQuery(withMasking(r.Context()), src.Name, query, req.Limit)
+		if err := a.recordAudit(r, status, audit.Record{
+			Action:     audit.ActionShareSnapshot,
+			Source:     src.Name,
+			SQL:        query,
+			RowCount:   result.Count,
+			DurationMs: result.DurationMs,
+			Error:      result.Error,
+		}); err != nil {
+			respondJSON(w, http.StatusServiceUnavailable, shareResponse{Error: err.Error()})
+			return
+		}
+		if result.Error != "" {
+			respondJSON(w, status, shareResponse{Error: result.Error})
+			return
+		}
+		sh.Snapshot = &share.Snapshot{
+			Columns:    result.Columns,
+			Rows:       result.Rows,
+			Count:      result.Count,
+			More:       result.More,
+			Masked:     result.Masked,
+			CapturedAt: now,
+		}
+	}
+
+	sh, err = a.shares.Create(sh)
+	if err != nil {
+		log.Printf("create share: %v", err)
+		respondJSON(w, http.StatusInternalServerError, shareResponse{Error: "failed to store share"})
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, shareResponse{
+		ID:        sh.ID,
+		URL:       "/s/" + sh.ID,
+		ExpiresAt: sh.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (a *app) handleShareGet(w http.ResponseWriter, r *http.Request) {
+	sh, ok := a.lookupShare(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	if err := a.checkSnapshotAccess(r, sh); err != nil {
+		respondJSON(w, http.StatusForbidden, shareResponse{Error: err.Error()})
+		return
+	}
+	respondJSON(w, http.StatusOK, sh)
+}
+
+func (a *app) handleShareDelete(w http.ResponseWriter, r *http.Request) {
+	sh, ok := a.lookupShare(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	if sh.CreatedBy != requestUser(r) {
+		respondJSON(w, http.StatusForbidden, shareResponse{Error: "only the creator can delete a share"})
+		return
+	}
+	if err := a.shares.Delete(sh.ID); err != nil && !errors.Is(err, share.ErrNotFound) {
+		respondJSON(w, http.StatusInternalServerError, shareResponse{Error: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSharePage opens the UI prefilled with a shared query, showing the
+// frozen snapshot read-only when one was captured.
+func (a *app) handleSharePage(w http.ResponseWriter, r *http.Request) {
+	if a.shares == nil {
+		http.Error(w, "sharing is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	sh, err := a.shares.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "share not found or expired", http.StatusNotFound)
+		return
+	}
+	if err := a.checkSnapshotAccess(r, sh); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	data := a.indexData(r)
+	data.DefaultQuery = sh.SQL
+	data.Share = &sh
+	a.renderIndex(w, data)
+}
+
+// checkSnapshotAccess stops a frozen snapshot from showing data the viewer's
+// access policy wouldn't let them query themselves.
+func (a *app) checkSnapshotAccess(r *http.Request, sh share.Share) error {
+	if sh.Snapshot == nil {
+		return nil
+	}
+	src, err := a.sources.Get(sh.Source)
+	if err != nil {
+		return err
+	}
+	return a.checkQueryAccess(r.Context(), src, sh.SQL)
+}
+
+// lookupShare fetches a share, writing an error response if it is unavailable.
+func (a *app) lookupShare(w http.ResponseWriter, id string) (share.Share, bool) {
+	if a.shares == nil {
+		respondJSON(w, http.StatusServiceUnavailable, shareResponse{Error: "sharing is not enabled"})
+		return share.Share{}, false
+	}
+	sh, err := a.shares.Get(id)
+	if errors.Is(err, share.ErrNotFound) {
+		respondJSON(w, http.StatusNotFound, shareResponse{Error: "share not found or expired"})
+		return share.Share{}, false
+	}
+	if err != nil {
+		respondJSON(w, http.StatusInternalServerError, shareResponse{Error: err.Error()})
+		return share.Share{}, false
+	}
+	return sh, true
+}
+
+// purgeExpiredShares periodically deletes expired shares until the process exits.
+func (a *app) purgeExpiredShares() {
+	ticker := time.NewTicker(sharePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := a.shares.PurgeExpired(time.Now())
+		if err != nil {
+			log.Printf("warning: share purge failed: %v", err)
+		} else if n > 0 {
+			log.Printf("purged %d expired shares", n)
+		}
+		<-ticker.C
+	}
+}
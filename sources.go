@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+type sourceInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Driver      string `json:"driver"`
+	ReadOnly    bool   `json:"readOnly"`
+	Default     bool   `json:"default"`
+	TableCount  int    `json:"tableCount"` // Tables visible to the caller
+	LastRefresh string `json:"lastRefresh,omitempty"`
+}
+
+func (a *app) handleSources(w http.ResponseWriter, r *http.Request) {
+	def := a.sources.Default()
+	var list []sourceInfo
+	for _, src := range a.sources.List() {
+		info := sourceInfo{
+			Name:        src.Name,
+			Description: src.Description,
+			Driver:      src.Driver,
+			ReadOnly:    src.ReadOnly,
+			Default:     src == def,
+			TableCount:  len(src.Schema.GetTablesFiltered(a.schemaFilter(r.Context(), src))),
+		}
+		if t := src.Schema.GetLastRefresh(); !t.IsZero() {
+			info.LastRefresh = t.Format(time.RFC3339)
+		}
+		list = append(list, info)
+	}
+	respondJSON(w, http.StatusOK, map[string]any{"sources": list})
+}
+
+// sourceName resolves the source a request names, so that history and audit
+// records keep the actual source even if the default later changes.
+func (a *app) sourceName(name string) string {
+	if name == "" {
+		return a.sources.Default().Name
+	}
+	return name
+}
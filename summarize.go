@@ -0,0 +1,188 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/audit"
+	"github.com/JonMunkholm/WebDbReader/internal/llm"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+	"github.com/JonMunkholm/WebDbReader/internal/summary"
+)
+
+// maxSummaryTokens bounds the length of a summary.
+const maxSummaryTokens = 400
+
+type summarizeRequest struct {
+	SQL    string `json:"sql"`
+	Source string `json:"source"`
+	Prompt string `json:"prompt"` // Question the query answers, if known
+}
+
+type summarizeResponse struct {
+	Summary          string           `json:"summary,omitempty"`
+	RowsRead         int              `json:"rowsRead"`          // Rows the aggregates cover
+	More             bool             `json:"more,omitempty"`    // The result had more rows than were read
+	CellsSent        int              `json:"cellsSent"`         // Result values given to the LLM
+	Columns          []summary.Column `json:"columns,omitempty"` // Aggregates given to the LLM
+	Tokens           int              `json:"tokens,omitempty"`
+	PromptTokens     int              `json:"promptTokens,omitempty"`
+	CompletionTokens int              `json:"completionTokens,omitempty"`
+	Cost             float64          `json:"cost,omitempty"`
+	Provider         string           `json:"provider,omitempty"`
+	Model            string           `json:"model,omitempty"`
+	Error            string           `json:"error,omitempty"`
+}
+
+// handleSummarize runs a query again and asks the LLM to describe its result
+// in a few sentences, citing numbers from aggregates computed here and from
+// as many leading rows as SUMMARY_MAX_CELLS allows.
+func (a *app) handleSummarize(w http.ResponseWriter, r *http.Request) {
+	var req summarizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, summarizeResponse{Error: "invalid JSON body"})
+		return
+	}
+
+	start := time.Now()
+	src := a.sourceName(req.Source)
+	resp, status := a.summarize(w, r, src, req)
+	if strings.TrimSpace(req.SQL) != "" {
+		if err := a.recordAudit(r, status, audit.Record{
+			Action:     audit.ActionSummarize,
+			Source:     src,
+			SQL:        strings.TrimSpace(req.SQL),
+			Prompt:     req.Prompt,
+			RowCount:   resp.RowsRead,
+			DurationMs: time.Since(start).Milliseconds(),
+			Error:      resp.Error,
+		}); err != nil {
+			respondJSON(w, http.StatusServiceUnavailable, summarizeResponse{Error: err.Error()})
+			return
+		}
+	}
+	respondJSON(w, status, resp)
+}
+
+func (a *app) summarize(w http.ResponseWriter, r *http.Request, sourceName string, req summarizeRequest) (summarizeResponse, int) {
+	src, err := a.sources.Get(sourceName)
+	if err != nil {
+		return summarizeResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+	if a.llm == nil {
+		return summarizeResponse{
+			Error: "LLM not configured. Set LLM_API_KEY environment variable.",
+		}, http.StatusServiceUnavailable
+	}
+	query, err := validateSelectQuery(src.Dialect, req.SQL)
+	if err != nil {
+		return summarizeResponse{Error: err.Error()}, http.StatusBadRequest
+	}
+	// The result goes to the LLM, so it may only read what the LLM may see
+	if !a.redactionAllows(src, query) {
+		return summarizeResponse{Error: errWithheldQuery.Error()}, http.StatusForbidden
+	}
+
+	user := requestUser(r)
+	reservation, err := a.reserveBudget(w, user)
+	if err != nil {
+		return summarizeResponse{Error: err.Error()}, http.StatusTooManyRequests
+	}
+	defer reservation.Release()
+
+	in, err := a.profileResult(r.Context(), src, query)
+	if err != nil {
+		return summarizeResponse{Error: err.Error()}, queryErrorStatus(err)
+	}
+	in.Question = strings.TrimSpace(req.Prompt)
+	out := summarizeResponse{
+		RowsRead:  in.RowsRead,
+		More:      in.MoreRows,
+		CellsSent: in.Cells(),
+		Columns:   in.Columns,
+	}
+
+	prompt, err := summary.Prompt(in)
+	if err != nil {
+		out.Error = err.Error()
+		return out, http.StatusInternalServerError
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+	resp, err := a.llm.GenerateSQL(ctx, llm.GenerateRequest{
+		Prompt:    prompt,
+		System:    summary.Instruction,
+		Dialect:   src.Dialect.Name(),
+		MaxTokens: maxSummaryTokens,
+		Prose:     true,
+	})
+	out.Tokens, out.PromptTokens, out.CompletionTokens = resp.Tokens, resp.PromptTokens, resp.CompletionTokens
+	out.Provider, out.Model = cmp.Or(resp.Provider, a.llm.Name()), resp.Model
+	out.Cost = a.recordUsage(user, out.Provider, out.Model, resp.PromptTokens, resp.CompletionTokens, resp.Tokens)
+	if err != nil {
+		out.Error = resp.Error
+		return out, http.StatusInternalServerError
+	}
+	if out.Summary = strings.TrimSpace(resp.Text); out.Summary == "" {
+		out.Error = "LLM returned an empty summary"
+		return out, http.StatusInternalServerError
+	}
+	return out, http.StatusOK
+}
+
+// profileResult runs a query as the caller, masked like /query, and profiles
+// up to maxLimit rows of its result. What is kept of the aggregates and the
+// leading rows fits in the cell budget.
+func (a *app) profileResult(ctx context.Context, src *source.Source, query string) (summary.Input, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := a.executeSelectQuery(ctx, src, query)
+	if err != nil {
+		return summary.Input{}, err
+	}
+	defer result.close()
+
+	var types []string
+	if cts, err := result.rows.ColumnTypes(); err == nil {
+		for _, ct := range cts {
+			types = append(types, ct.DatabaseTypeName())
+		}
+	}
+	profiler := summary.NewProfiler(result.columns, types)
+	sampleRows := summary.SampleRows(maxLimit, len(result.columns), a.summaryCells)
+
+	in := summary.Input{SQL: query, Rows: [][]any{}}
+	for result.rows.Next() {
+		if profiler.Rows() == maxLimit {
+			in.MoreRows = true
+			break
+		}
+		values, err := scanRow(result.rows, len(result.columns))
+		if err != nil {
+			return summary.Input{}, err
+		}
+		row := normalizeRow(values, result.mask)
+		profiler.Add(row)
+		if len(in.Rows) < sampleRows {
+			in.Rows = append(in.Rows, row)
+		}
+	}
+	if err := result.rows.Err(); err != nil {
+		return summary.Input{}, err
+	}
+	if profiler.Rows() == 0 {
+		return summary.Input{}, errors.New("the query returned no rows to summarize")
+	}
+
+	in.RowsRead = profiler.Rows()
+	in.Columns = profiler.Columns()
+	in.Fit(a.summaryCells)
+	return in, nil
+}
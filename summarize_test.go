@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JonMunkholm/WebDbReader/internal/llm"
+	"github.com/JonMunkholm/WebDbReader/internal/source"
+)
+
+// recordingProvider answers every request with a fixed text and keeps the prompts.
+type recordingProvider struct {
+	prompts []string
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) GenerateSQL(_ context.Context, req llm.GenerateRequest) (llm.GenerateResponse, error) {
+	p.prompts = append(p.prompts, req.System+"\n"+req.Prompt)
+	return llm.GenerateResponse{Text: "Two users."}, nil
+}
+
+func TestSummarizeWithholdsRedactedColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "people.sqlite")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, ssn TEXT)`,
+		`INSERT INTO users VALUES (1, 'Ada', '078-05-1120'), (2, 'Grace', '219-09-9999')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	sources, err := source.Open(context.Background(), source.Config{
+		Sources: []source.Definition{{Name: "people", DSN: "sqlite:///" + path}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sources.Close()
+
+	redactor, err := llm.NewRedactor(llm.RedactConfig{Columns: []string{"users.ssn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &recordingProvider{}
+	a := &app{
+		sources: sources,
+		generation: generation{
+			llm:          provider,
+			redactor:     redactor,
+			summaryCells: 200,
+		},
+	}
+
+	tests := []struct {
+		sql    string
+		status int
+	}{
+		{"SELECT name FROM users", http.StatusOK},
+		{"SELECT name, ssn FROM users", http.StatusForbidden},
+		{"SELECT upper(ssn) AS x FROM users", http.StatusForbidden},
+		{"SELECT * FROM users", http.StatusForbidden},
+		{"SELECT u.* FROM users u", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/summarize", nil)
+		resp, status := a.summarize(httptest.NewRecorder(), r, "people", summarizeRequest{SQL: tt.sql})
+		if status != tt.status {
+			t.Errorf("%s: status %d (%s), want %d", tt.sql, status, resp.Error, tt.status)
+		}
+	}
+
+	if len(provider.prompts) != 1 {
+		t.Fatalf("provider called %d times, want 1", len(provider.prompts))
+	}
+	for _, p := range provider.prompts {
+		for _, leak := range []string{"ssn", "078-05-1120", "219-09-9999"} {
+			if strings.Contains(p, leak) {
+				t.Errorf("prompt sent to the provider contains %q:\n%s", leak, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JonMunkholm/WebDbReader/internal/auth"
+	"github.com/JonMunkholm/WebDbReader/internal/usage"
+)
+
+const (
+	defaultUsageDays = 7
+	maxUsageDays     = 366
+)
+
+// generateSQLWithBudget runs generateSQL for the caller unless they have spent
+// their daily LLM budget, and records the tokens it used.
+func (a *app) generateSQLWithBudget(w http.ResponseWriter, r *http.Request, sourceName, prompt string, useCache bool) (generateSQLResponse, int) {
+	user := requestUser(r)
+	reservation, err := a.reserveBudget(w, user)
+	if err != nil {
+		// Cached answers cost nothing, so they're still given
+		if src, srcErr := a.sources.Get(sourceName); srcErr == nil && useCache {
+			if out, ok := a.cachedAnswer(r.Context(), src, prompt); ok {
+				w.Header().Del("Retry-After")
+				return out, http.StatusOK
+			}
+		}
+		return generateSQLResponse{Error: err.Error()}, http.StatusTooManyRequests
+	}
+	defer reservation.Release()
+
+	resp, status := a.generateSQL(r.Context(), sourceName, prompt, useCache)
+	resp.Cost = a.recordUsage(user, resp.Provider, resp.Model, resp.PromptTokens, resp.CompletionTokens, resp.Tokens)
+	return resp, status
+}
+
+// reserveBudget holds back part of the user's daily LLM budget for one
+// request. It returns an error, and sets the Retry-After header, when the
+// budget is spent. Release the reservation after recording the usage.
+func (a *app) reserveBudget(w http.ResponseWriter, user string) (*usage.Reservation, error) {
+	if a.usage == nil || a.llm == nil {
+		return nil, nil
+	}
+	reservation, err := a.usage.Reserve(user, time.Now())
+	var budgetErr *usage.BudgetError
+	if errors.As(err, &budgetErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(budgetErr.ResetAt).Seconds())+1))
+	}
+	return reservation, err
+}
+
+// recordUsage records the tokens an LLM request used and returns its cost.
+func (a *app) recordUsage(user, provider, model string, promptTokens, completionTokens, tokens int) float64 {
+	if a.usage == nil || tokens <= 0 {
+		return 0
+	}
+	ev, err := a.usage.Record(usage.Event{
+		User:             user,
+		Provider:         provider,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Tokens:           tokens,
+	})
+	if err != nil {
+		log.Printf("error: failed to record LLM usage: %v", err)
+		return 0
+	}
+	return ev.Cost
+}
+
+// budgetStatus is a user's daily budget and what is left of it today.
+type budgetStatus struct {
+	DailyTokens     int64    `json:"dailyTokens,omitempty"`
+	DailyCost       float64  `json:"dailyCost,omitempty"`
+	RemainingTokens *int64   `json:"remainingTokens,omitempty"`
+	RemainingCost   *float64 `json:"remainingCost,omitempty"`
+	ResetAt         string   `json:"resetAt"`
+}
+
+type usageResponse struct {
+	User   string        `json:"user,omitempty"`   // Empty when listing every user
+	Today  *usage.Day    `json:"today,omitempty"`  // The user's usage today
+	Budget *budgetStatus `json:"budget,omitempty"` // nil when the user has no budget
+	Days   []usage.Day   `json:"days"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// handleUsage reports LLM usage per day. Callers see their own; admins may
+// ask for another user's with ?user= or everyone's with ?all=true.
+func (a *app) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if a.usage == nil {
+		respondJSON(w, http.StatusServiceUnavailable, usageResponse{Error: "usage tracking is not enabled"})
+		return
+	}
+
+	q := r.URL.Query()
+	user := requestUser(r)
+	isAdmin := false
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		isAdmin = u.IsAdmin()
+	}
+	if (q.Get("user") != "" && q.Get("user") != user) || q.Get("all") == "true" {
+		if !isAdmin {
+			respondJSON(w, http.StatusForbidden, usageResponse{Error: "admin role required to see other users' usage"})
+			return
+		}
+		user = q.Get("user")
+		if q.Get("all") == "true" {
+			user = ""
+		}
+	}
+
+	now := time.Now().UTC()
+	until, err := parseTimeParam(q.Get("until"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, usageResponse{Error: "invalid until: " + err.Error()})
+		return
+	}
+	if until.IsZero() {
+		until = now
+	}
+	since, err := parseTimeParam(q.Get("since"))
+	if err != nil {
+		respondJSON(w, http.StatusBadRequest, usageResponse{Error: "invalid since: " + err.Error()})
+		return
+	}
+	if since.IsZero() {
+		since = until.AddDate(0, 0, -(defaultUsageDays - 1))
+	}
+	if until.Sub(since) > maxUsageDays*24*time.Hour {
+		respondJSON(w, http.StatusBadRequest, usageResponse{Error: "range may span at most " + strconv.Itoa(maxUsageDays) + " days"})
+		return
+	}
+
+	resp := usageResponse{User: user, Days: a.usage.Days(user, since, until)}
+	if user != "" {
+		today := a.usage.Today(user, now)
+		resp.Today = &today
+		resp.Budget = a.budgetStatus(user, today, now)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func (a *app) budgetStatus(user string, today usage.Day, now time.Time) *budgetStatus {
+	b := a.usage.Budget(user)
+	if b.DailyTokens <= 0 && b.DailyCost <= 0 {
+		return nil
+	}
+	status := &budgetStatus{
+		DailyTokens: b.DailyTokens,
+		DailyCost:   b.DailyCost,
+		ResetAt:     now.Truncate(24 * time.Hour).Add(24 * time.Hour).Format(time.RFC3339),
+	}
+	if b.DailyTokens > 0 {
+		left := max(b.DailyTokens-today.Tokens, 0)
+		status.RemainingTokens = &left
+	}
+	if b.DailyCost > 0 {
+		left := max(b.DailyCost-today.Cost, 0)
+		status.RemainingCost = &left
+	}
+	return status
+}